@@ -1,5 +1,10 @@
 package golevel7
 
+import (
+	"fmt"
+	"strings"
+)
+
 // ACK is struct for an ack message
 type ACK struct {
 	Code         string `hl7:"MSA.1"`
@@ -7,18 +12,145 @@ type ACK struct {
 	ErrMsg       string `hl7:"MSA.3"`
 }
 
+// Acknowledgment codes of MSA-1, table 0008
+const (
+	AckAccept       = "AA" // application accept
+	AckError        = "AE" // application error
+	AckReject       = "AR" // application reject
+	AckCommitAccept = "CA" // commit accept
+	AckCommitError  = "CE" // commit error
+	AckCommitReject = "CR" // commit reject
+)
+
+// Acknowledgment conditions of MSH-15 and MSH-16, table 0155
+const (
+	AckAlways      = "AL"
+	AckNever       = "NE"
+	AckErrorOnly   = "ER"
+	AckSuccessOnly = "SU"
+)
+
+// AckMode holds the acknowledgment conditions requested by a message
+type AckMode struct {
+	Accept      string `hl7:"MSH.15"` // commit acknowledgment condition
+	Application string `hl7:"MSH.16"` // application acknowledgment condition
+}
+
+// Enhanced reports if the message asks for enhanced mode acknowledgments
+// original mode is used when both MSH-15 and MSH-16 are empty
+func (a AckMode) Enhanced() bool {
+	return a.Accept != "" || a.Application != ""
+}
+
+// wanted reports if an acknowledgment is sent for condition cond
+// empty conditions mean always
+func wanted(cond string, failed bool) bool {
+	switch strings.ToUpper(cond) {
+	case AckNever:
+		return false
+	case AckErrorOnly:
+		return failed
+	case AckSuccessOnly:
+		return !failed
+	}
+	return true
+}
+
 // Acknowledge generates an ACK message based on the MsgInfo struct
 // st can be nil for success or to send an AE code
+// st is reported in ERR segments, an *HL7Error with a reject code sends AR, see AcknowledgeMessage
 func Acknowledge(mi MsgInfo, st error) *Message {
-	amsg, _ := StartMessage(*NewMsgInfoAck(&mi))
+	amsg, _ := acknowledge(mi, false, st)
+	return amsg
+}
+
+// AcknowledgeMessage returns the application acknowledgment (AA, AE or AR) for m
+// err is nil when m was processed, an *HL7Error, HL7Errors or any other error otherwise.
+// Each HL7Error becomes an ERR segment, other errors are reported as application
+// errors (AE) with ErrCodeApplicationError. Unsupported message types, events, processing
+// ids, versions and ErrCodeInternal reject the message (AR), warnings and information alone
+// accept it.
+// In enhanced mode nil is returned when MSH-16 asks for no acknowledgment
+func AcknowledgeMessage(m *Message, err error) *Message {
+	mi, _ := m.Info()
+	mode := AckMode{}
+	m.Unmarshal(&mode)
+	if mode.Enhanced() && !wanted(mode.Application, failed(err)) {
+		return nil
+	}
+	amsg, _ := acknowledge(mi, false, err)
+	return amsg
+}
+
+// CommitAcknowledge returns the enhanced mode commit acknowledgment (CA, CE or CR) for m
+// err is nil when m was safely stored, see AcknowledgeMessage for the errors reported.
+// nil is returned for original mode messages or when MSH-15 asks for no acknowledgment
+func CommitAcknowledge(m *Message, err error) *Message {
+	mi, _ := m.Info()
+	mode := AckMode{}
+	m.Unmarshal(&mode)
+	if !mode.Enhanced() || !wanted(mode.Accept, failed(err)) {
+		return nil
+	}
+	amsg, _ := acknowledge(mi, true, err)
+	return amsg
+}
+
+// failed reports if err holds errors, not only warnings and information
+func failed(err error) bool {
+	for _, e := range toHL7Errors(err) {
+		if e.severity() == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ackCode returns the acknowledgment code for the errors errs
+func ackCode(errs HL7Errors, commit bool) string {
+	code := AckAccept
+	for _, e := range errs {
+		if e.severity() != SeverityError {
+			continue
+		}
+		if e.Code.IsReject() {
+			code = AckReject
+			break
+		}
+		code = AckError
+	}
+	if commit {
+		return "C" + code[1:]
+	}
+	return code
+}
+
+// acknowledge builds the acknowledgment of the message described by mi
+func acknowledge(mi MsgInfo, commit bool, st error) (*Message, error) {
+	amsg, err := StartMessage(*NewMsgInfoAck(&mi))
+	if err != nil {
+		return nil, err
+	}
+	errs := toHL7Errors(st)
 	ack := ACK{}
-	ack.Code = "AA"
+	ack.Code = ackCode(errs, commit)
 	ack.OrgControlID = mi.ControlID
 	if st != nil {
-		ack.Code = "AE"
 		ack.ErrMsg = st.Error()
 	}
-
-	Marshal(amsg, &ack)
-	return amsg
+	if _, err := Marshal(amsg, &ack); err != nil {
+		return nil, err
+	}
+	for i, e := range errs {
+		for seq, val := range e.errFields(&amsg.Delimeters) {
+			if val == "" {
+				continue
+			}
+			l := NewLocation(fmt.Sprintf("ERR[%d].%d", i+1, seq))
+			if err := amsg.SetRaw(l, val); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return amsg, nil
 }
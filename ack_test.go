@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAcknowledge(t *testing.T) {
@@ -33,6 +35,9 @@ func TestAcknowledge(t *testing.T) {
 	if ack == nil {
 		t.Fatal("Expected ACK message got nil")
 	}
+	if code, _ := ack.Find("MSA.1"); code != "AE" {
+		t.Errorf("Expected AE got %s", code)
+	}
 	m := NewMsgInfo()
 	m.ReceivingApp = "ORG_REC_APP"
 	m.ReceivingFacility = "ORG_REC_FAC"
@@ -43,3 +48,130 @@ func TestAcknowledge(t *testing.T) {
 		t.Fatal("Expected ACK message got nil")
 	}
 }
+
+const ackModeMsg = "MSH|^~\\&|LAB|PA|EPIC|IHS|20050615230600||ORU^R01|CTRL1|P|2.5|||%s|%s\rPID|1||12001"
+
+func ackModeMessage(t *testing.T, accept, application string) *Message {
+	msg, err := ParseMessage([]byte(fmt.Sprintf(ackModeMsg, accept, application)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestAcknowledgeMessageModes(t *testing.T) {
+	// original mode
+	msg := ackModeMessage(t, "", "")
+	ack := AcknowledgeMessage(msg, nil)
+	if assert.NotNil(t, ack) {
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "AA", code)
+		id, _ := ack.Find("MSA.2")
+		assert.Equal(t, "CTRL1", id)
+		_, err := ack.Segment("ERR")
+		assert.Error(t, err)
+	}
+	assert.Nil(t, CommitAcknowledge(msg, nil))
+
+	// enhanced mode
+	msg = ackModeMessage(t, "AL", "ER")
+	ack = CommitAcknowledge(msg, nil)
+	if assert.NotNil(t, ack) {
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "CA", code)
+	}
+	assert.Nil(t, AcknowledgeMessage(msg, nil))
+	ack = AcknowledgeMessage(msg, NewHL7Error("PID.3", ErrCodeUnknownKey, "patient %s unknown", "12001"))
+	if assert.NotNil(t, ack) {
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "AE", code)
+	}
+	ack = AcknowledgeMessage(msg, NewHL7Error("MSH.9", ErrCodeUnsupportedMsgType, ""))
+	if assert.NotNil(t, ack) {
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "AR", code)
+	}
+	ack = CommitAcknowledge(msg, errors.New("disk full"))
+	if assert.NotNil(t, ack) {
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "CE", code)
+		code, _ = ack.Find("ERR.3.1")
+		assert.Equal(t, "199", code)
+	}
+	ack = CommitAcknowledge(msg, NewHL7Error("", ErrCodeInternal, "disk full"))
+	if assert.NotNil(t, ack) {
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "CR", code)
+		code, _ = ack.Find("ERR.3.1")
+		assert.Equal(t, "207", code)
+	}
+
+	msg = ackModeMessage(t, "NE", "SU")
+	assert.Nil(t, CommitAcknowledge(msg, nil))
+	assert.NotNil(t, AcknowledgeMessage(msg, nil))
+	assert.Nil(t, AcknowledgeMessage(msg, errors.New("failed")))
+	// warnings do not fail a message
+	warn := &HL7Error{Code: ErrCodeValueTooLong, Severity: SeverityWarning, Message: "truncated"}
+	ack = AcknowledgeMessage(msg, warn)
+	if assert.NotNil(t, ack) {
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "AA", code)
+		sev, _ := ack.Find("ERR.4")
+		assert.Equal(t, "W", sev)
+	}
+}
+
+func TestAcknowledgeERR(t *testing.T) {
+	msg := ackModeMessage(t, "", "")
+	errs := HL7Errors{
+		NewHL7Error("PID.3", ErrCodeRequiredFieldMissing, "patient id is required"),
+		{Location: NewLocation("OBX[2].5[1].2"), Code: ErrCodeDataType, Message: "not a number: 1|2"},
+	}
+	ack := AcknowledgeMessage(msg, errs)
+	if ack == nil {
+		t.Fatal("Expected ACK message got nil")
+	}
+	code, _ := ack.Find("MSA.1")
+	assert.Equal(t, "AE", code)
+	segs, err := ack.AllSegments("ERR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(segs))
+
+	tests := map[string]string{
+		"ERR[1].1":   "PID^1^3^101&Required field missing&HL70357",
+		"ERR[1].2":   "PID^1^3^1",
+		"ERR[1].3":   "101^Required field missing^HL70357",
+		"ERR[1].4":   "E",
+		"ERR[1].8":   "patient id is required",
+		"ERR[2].2":   "OBX^2^5^1^2",
+		"ERR[2].3.1": "102",
+		"ERR[2].8":   "not a number: 1|2",
+	}
+	for loc, want := range tests {
+		got, _ := ack.Find(loc)
+		assert.Equal(t, want, got, loc)
+	}
+	raw, _ := ack.FindRaw("ERR[2].8")
+	assert.Equal(t, `not a number: 1\F\2`, raw)
+
+	// parse errors are reported with their location
+	_, perr := ParseMessage([]byte("MSH|^~\\&|A\rPI|12"))
+	ack = Acknowledge(MsgInfo{}, perr)
+	code, _ = ack.Find("MSA.1")
+	assert.Equal(t, "AE", code)
+	code, _ = ack.Find("ERR.3.1")
+	assert.Equal(t, "100", code)
+
+	// validation failures
+	_, failures := msg.IsValid([]Validation{
+		{Location: "PID.5", VCheck: HasValue},
+		{Location: "MSH.11", VCheck: SpecificValue, Value: "T"},
+	})
+	ack = AcknowledgeMessage(msg, ValidationErrors(failures))
+	vals, _ := ack.FindAll("ERR.3.1")
+	assert.Equal(t, []string{"101", "103"}, vals)
+	vals, _ = ack.FindAll("ERR.2")
+	assert.Equal(t, []string{"PID^1^5^1", "MSH^1^11^1"}, vals)
+}
@@ -46,7 +46,14 @@ func NewMsgInfoAck(mi *MsgInfo) *MsgInfo {
 }
 
 // StartMessage returns a Message with an MSH segment based on the MsgInfo struct
+// using the default delimeters
 func StartMessage(info MsgInfo) (*Message, error) {
+	return StartMessageDelimeters(info, NewDelimeters())
+}
+
+// StartMessageDelimeters returns a Message with an MSH segment based on the MsgInfo struct
+// MSH.1 and MSH.2 are set from seps which are used to encode the message
+func StartMessageDelimeters(info MsgInfo, seps *Delimeters) (*Message, error) {
 	if info.MessageType == "" {
 		return nil, fmt.Errorf("Message Type is required")
 	}
@@ -64,7 +71,14 @@ func StartMessage(info MsgInfo) (*Message, error) {
 	if info.VersionID == "" {
 		info.VersionID = "2.4"
 	}
-	msg := NewMessage([]byte{})
-	Marshal(msg, &info)
+	if err := seps.validate(); err != nil {
+		return nil, err
+	}
+	msg := &Message{Delimeters: *seps}
+	msg.Delimeters.DelimeterField = seps.encodingChars()
+	msg.appendSegments("MSH", 1)
+	if _, err := Marshal(msg, &info); err != nil {
+		return nil, err
+	}
 	return msg, nil
 }
@@ -1,6 +1,12 @@
 package golevel7
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestBuildMessage(t *testing.T) {
 
@@ -103,3 +109,70 @@ func TestMessageBuilding(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestBuildMessageRoundTrip(t *testing.T) {
+	mi := MsgInfo{
+		SendingApp:   "BettrLife",
+		ReceivingApp: "Epic",
+		ControlID:    "MSGID1",
+		MsgDate:      "20151209154606",
+	}
+	custom := &Delimeters{Field: '!', Component: '#', Repetition: '*', Escape: '$', SubComponent: '@'}
+	for _, seps := range []*Delimeters{NewDelimeters(), custom} {
+		mi.MessageType = strings.Join([]string{"ORU", "R01", "ORU_R01"}, string(seps.Component))
+		msg, err := StartMessageDelimeters(mi, seps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := struct {
+			LastName  string `hl7:"PID.5.1"`
+			FirstName string `hl7:"PID.5.2"`
+		}{FirstName: "Davin", LastName: "Hills"}
+		b, err := Marshal(msg, &name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix := "MSH" + string(seps.Field) + seps.encodingChars() + string(seps.Field) + "BettrLife"
+		if !strings.HasPrefix(string(b), prefix) {
+			t.Fatalf("Expected %q to start with %q", b, prefix)
+		}
+		assert.Equal(t, string(b), string(msg.Value))
+
+		parsed, err := ParseMessage(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, seps.encodingChars(), parsed.Delimeters.DelimeterField)
+		assert.Equal(t, seps.Field, parsed.Delimeters.Field)
+		for _, loc := range []string{"MSH.0", "MSH.1", "MSH.2", "MSH.3", "MSH.5", "MSH.7", "MSH.9", "MSH.9.3", "MSH.10", "MSH.11", "MSH.12", "PID.5.1", "PID.5.2"} {
+			want, _ := msg.Find(loc)
+			got, _ := parsed.Find(loc)
+			assert.Equal(t, want, got, loc)
+		}
+		val, _ := parsed.Find("MSH.9")
+		assert.Equal(t, mi.MessageType, val)
+		val, _ = parsed.Find("MSH.1")
+		assert.Equal(t, string(seps.Field), val)
+		val, _ = parsed.Find("PID.5.2")
+		assert.Equal(t, "Davin", val)
+
+		assert.NoError(t, msg.Set(NewLocation("MSH.1"), string(seps.Field)))
+		assert.Error(t, msg.Set(NewLocation("MSH.2"), "abcd"))
+	}
+
+	_, err := StartMessageDelimeters(mi, &Delimeters{Field: '|', Component: '|', Repetition: '~', Escape: '\\', SubComponent: '&'})
+	assert.Error(t, err)
+}
+
+func TestEncoderMSH(t *testing.T) {
+	type hdr struct {
+		SendingApp  string `hl7:"MSH.3"`
+		MessageType string `hl7:"MSH.9"`
+		Note        string `hl7:"NTE.3"`
+	}
+	buf := &bytes.Buffer{}
+	if err := NewEncoder(buf).Encode(&hdr{SendingApp: "App", MessageType: "ADT^A08", Note: "see MSH|"}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "MSH|^~\\&|App||||||ADT^A08\rNTE|||see MSH\\F\\", buf.String())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mhald/golevel7"
+)
+
+var getCmd = &command{
+	usage: "[-d delim] [-raw] LOC [file...]",
+	help:  "print the values at a location, one line per message",
+	run:   runGet,
+}
+
+func runGet(e *env, args []string) error {
+	fs := e.flags()
+	delim := fs.String("d", "\t", "delimiter between the values of a message")
+	raw := fs.Bool("raw", false, "print the values as they are encoded")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return e.usageError(fs, "missing location")
+	}
+	loc := fs.Arg(0)
+	return e.scan(fs.Args()[1:], func(file string, n int, m *golevel7.Message) error {
+		findAll := m.FindAll
+		if *raw {
+			findAll = m.FindAllRaw
+		}
+		// a message without the segment prints an empty line
+		vals, _ := findAll(loc)
+		fmt.Fprintln(e.stdout, strings.Join(vals, *delim))
+		return nil
+	})
+}
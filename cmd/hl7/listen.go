@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mhald/golevel7"
+)
+
+var listenCmd = &command{
+	usage: "[-ack codes] [-delay d] [-o dir] [-q] addr",
+	help:  "receive messages over MLLP and acknowledge them, a stand-in for a receiving system",
+	run:   runListen,
+}
+
+// ackErrors are the errors acknowledged by the codes of hl7 listen -ack
+// drop sends no acknowledgement
+var ackErrors = map[string]error{
+	golevel7.AckAccept: nil,
+	golevel7.AckError:  &golevel7.HL7Error{Code: golevel7.ErrCodeRecordLocked, Severity: golevel7.SeverityError, Message: "simulated application error"},
+	golevel7.AckReject: &golevel7.HL7Error{Code: golevel7.ErrCodeInternal, Severity: golevel7.SeverityError, Message: "simulated reject"},
+	"drop":             nil,
+}
+
+func runListen(e *env, args []string) error {
+	fs := e.flags()
+	acks := fs.String("ack", "AA", "comma separated replies to the messages received, in turn: AA, AE, AR or drop")
+	delay := fs.Duration("delay", 0, "time to wait before acknowledging a message")
+	dir := fs.String("o", "", "directory to save the messages received in")
+	quiet := fs.Bool("q", false, "do not print the messages received")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return e.usageError(fs, "missing address to listen on")
+	}
+	l := &listener{e: e, delay: *delay, dir: *dir, quiet: *quiet}
+	for _, code := range strings.Split(*acks, ",") {
+		code = strings.TrimSpace(code)
+		if _, ok := ackErrors[code]; !ok {
+			return e.usageError(fs, fmt.Sprintf("invalid -ack %q", code))
+		}
+		l.acks = append(l.acks, code)
+	}
+	if l.dir != "" {
+		if err := os.MkdirAll(l.dir, 0755); err != nil {
+			return err
+		}
+	}
+	ln, err := net.Listen("tcp", fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	l.log = log.New(e.stderr, "hl7 listen: ", log.Ltime|log.Lmicroseconds)
+	l.log.Printf("listening on %v", ln.Addr())
+	srv := &golevel7.MLLPServer{Handler: l.handle, ErrorLog: l.log}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-e.ctx.Done():
+			srv.Close()
+		case <-stop:
+		}
+	}()
+	if err := srv.Serve(ln); !errors.Is(err, golevel7.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listener acknowledges the messages received by hl7 listen
+type listener struct {
+	e     *env
+	acks  []string // replies, in turn
+	delay time.Duration
+	dir   string
+	quiet bool
+	log   *log.Logger
+
+	mu sync.Mutex
+	n  int // messages received
+}
+
+// handle prints and saves m and returns the next reply
+func (l *listener) handle(m *golevel7.Message) *golevel7.Message {
+	data := encode(m)
+	l.mu.Lock()
+	l.n++
+	n := l.n
+	if !l.quiet {
+		segs := bytes.Split(bytes.TrimRight(data, "\r"), []byte("\r"))
+		fmt.Fprintf(l.e.stdout, "%s\n\n", bytes.Join(segs, []byte("\n")))
+	}
+	l.mu.Unlock()
+
+	mi, _ := m.Info()
+	code := l.acks[(n-1)%len(l.acks)]
+	if l.dir != "" {
+		out := filepath.Join(l.dir, fmt.Sprintf("message-%04d.hl7", n))
+		if err := os.WriteFile(out, data, 0644); err != nil {
+			l.log.Printf("message %d (%s): %v", n, mi.ControlID, err)
+		}
+	}
+	if l.delay > 0 {
+		select {
+		case <-time.After(l.delay):
+		case <-l.e.ctx.Done():
+			return nil
+		}
+	}
+	if code == "drop" {
+		l.log.Printf("message %d (%s) %s: dropped", n, mi.ControlID, mi.MessageType)
+		return nil
+	}
+	ack := golevel7.AcknowledgeMessage(m, ackErrors[code])
+	if ack == nil {
+		l.log.Printf("message %d (%s) %s: no acknowledgement asked", n, mi.ControlID, mi.MessageType)
+		return nil
+	}
+	sent, _ := ack.Find("MSA.1")
+	l.log.Printf("message %d (%s) %s: %s", n, mi.ControlID, mi.MessageType, sent)
+	return ack
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// listen runs hl7 listen with args on a free local port until the returned
+// function is called, which returns its exit code, stdout and stderr
+func listen(t *testing.T, args ...string) (string, func() (int, string, string)) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout, stderr syncBuffer
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, append(append([]string{"listen"}, args...), addr), strings.NewReader(""), &stdout, &stderr)
+	}()
+	for i := 0; ; i++ {
+		if strings.Contains(stderr.String(), "listening on") {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("hl7 listen did not start: %s", stderr.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return addr, func() (int, string, string) {
+		cancel()
+		return <-done, stdout.String(), stderr.String()
+	}
+}
+
+func TestListenSend(t *testing.T) {
+	dir := t.TempDir()
+	addr, stop := listen(t, "-ack", "AA,AE,AR,drop", "-o", dir)
+
+	code, stdout, stderr := hl7(ormValid+ormInvalid+ormValid+ormInvalid+ormValid, "send", "-timeout", "200ms", addr)
+	assert.Equal(t, 1, code, stderr)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if assert.Len(t, lines, 6) {
+		assert.Regexp(t, `^message 1 \(1\): AA \S+$`, lines[0])
+		assert.Regexp(t, `^message 2 \(2\): AE \S+ .*206 Application record locked: simulated application error$`, lines[1])
+		assert.Regexp(t, `^message 3 \(1\): AR \S+ .*207 Application internal error: simulated reject$`, lines[2])
+		assert.Regexp(t, `^message 4 \(2\): .*timeout`, lines[3])
+		// a new connection is made after an error
+		assert.Regexp(t, `^message 5 \(1\): AA \S+$`, lines[4])
+		assert.Regexp(t, `^sent 5: AA 2, AE 1, AR 1, no ACK 1, round trip min \S+ avg \S+ max \S+$`, lines[5])
+	}
+
+	code, stdout, stderr = stop()
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stderr, "message 1 (1) ORM^O01: AA\n")
+	assert.Contains(t, stderr, "message 4 (2) ORM^O01: dropped\n")
+	assert.Contains(t, stdout, strings.ReplaceAll(ormValid, "\r", "\n")+"\n")
+	data, err := os.ReadFile(filepath.Join(dir, "message-0002.hl7"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, ormInvalid, string(data))
+	}
+}
+
+func TestListenDelay(t *testing.T) {
+	addr, stop := listen(t, "-q", "-delay", "100ms")
+	code, stdout, stderr := hl7(ormValid, "send", addr)
+	assert.Equal(t, 0, code, stderr)
+	assert.Regexp(t, `^message 1 \(1\): AA 1\d\d(\.\d+)?ms\n`, stdout)
+
+	code, stdout, _ = stop()
+	assert.Equal(t, 0, code)
+	assert.Empty(t, stdout)
+}
+
+func TestListenSendUsage(t *testing.T) {
+	code, _, stderr := hl7("", "listen", "-ack", "AA,XX", ":0")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `invalid -ack "XX"`)
+
+	code, _, stderr = hl7("", "listen")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "missing address")
+
+	code, _, stderr = hl7("", "send")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "missing address")
+
+	// nothing listening
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	code, stdout, _ := hl7(ormValid, "send", "-timeout", "100ms", addr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "message 1 (1): dial tcp")
+	assert.Contains(t, stdout, "sent 1: no ACK 1\n")
+}
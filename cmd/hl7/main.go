@@ -0,0 +1,192 @@
+// Command hl7 inspects, validates and splits HL7 v2 messages
+//
+//	hl7 pretty [-c] [file...]
+//	hl7 get [-d delim] LOC [file...]
+//	hl7 validate [-profile file] [-json] [file...]
+//	hl7 split [-o dir] [-prefix name] [file...]
+//	hl7 listen [-ack codes] [-delay d] [-o dir] [-q] addr
+//	hl7 send [-timeout d] addr [file...]
+//
+// Messages are read from the files, or stdin when there are none or the file is -
+// A file can hold several messages, see golevel7.MessageScanner
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/mhald/golevel7"
+)
+
+// command is a subcommand of hl7
+type command struct {
+	usage string
+	help  string
+	run   func(e *env, args []string) error
+}
+
+var commands = map[string]*command{
+	"pretty":   prettyCmd,
+	"get":      getCmd,
+	"validate": validateCmd,
+	"split":    splitCmd,
+	"listen":   listenCmd,
+	"send":     sendCmd,
+}
+
+// errFailed makes hl7 exit with 1 once the command has reported the failure
+var errFailed = errors.New("failed")
+
+// errUsage makes hl7 exit with 2 after printing the usage of the command
+var errUsage = errors.New("usage")
+
+// env is the environment a command runs in
+type env struct {
+	ctx    context.Context // done when hl7 is interrupted
+	name   string          // name of the command
+	cmd    *command
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command of args and returns the exit code
+// 0 on success, 1 when the command fails and 2 on usage errors
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "hl7: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	e := &env{ctx: ctx, name: args[0], cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr}
+	switch err := cmd.run(e, args[1:]); {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, errFailed):
+		return 1
+	default:
+		e.errorf("%v", err)
+		return 1
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: hl7 <command> [arguments]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-9s %s\n", name, commands[name].help)
+	}
+}
+
+// flags returns the flag set of the command, printing its usage to stderr
+func (e *env) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("hl7 "+e.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: hl7 %s %s\n\n%s\n", e.name, e.cmd.usage, e.cmd.help)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of args, fs has printed the error and usage when it fails
+func (e *env) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// usageError prints msg and the usage of the command
+func (e *env) usageError(fs *flag.FlagSet, msg string) error {
+	fmt.Fprintf(e.stderr, "hl7 %s: %s\n", e.name, msg)
+	fs.Usage()
+	return errUsage
+}
+
+func (e *env) errorf(format string, args ...interface{}) {
+	fmt.Fprintf(e.stderr, "hl7 %s: %s\n", e.name, fmt.Sprintf(format, args...))
+}
+
+// scan calls fn for each message of the files, or stdin when there are none
+// n counts the messages of all the files from 1. Invalid messages are reported and
+// skipped, scan returns errFailed if there were any once all the messages were handled
+// An error returned by fn stops the scan
+func (e *env) scan(files []string, fn func(file string, n int, m *golevel7.Message) error) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	invalid := 0
+	n := 0
+	for _, file := range files {
+		bad, err := e.scanFile(file, &n, fn)
+		invalid += bad
+		if err != nil {
+			return err
+		}
+	}
+	if invalid > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// scanFile calls fn for each message of file, counted from n, and returns the count of
+// invalid messages, the file is closed once scanned
+func (e *env) scanFile(file string, n *int, fn func(file string, n int, m *golevel7.Message) error) (int, error) {
+	r := e.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+	invalid := 0
+	ms := golevel7.NewMessageScanner(r)
+	ms.SkipInvalid = true
+	for {
+		ok := ms.Scan()
+		for _, serr := range ms.Errors() {
+			e.errorf("%s: %v", file, serr)
+			invalid++
+		}
+		if !ok {
+			break
+		}
+		*n++
+		if err := fn(file, *n, ms.Message()); err != nil {
+			return invalid, err
+		}
+	}
+	if err := ms.Err(); err != nil {
+		return invalid, fmt.Errorf("%s: %v", file, err)
+	}
+	return invalid, nil
+}
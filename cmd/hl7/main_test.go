@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ormValid = "MSH|^~\\&|HIS|MC|DIET|MC|20060307110114||ORM^O01|1|P|2.4\r" +
+		"PID|||12001||Jones^John||19670824|M\r" +
+		"PV1||I\r" +
+		"ORC|NW\r"
+	// PID.3 is required
+	ormInvalid = "MSH|^~\\&|HIS|MC|DIET|MC|20060307110114||ORM^O01|2|P|2.4\r" +
+		"PID|||||Smith^Ann^^^^^L~Smith^A||19700101|F\r" +
+		"PV1||O\r" +
+		"ORC|NW\r"
+)
+
+// hl7 runs the command args with stdin and returns its exit code, stdout and stderr
+func hl7(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := hl7("")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "usage: hl7 <command>")
+	assert.Contains(t, stderr, "validate")
+
+	code, _, stderr = hl7("", "frob")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "frob"`)
+
+	code, _, stderr = hl7("", "get")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "missing location")
+	assert.Contains(t, stderr, "usage: hl7 get")
+
+	code, _, _ = hl7("", "pretty", "-x")
+	assert.Equal(t, 2, code)
+
+	code, _, stderr = hl7("", "pretty", "nosuchfile.hl7")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "hl7 pretty: open nosuchfile.hl7")
+}
+
+func TestPretty(t *testing.T) {
+	code, stdout, stderr := hl7(ormValid+"\n"+ormInvalid, "pretty", "-c")
+	assert.Equal(t, 0, code, stderr)
+	lines := strings.Split(stdout, "\n")
+	assert.Equal(t, "MSH", lines[0])
+	assert.Regexp(t, `^  MSH\.3 +Sending Application +HIS$`, lines[3])
+	assert.Contains(t, stdout, "\nPID\n")
+	assert.Regexp(t, `\n  PID\.5 +Patient Name +Jones\^John\n    PID\.5\.1 +Jones\n    PID\.5\.2 +John\n`, stdout)
+	assert.Regexp(t, `\n  PID\.5\[2\] +Patient Name +Smith\^A\n`, stdout)
+	// messages are separated by an empty line
+	assert.Contains(t, stdout, "ORC.1  Order Control  NW\n\nMSH\n")
+	assert.NotContains(t, stdout, "PID.4")
+}
+
+func TestGet(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "orm.hl7")
+	assert.NoError(t, os.WriteFile(file, []byte(ormInvalid), 0644))
+
+	code, stdout, _ := hl7(ormValid, "get", "PID.5.1", "-", file)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Jones\nSmith\tSmith\n", stdout)
+
+	code, stdout, _ = hl7(ormInvalid, "get", "-d", ",", "PID.5")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Smith^Ann^^^^^L,Smith^A\n", stdout)
+
+	// a missing segment is an empty line
+	code, stdout, _ = hl7(ormValid+ormInvalid, "get", "OBX.5")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "\n\n", stdout)
+
+	code, stdout, _ = hl7("MSH|^~\\&|A||||||ADT^A01|1|P|2.4\rPID|||1||O\\S\\Brien\r", "get", "-raw", "PID.5")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "O\\S\\Brien\n", stdout)
+
+	// invalid messages are reported and skipped
+	code, stdout, stderr := hl7("PID|1\r\n"+ormValid, "get", "MSH.10")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "1\n", stdout)
+	assert.Contains(t, stderr, "hl7 get: -: message 0")
+}
+
+func TestValidate(t *testing.T) {
+	code, stdout, stderr := hl7(ormValid+ormInvalid, "validate")
+	assert.Equal(t, 1, code, stderr)
+	assert.Contains(t, stdout, "-: message 1 (1): valid\n")
+	assert.Contains(t, stdout, "-: message 2 (2): invalid\n  E PID[1].3: ")
+	assert.Contains(t, stdout, "[PID.3:min]")
+
+	code, stdout, _ = hl7(ormValid, "validate", "-json")
+	assert.Equal(t, 0, code)
+	doc := map[string]interface{}{}
+	if assert.NoError(t, json.Unmarshal([]byte(stdout), &doc)) {
+		assert.Equal(t, map[string]interface{}{"controlId": "1", "file": "-", "message": 1.0, "valid": true, "violations": []interface{}{}}, doc)
+	}
+
+	// without a registered profile
+	code, _, stderr = hl7("MSH|^~\\&|A||||||ADT^A08|3|P|2.4\rPID|||1\r", "validate")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, `No profile for message type "ADT^A08"`)
+
+	profile := filepath.Join(t.TempDir(), "adt.json")
+	assert.NoError(t, os.WriteFile(profile, []byte(`{"messageType": "ADT^A08", "segments": [{"name": "EVN", "usage": "R"}]}`), 0644))
+	code, stdout, _ = hl7("MSH|^~\\&|A||||||ADT^A08|3|P|2.4\rEVN|A08\rPID|||1\r", "validate", "-profile", profile)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "-: message 1 (3): valid\n", stdout)
+	code, stdout, _ = hl7("MSH|^~\\&|A||||||ADT^A08|3|P|2.4\rPID|||1\r", "validate", "-profile", profile)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "segment EVN occurs 0 times")
+	// a message of another type than the profile
+	code, stdout, _ = hl7("MSH|^~\\&|A||||||ADT^A01|3|P|2.4\rEVN|A01\r", "validate", "-profile", profile)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "expected message type ADT^A08")
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "batch.hl7")
+	assert.NoError(t, os.WriteFile(in, []byte(ormValid+"\n"+ormInvalid+"\n"), 0644))
+	out := filepath.Join(dir, "out")
+
+	code, stdout, stderr := hl7("", "split", "-o", out, in)
+	assert.Equal(t, 0, code, stderr)
+	first, second := filepath.Join(out, "batch-0001.hl7"), filepath.Join(out, "batch-0002.hl7")
+	assert.Equal(t, first+"\n"+second+"\n", stdout)
+	data, err := os.ReadFile(first)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ormValid, string(data))
+	}
+	data, err = os.ReadFile(second)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ormInvalid, string(data))
+	}
+
+	code, stdout, _ = hl7(ormValid, "split", "-o", out, "-prefix", "orm")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, filepath.Join(out, "orm-0001.hl7")+"\n", stdout)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mhald/golevel7"
+)
+
+var prettyCmd = &command{
+	usage: "[-c] [file...]",
+	help:  "print the non empty fields of messages with their names",
+	run:   runPretty,
+}
+
+func runPretty(e *env, args []string) error {
+	fs := e.flags()
+	comps := fs.Bool("c", false, "print the components of fields with more than one, decoded")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	return e.scan(fs.Args(), func(file string, n int, m *golevel7.Message) error {
+		if n > 1 {
+			fmt.Fprintln(e.stdout)
+		}
+		return pretty(e.stdout, m, *comps)
+	})
+}
+
+// pretty writes the segments of m with their non empty fields, one per line
+//
+//	PID
+//	  PID.3     Patient Identifier List  1058299^^^HMRN
+//	  PID.3[2]  Patient Identifier List  555
+//
+// Fields are the NamedFields of the segment, the ones of Segment.String, written as they are
+// encoded. With comps the components of a field follow it, decoded
+func pretty(w io.Writer, m *golevel7.Message, comps bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i := range m.Segments {
+		s := &m.Segments[i]
+		fmt.Fprintln(tw, s.Name())
+		for _, f := range s.NamedFields() {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", f.Location, f.Name, string(f.Field.Value))
+			if !comps || len(f.Field.Components) < 2 || (s.Name() == "MSH" && f.Field.SeqNum <= 2) {
+				continue
+			}
+			for j, c := range f.Field.Components {
+				if len(c.Value) == 0 {
+					continue
+				}
+				v := golevel7.Unescape(string(c.Value), &m.Delimeters)
+				fmt.Fprintf(tw, "    %s.%d\t\t%s\n", f.Location, j+1, strings.ReplaceAll(v, "\n", `\n`))
+			}
+		}
+	}
+	return tw.Flush()
+}
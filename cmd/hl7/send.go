@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mhald/golevel7"
+)
+
+var sendCmd = &command{
+	usage: "[-timeout d] addr [file...]",
+	help:  "send messages over MLLP and print their acknowledgement codes and round trip times",
+	run:   runSend,
+}
+
+func runSend(e *env, args []string) error {
+	fs := e.flags()
+	timeout := fs.Duration("timeout", 10*time.Second, "time to wait for the connection and each acknowledgement")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return e.usageError(fs, "missing address to send to")
+	}
+	s := &sender{e: e, addr: fs.Arg(0), timeout: *timeout, codes: map[string]int{}}
+	defer s.close()
+	err := e.scan(fs.Args()[1:], func(file string, n int, m *golevel7.Message) error {
+		if err := e.ctx.Err(); err != nil {
+			return err
+		}
+		s.send(n, m)
+		return nil
+	})
+	s.summary()
+	if err != nil {
+		return err
+	}
+	if s.failed > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// sender sends the messages of hl7 send, one at a time over one connection
+type sender struct {
+	e       *env
+	addr    string
+	timeout time.Duration
+	client  *golevel7.MLLPClient
+
+	codes  map[string]int // acknowledgements received by code
+	errs   int            // messages without an acknowledgement
+	failed int            // messages not accepted
+	rtts   []time.Duration
+}
+
+// send sends message n and prints its acknowledgement code and round trip time
+// the connection is made again for the next message after an error
+func (s *sender) send(n int, m *golevel7.Message) {
+	controlID, _ := m.Find("MSH.10")
+	start := time.Now()
+	ack, err := s.roundTrip(m)
+	rtt := time.Since(start)
+	if err != nil {
+		s.errs++
+		s.failed++
+		s.close()
+		fmt.Fprintf(s.e.stdout, "message %d (%s): %v\n", n, controlID, err)
+		return
+	}
+	code, _ := ack.Find("MSA.1")
+	text, _ := ack.Find("MSA.3")
+	s.codes[code]++
+	s.rtts = append(s.rtts, rtt)
+	if code != golevel7.AckAccept && code != golevel7.AckCommitAccept {
+		s.failed++
+	}
+	line := fmt.Sprintf("message %d (%s): %s %v", n, controlID, code, rtt.Round(time.Microsecond))
+	if text != "" {
+		line += " " + text
+	}
+	fmt.Fprintln(s.e.stdout, line)
+}
+
+func (s *sender) roundTrip(m *golevel7.Message) (*golevel7.Message, error) {
+	if s.client == nil {
+		c, err := golevel7.DialMLLP(s.addr, s.timeout)
+		if err != nil {
+			return nil, err
+		}
+		s.client = c
+	}
+	return s.client.Send(m)
+}
+
+func (s *sender) close() {
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+}
+
+// summary prints the count of each acknowledgement code and the round trip times
+//
+//	sent 3: AA 2, AE 1, no ACK 0, round trip min 1.2ms avg 1.5ms max 2.1ms
+func (s *sender) summary() {
+	codes := make([]string, 0, len(s.codes))
+	sent := s.errs
+	for code, n := range s.codes {
+		codes = append(codes, fmt.Sprintf("%s %d", code, n))
+		sent += n
+	}
+	sort.Strings(codes)
+	codes = append(codes, fmt.Sprintf("no ACK %d", s.errs))
+	line := fmt.Sprintf("sent %d: %s", sent, strings.Join(codes, ", "))
+	if len(s.rtts) > 0 {
+		sort.Slice(s.rtts, func(i, j int) bool { return s.rtts[i] < s.rtts[j] })
+		var total time.Duration
+		for _, rtt := range s.rtts {
+			total += rtt
+		}
+		avg := total / time.Duration(len(s.rtts))
+		line += fmt.Sprintf(", round trip min %v avg %v max %v", s.rtts[0].Round(time.Microsecond),
+			avg.Round(time.Microsecond), s.rtts[len(s.rtts)-1].Round(time.Microsecond))
+	}
+	fmt.Fprintln(s.e.stdout, line)
+}
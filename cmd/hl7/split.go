@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mhald/golevel7"
+)
+
+var splitCmd = &command{
+	usage: "[-o dir] [-prefix name] [file...]",
+	help:  "write each message of a file into a file of its own",
+	run:   runSplit,
+}
+
+func runSplit(e *env, args []string) error {
+	fs := e.flags()
+	dir := fs.String("o", ".", "directory to write the messages in")
+	prefix := fs.String("prefix", "", "prefix of the file names, by default the name of the input file or message for stdin")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	return e.scan(fs.Args(), func(file string, n int, m *golevel7.Message) error {
+		name := *prefix
+		if name == "" {
+			name = "message"
+			if file != "-" {
+				name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			}
+		}
+		counts[name]++
+		out := filepath.Join(*dir, fmt.Sprintf("%s-%04d.hl7", name, counts[name]))
+		if err := os.WriteFile(out, encode(m), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, out)
+		return nil
+	})
+}
+
+// encode returns m in ER7 with its last segment terminated, as a file of its own
+func encode(m *golevel7.Message) []byte {
+	data := m.Encode()
+	if !bytes.HasSuffix(data, []byte("\r")) {
+		data = append(data, '\r')
+	}
+	return data
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mhald/golevel7"
+)
+
+var validateCmd = &command{
+	usage: "[-profile file] [-json] [file...]",
+	help:  "validate messages against a conformance profile, exits with 1 if one is invalid",
+	run:   runValidate,
+}
+
+func runValidate(e *env, args []string) error {
+	fs := e.flags()
+	profile := fs.String("profile", "", "YAML or JSON profile file, by default the profile registered for the message type and version")
+	asJSON := fs.Bool("json", false, "print the report of each message as a line of JSON")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	var p *golevel7.Profile
+	if *profile != "" {
+		var err error
+		if p, err = golevel7.LoadProfile(*profile); err != nil {
+			return err
+		}
+	}
+	invalid := 0
+	err := e.scan(fs.Args(), func(file string, n int, m *golevel7.Message) error {
+		controlID, _ := m.Find("MSH.10")
+		var report *golevel7.ValidationReport
+		if p != nil {
+			report = p.Validate(m)
+		} else {
+			var err error
+			if report, err = golevel7.ValidateMessage(m); err != nil {
+				e.errorf("%s: message %d (%s): %v", file, n, controlID, err)
+				invalid++
+				return nil
+			}
+		}
+		if !report.Valid() {
+			invalid++
+		}
+		if *asJSON {
+			return writeReportJSON(e, file, n, controlID, report)
+		}
+		status := "valid"
+		if !report.Valid() {
+			status = "invalid"
+		}
+		fmt.Fprintf(e.stdout, "%s: message %d (%s): %s\n", file, n, controlID, status)
+		for _, v := range report.Violations {
+			fmt.Fprintf(e.stdout, "  %s %v [%s]\n", v.Severity, v, v.Rule)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if invalid > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// writeReportJSON writes the report of message n of file as a line of JSON
+//
+//	{"controlId": "1", "file": "adt.hl7", "message": 1, "valid": true, "violations": []}
+func writeReportJSON(e *env, file string, n int, controlID string, report *golevel7.ValidationReport) error {
+	doc := map[string]interface{}{}
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	doc["file"] = file
+	doc["message"] = n
+	doc["controlId"] = controlID
+	return json.NewEncoder(e.stdout).Encode(doc)
+}
@@ -2,16 +2,12 @@ package commons
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"path/filepath"
-	"regexp"
-	"strings"
 )
 
-var hl7SplitToken = regexp.MustCompile("(\\r(\\n|\\x1c)+(\\n\\r)?MSH\\|\\^\\~\\\\\\&\\||$)")
-var hl7FindStartToken = regexp.MustCompile("(MSH\\|\\^\\~\\\\\\&\\||$)")
-
 const scanBufferSize = 10 * 1024 * 1024
 
 // GetHl7Files finds all hl7 files in the current directory and returns the file names as a slice of strings
@@ -34,24 +30,198 @@ func GetHl7Files() (matches []string, err error) {
 	return matches, err
 }
 
-// CrLfSplit implements a split function to deal with hl7 messages in a file, terminated by cr/lf and an optional second lf
-func crLfSplit(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if atEOF && len(data) == 0 { // end of file
-	} else {
-		loc := hl7SplitToken.FindIndex(data) // found record delimiter
-		if loc != nil || atEOF {
-			nextLoc := hl7FindStartToken.FindIndex(data[1:])
-			hl7RecPatch := []byte(strings.ReplaceAll(string(data[0:loc[0]]), "\r\n", "\r")) // cr/lf found after each segment, patch.
-			return nextLoc[0] + 1, hl7RecPatch, nil
+// ScanMessages is a bufio.SplitFunc returning one hl7 message at a time
+// A message starts with an MSH segment at the start of a line, the delimeters are read from each
+// MSH header, its encoding characters can include the v2.7 truncation character.
+// It ends at the MLLP end of block character, the next message or the end of the data.
+// Segments can be terminated by \r, \r\n or \n, they are terminated by \r in the messages returned
+// Data which is not a message, other than blank lines and MLLP framing, is returned as a token
+// of its own to be reported when it fails to parse
+func ScanMessages(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	advance, _, token, err = split(data, atEOF)
+	return advance, token, err
+}
+
+// split returns the next message or junk token of data like ScanMessages, start is the index
+// of the token in data. A nil token with a zero advance asks for more data, a nil token with
+// a non zero advance skips blank data before a message
+func split(data []byte, atEOF bool) (advance, start int, token []byte, err error) {
+	start, more := nextHeader(data, 0, atEOF)
+	switch {
+	case start < 0 && !atEOF:
+		return 0, 0, nil, nil // look again with more data
+	case start < 0:
+		start = len(data) // no message in the rest of the data
+	}
+	if isJunk(data[:start]) {
+		return start, 0, bytes.Trim(data[:start], blank), nil
+	}
+	if more || start == len(data) {
+		return start, start, nil, nil
+	}
+	end, more := nextHeader(data, start+1, atEOF)
+	if i := bytes.IndexByte(data[start:], mllpEnd); i >= 0 && (end < 0 || start+i < end) {
+		// the end of an MLLP block
+		return start + i + 1, start, terminateSegments(data[start : start+i]), nil
+	}
+	switch {
+	case more || (end < 0 && !atEOF):
+		return start, start, nil, nil // the message may not be complete yet
+	case end < 0:
+		end = len(data)
+	}
+	return end, start, terminateSegments(data[start:end]), nil
+}
+
+// mllpEnd is the MLLP end of block character
+const mllpEnd = '\x1c'
+
+// blank are the characters around messages which are not reported as junk
+const blank = "\r\n\x0b\x1c \t"
+
+// isJunk reports if data has other characters than blank ones
+func isJunk(data []byte) bool {
+	return len(bytes.Trim(data, blank)) != 0
+}
+
+// nextHeader returns the index of the first message header in data at or after from
+// more is set when data ends before a possible header can be checked and atEOF is not set
+func nextHeader(data []byte, from int, atEOF bool) (i int, more bool) {
+	for from < len(data) {
+		i := bytes.Index(data[from:], []byte("MSH"))
+		if i < 0 {
+			return -1, false
+		}
+		i += from
+		if i == 0 || isLineBreak(data[i-1]) {
+			ok, more := isHeader(data[i:])
+			if ok || (more && !atEOF) {
+				return i, more
+			}
+		}
+		from = i + 1
+	}
+	return -1, false
+}
+
+// isHeader reports if data starts with an MSH header, MSH followed by the field separator and
+// 4 or 5 distinct encoding characters, more is set when data ends before it can be decided
+func isHeader(data []byte) (ok, more bool) {
+	if len(data) < 4 {
+		return false, true
+	}
+	if !isDelimeter(data[3]) {
+		return false, false
+	}
+	for i := 4; i < len(data); i++ {
+		switch {
+		case data[i] == data[3]:
+			return i == 8 || i == 9, false
+		case i == 9 || !isDelimeter(data[i]) || bytes.IndexByte(data[3:i], data[i]) >= 0:
+			return false, false
 		}
 	}
-	return advance, token, err // no cr/lf found, either the end or get bigger data and look again
+	return false, true
+}
+
+// isDelimeter reports if ch can be a delimeter
+func isDelimeter(ch byte) bool {
+	switch {
+	case ch <= ' ' || ch >= 0x7f:
+		return false
+	case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		return false
+	}
+	return true
+}
+
+// isLineBreak reports if ch ends a line or frames an MLLP message
+func isLineBreak(ch byte) bool {
+	return ch == '\r' || ch == '\n' || ch == '\x0b' || ch == '\x1c'
+}
+
+// terminateSegments returns the message msg with its segments terminated by \r
+// \n is a segment terminator in messages without \r
+func terminateSegments(msg []byte) []byte {
+	msg = bytes.TrimRight(msg, "\r\n\x0b\x1c")
+	if bytes.IndexByte(msg, '\r') < 0 {
+		return bytes.ReplaceAll(msg, []byte("\n"), []byte("\r"))
+	}
+	return bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\r"))
 }
 
 func NewBufScanner(r io.Reader) *bufio.Scanner {
 	b := bufio.NewScanner(r)
 	buf := make([]byte, scanBufferSize)
 	b.Buffer(buf, scanBufferSize)
-	b.Split(crLfSplit)
+	b.Split(ScanMessages)
 	return b
 }
+
+// Scanner splits hl7 messages from a reader like the scanner of NewBufScanner
+// and tracks the offset and line where each message starts
+type Scanner struct {
+	*bufio.Scanner
+	raw      []byte
+	offset   int64
+	line     int
+	consumed int64 // bytes consumed by the split function
+	lines    int   // line breaks in the bytes consumed
+	cr       bool  // the bytes consumed end with \r
+}
+
+// NewScanner returns a new Scanner that reads hl7 messages from r
+func NewScanner(r io.Reader) *Scanner {
+	s := &Scanner{Scanner: bufio.NewScanner(r)}
+	buf := make([]byte, scanBufferSize)
+	s.Buffer(buf, scanBufferSize)
+	s.Split(s.split)
+	return s
+}
+
+func (s *Scanner) split(data []byte, atEOF bool) (int, []byte, error) {
+	advance, start, token, err := split(data, atEOF)
+	if token != nil {
+		s.raw = data[start:advance]
+		s.offset = s.consumed + int64(start)
+		s.line = s.lines + countLines(data[:start], s.cr) + 1
+	}
+	s.lines += countLines(data[:advance], s.cr)
+	s.consumed += int64(advance)
+	if advance > 0 {
+		s.cr = data[advance-1] == '\r'
+	}
+	return advance, token, err
+}
+
+// Offset returns the byte offset in the input of the last token
+func (s *Scanner) Offset() int64 {
+	return s.offset
+}
+
+// Line returns the line, 1 based, in the input where the last token starts
+// \r, \r\n and \n end lines
+func (s *Scanner) Line() int {
+	return s.line
+}
+
+// Raw returns the bytes of the input the last token was read from
+// The bytes are only valid until the next call to Scan
+func (s *Scanner) Raw() []byte {
+	return s.raw
+}
+
+// countLines returns the number of line breaks in data
+// cr is set if the data before ends with \r
+func countLines(data []byte, cr bool) int {
+	n := 0
+	for i, ch := range data {
+		switch {
+		case ch == '\r':
+			n++
+		case ch == '\n' && !(i == 0 && cr) && !(i > 0 && data[i-1] == '\r'):
+			n++
+		}
+	}
+	return n
+}
@@ -25,3 +25,29 @@ foreach my $file (@files) {
 
 print "}\n";
 
+print << 'END';
+
+// FieldTypes are the HL7 data types of the fields in FieldNames, the same index is the same field
+var FieldTypes = map[string][]string{
+END
+
+foreach my $file (@files) {
+	if ($file=~/^(...)\.tsv/i) {
+		print "\t\"".uc($1)."\": []string{\n";
+		print "\t\t\"\",\n";
+		open(FH,"<$file");
+		while (<FH>) {
+			my $line=$_;
+			chomp $line;
+			$line=~s/\r$//;
+			my @flds=split(/\t/,$line);
+			if ($flds[0]=~/^[0-9]*\-/) {
+				print "\t\t\"$flds[1]\",\n";
+			}
+		}
+		print "\t},\n";
+	}
+}
+
+print "}\n";
+
@@ -186,3 +186,191 @@ var FieldNames = map[string][]string{
 		"Prescription Serial Number",
 	},
 }
+
+// FieldTypes are the HL7 data types of the fields in FieldNames, the same index is the same field
+var FieldTypes = map[string][]string{
+	"DGI": []string{
+		"",
+		"SI",
+		"ID",
+		"CWE",
+	},
+	"MSH": []string{
+		"",
+		"ST",
+		"ST",
+		"HD",
+		"HD",
+		"HD",
+		"HD",
+		"DTM",
+		"ST",
+		"MSG",
+		"ST",
+		"PT",
+		"VID",
+		"NM",
+		"ST",
+		"ID",
+		"ID",
+		"ID",
+		"ID",
+		"CWE",
+		"ID",
+		"EI",
+	},
+	"NTE": []string{
+		"",
+		"SI",
+		"ID",
+		"FT",
+		"CWE",
+	},
+	"ORC": []string{
+		"",
+		"ID",
+		"EI",
+		"EI",
+		"EI",
+		"ID",
+		"ID",
+		"TQ",
+		"EIP",
+		"DTM",
+		"XCN",
+		"XCN",
+		"XCN",
+		"PL",
+		"XTN",
+		"DTM",
+		"CWE",
+		"CWE",
+		"CWE",
+		"XCN",
+		"CWE",
+		"XON",
+		"XAD",
+		"XTN",
+		"XAD",
+	},
+	"PID": []string{
+		"",
+		"SI",
+		"CX",
+		"CX",
+		"CX",
+		"XPN",
+		"XPN",
+		"DTM",
+		"IS",
+		"XPN",
+		"CWE",
+		"XAD",
+		"IS",
+		"XTN",
+		"XTN",
+		"CWE",
+		"CWE",
+		"CWE",
+		"CX",
+		"ST",
+		"DLN",
+		"CX",
+		"CWE",
+		"ST",
+		"ID",
+		"NM",
+		"CWE",
+		"CWE",
+		"CWE",
+		"DTM",
+		"ID",
+	},
+	"RXE": []string{
+		"",
+		"TQ",
+		"CWE",
+		"NM",
+		"NM",
+		"CWE",
+		"CWE",
+		"CWE",
+		"CM",
+		"ID",
+		"NM",
+		"CWE",
+		"NM",
+		"XCN",
+		"XCN",
+		"ST",
+		"NM",
+		"NM",
+		"DTM",
+		"CQ",
+		"ID",
+		"CWE",
+		"ST",
+		"ST",
+		"CWE",
+		"NM",
+		"CWE",
+		"CWE",
+		"NM",
+		"CWE",
+		"ID",
+		"CE",
+		"DTM",
+		"NM",
+		"CWE",
+		"CWE",
+		"ID",
+		"CWE",
+		"CWE",
+		"NM",
+		"CWE",
+	},
+	"RXR": []string{
+		"",
+		"CWE",
+		"CWE",
+		"CWE",
+		"CWE",
+		"CWE",
+	},
+	"TQ1": []string{
+		"",
+		"SI",
+		"CQ",
+		"RPT",
+		"TM",
+		"CQ",
+		"CQ",
+		"DTM",
+		"DTM",
+		"CWE",
+		"TX",
+		"TX",
+		"ID",
+		"CQ",
+		"NM",
+	},
+	"ZWA": []string{
+		"",
+		"",
+		"DTM",
+		"DTM",
+		"",
+		"DTM",
+		"DTM",
+		"ST",
+		"",
+		"",
+		"NM",
+		"ST",
+		"ST",
+		"ST",
+		"ST",
+		"",
+		"ST",
+	},
+}
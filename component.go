@@ -45,13 +45,22 @@ func (c *Component) parse(seps *Delimeters) error {
 			scmp := SubComponent{Value: c.Value[i : ii-1]}
 			c.SubComponents = append(c.SubComponents, scmp)
 			i = ii
-		case ch == seps.Escape:
-			ii++
-			r.ReadRune()
 		}
 	}
 }
 
+// clone returns a deep copy of the component
+func (c *Component) clone() Component {
+	cc := Component{Value: cloneRunes(c.Value)}
+	if c.SubComponents != nil {
+		cc.SubComponents = make([]SubComponent, len(c.SubComponents))
+		for i := range c.SubComponents {
+			cc.SubComponents[i] = SubComponent{Value: cloneRunes(c.SubComponents[i].Value)}
+		}
+	}
+	return cc
+}
+
 // SubComponent returns the subcomponent i
 func (c *Component) SubComponent(i int) (*SubComponent, error) {
 	if i > len(c.SubComponents) || i < 1 {
@@ -93,10 +102,13 @@ func (c *Component) getObject(l *Location) (ValueGetter, error) {
 
 // Set will insert a value into a message at Location
 func (c *Component) Set(l *Location, val string, seps *Delimeters) error {
-	subloc := l.SubComp
-	if subloc < 0 {
-		subloc = 0
+	if l.SubComp < 0 {
+		// the whole component is replaced, subcomponents are parsed from val
+		c.Value = []rune(val)
+		c.SubComponents = nil
+		return c.parse(seps)
 	}
+	subloc := l.SubComp
 	if x := subloc - len(c.SubComponents) + 1; x > 0 {
 		c.SubComponents = append(c.SubComponents, make([]SubComponent, x)...)
 	}
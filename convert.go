@@ -0,0 +1,213 @@
+package golevel7
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnmarshalTypeError describes an HL7 value that could not be converted
+// to the type of the struct field it was unmarshaled into
+type UnmarshalTypeError struct {
+	Tag   string       // hl7 tag of the struct field
+	Value string       // HL7 value
+	Type  reflect.Type // type of the struct field
+	Err   error        // conversion error
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("hl7: cannot unmarshal %q at %s into value of type %v: %v", e.Value, e.Tag, e.Type, e.Err)
+}
+
+// Unwrap returns the conversion error
+func (e *UnmarshalTypeError) Unwrap() error {
+	return e.Err
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// isScalar reports if t can be set from a single HL7 value
+// strings, integers, floats, bools, time.Time and pointers to them
+func isScalar(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isScalarSlice reports if t is a slice of scalar values
+func isScalarSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && isScalar(t.Elem())
+}
+
+// setValue converts the HL7 value val found at tag into the type of v and sets it
+// Empty values leave v untouched, pointers are only allocated for non empty values
+func setValue(v reflect.Value, tag, val string) error {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setValue(ptr.Elem(), tag, val); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+	typeErr := func(err error) error {
+		return &UnmarshalTypeError{Tag: tag, Value: val, Type: v.Type(), Err: err}
+	}
+	if v.Type() == timeType {
+		t, err := ParseTime(val)
+		if err != nil {
+			return typeErr(err)
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := parseBool(val)
+		if err != nil {
+			return typeErr(err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return typeErr(err)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return typeErr(err)
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return typeErr(err)
+		}
+		v.SetFloat(f)
+	default:
+		return typeErr(fmt.Errorf("unsupported type"))
+	}
+	return nil
+}
+
+// setValues sets the slice v to the converted HL7 values vals
+func setValues(v reflect.Value, tag string, vals []string) error {
+	slice := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+	for idx := range vals {
+		if v.Type().Elem().Kind() == reflect.String {
+			// keep empty values as the string slices always did
+			slice.Index(idx).SetString(strings.TrimSpace(vals[idx]))
+			continue
+		}
+		if err := setValue(slice.Index(idx), tag, vals[idx]); err != nil {
+			return err
+		}
+	}
+	v.Set(slice)
+	return nil
+}
+
+// parseBool parses the HL7 yes / no indicators Y and N as well as
+// the values accepted by strconv.ParseBool
+func parseBool(val string) (bool, error) {
+	switch strings.ToUpper(val) {
+	case "Y", "YES":
+		return true, nil
+	case "N", "NO":
+		return false, nil
+	}
+	return strconv.ParseBool(val)
+}
+
+// ParseTime parses an HL7 TS / DTM value with variable precision
+//
+//	YYYY[MM[DD[HH[MM[SS[.S[S[S[S]]]]]]]]][+/-ZZZZ]
+//
+// Values without an offset are returned in UTC
+func ParseTime(val string) (time.Time, error) {
+	v := strings.TrimSpace(val)
+	loc := time.UTC
+	if i := strings.IndexAny(v, "+-"); i >= 0 {
+		zone := v[i:]
+		v = v[:i]
+		if len(zone) != 5 {
+			return time.Time{}, fmt.Errorf("invalid time zone offset %q", zone)
+		}
+		hh, err1 := strconv.Atoi(zone[1:3])
+		mm, err2 := strconv.Atoi(zone[3:5])
+		if err1 != nil || err2 != nil || hh > 23 || mm > 59 {
+			return time.Time{}, fmt.Errorf("invalid time zone offset %q", zone)
+		}
+		offset := hh*3600 + mm*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	frac := ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		frac = v[i+1:]
+		v = v[:i]
+		if len(v) != 14 || frac == "" || len(frac) > 9 {
+			return time.Time{}, fmt.Errorf("invalid fractional seconds in %q", val)
+		}
+	}
+	layouts := map[int]string{
+		4:  "2006",
+		6:  "200601",
+		8:  "20060102",
+		10: "2006010215",
+		12: "200601021504",
+		14: "20060102150405",
+	}
+	layout, ok := layouts[len(v)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time %q", val)
+	}
+	t, err := time.ParseInLocation(layout, v, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", val)
+	}
+	if frac != "" {
+		ns, err := strconv.Atoi((frac + "000000000")[:9])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid fractional seconds in %q", val)
+		}
+		t = t.Add(time.Duration(ns))
+	}
+	return t, nil
+}
+
+// FormatTime formats t as an HL7 TS / DTM value with second precision,
+// fractional seconds are added when present and the offset when t is not in UTC
+func FormatTime(t time.Time) string {
+	layout := "20060102150405"
+	if t.Nanosecond() != 0 {
+		layout += ".999999999"
+	}
+	if t.Location() != time.UTC {
+		layout += "-0700"
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,184 @@
+package golevel7
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTime(t *testing.T) {
+	est := time.FixedZone("", -5*3600)
+	tests := map[string]time.Time{
+		"2006":                     time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC),
+		"200603":                   time.Date(2006, 3, 1, 0, 0, 0, 0, time.UTC),
+		"20060307":                 time.Date(2006, 3, 7, 0, 0, 0, 0, time.UTC),
+		"2006030711":               time.Date(2006, 3, 7, 11, 0, 0, 0, time.UTC),
+		"200603071101":             time.Date(2006, 3, 7, 11, 1, 0, 0, time.UTC),
+		"20060307110114":           time.Date(2006, 3, 7, 11, 1, 14, 0, time.UTC),
+		"20060307110114.25":        time.Date(2006, 3, 7, 11, 1, 14, 250000000, time.UTC),
+		"20060307110114.1234-0500": time.Date(2006, 3, 7, 11, 1, 14, 123400000, est),
+		"200603071101-0500":        time.Date(2006, 3, 7, 11, 1, 0, 0, est),
+	}
+	for in, want := range tests {
+		got, err := ParseTime(in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: expected %v got %v", in, want, got)
+		}
+	}
+
+	for _, in := range []string{"", "20", "2006030", "20061307", "2006030711011", "20060307.5", "20060307110114.", "2006-05", "20060307+5"} {
+		if _, err := ParseTime(in); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+}
+
+type typedObservation struct {
+	SetID     int      `hl7:"OBX.1"`
+	ValueType string   `hl7:"OBX.2"`
+	Value     float64  `hl7:"OBX.5"`
+	Units     *string  `hl7:"OBX.6"`
+	SubID     *string  `hl7:"OBX.4"`
+	Sequence  *int     `hl7:"OBX.4"`
+	Flags     []string `hl7:"OBX.8"`
+}
+
+type typedMsg struct {
+	MsgDate      time.Time          `hl7:"MSH.7"`
+	MsgDatePtr   *time.Time         `hl7:"MSH.7"`
+	NoDate       *time.Time         `hl7:"MSH.8"`
+	SetIDs       []int              `hl7:"OBX.1"`
+	Observations []typedObservation `hl7:"OBX"`
+}
+
+func TestTypedUnmarshal(t *testing.T) {
+	data := "MSH|^~\\&|A|B|C|D|20070910144846||ORU^R01|1|P|2.3|\r" +
+		"OBX|1|NM|13457-7^LDL (CALCULATED)^LOINC||49.000|MG/DL|0.000 - 100.000|N|||F|\r" +
+		"OBX|2|NM|2093-3^CHOLESTEROL^LOINC||138.5|||L|||F|"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := typedMsg{}
+	if err := msg.Unmarshal(&st); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2007, 9, 10, 14, 48, 46, 0, time.UTC)
+	assert.True(t, want.Equal(st.MsgDate))
+	if assert.NotNil(t, st.MsgDatePtr) {
+		assert.True(t, want.Equal(*st.MsgDatePtr))
+	}
+	assert.Nil(t, st.NoDate)
+	assert.Equal(t, []int{1, 2}, st.SetIDs)
+	if assert.Equal(t, 2, len(st.Observations)) {
+		obx := st.Observations[0]
+		assert.Equal(t, 1, obx.SetID)
+		assert.Equal(t, 49.0, obx.Value)
+		if assert.NotNil(t, obx.Units) {
+			assert.Equal(t, "MG/DL", *obx.Units)
+		}
+		assert.Nil(t, obx.SubID)
+		assert.Nil(t, obx.Sequence)
+		assert.Equal(t, []string{"N"}, obx.Flags)
+
+		obx = st.Observations[1]
+		assert.Equal(t, 2, obx.SetID)
+		assert.Equal(t, 138.5, obx.Value)
+		assert.Nil(t, obx.Units)
+		assert.Equal(t, []string{"L"}, obx.Flags)
+	}
+}
+
+func TestTypedUnmarshalError(t *testing.T) {
+	data := "MSH|^~\\&|A|B|C|D|2007091014484648||ORU^R01|1|P|2.3|\r" +
+		"PID|1||12001||Jones^John||19670824|M"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := struct {
+		MsgDate time.Time `hl7:"MSH.7"`
+	}{}
+	err = msg.Unmarshal(&st)
+	var terr *UnmarshalTypeError
+	if !errors.As(err, &terr) {
+		t.Fatalf("Expected *UnmarshalTypeError got %v", err)
+	}
+	assert.Equal(t, "MSH.7", terr.Tag)
+	assert.Equal(t, "2007091014484648", terr.Value)
+	assert.Contains(t, err.Error(), "MSH.7")
+	assert.Contains(t, err.Error(), "2007091014484648")
+
+	seg, err := msg.Segment("PID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := struct {
+		SetID uint      `hl7:"PID.1"`
+		DOB   time.Time `hl7:"PID.7"`
+		Male  bool      `hl7:"PID.8"`
+	}{}
+	err = seg.Unmarshal(&pid)
+	if !errors.As(err, &terr) || terr.Tag != "PID.8" {
+		t.Fatalf("Expected *UnmarshalTypeError for PID.8 got %v", err)
+	}
+	assert.Equal(t, uint(1), pid.SetID)
+	assert.True(t, time.Date(1967, 8, 24, 0, 0, 0, 0, time.UTC).Equal(pid.DOB))
+
+	flags := struct {
+		Yes  bool  `hl7:"ZZZ.1"`
+		No   bool  `hl7:"ZZZ.2"`
+		Ptr  *bool `hl7:"ZZZ.3"`
+		None *bool `hl7:"ZZZ.4"`
+	}{}
+	msg, err = ParseMessage([]byte("MSH|^~\\&|A\rZZZ|Y|N|true|"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := msg.Unmarshal(&flags); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, flags.Yes)
+	assert.False(t, flags.No)
+	if assert.NotNil(t, flags.Ptr) {
+		assert.True(t, *flags.Ptr)
+	}
+	assert.Nil(t, flags.None)
+}
+
+func TestSegmentUnmarshalUnescape(t *testing.T) {
+	// delimeters other than the default ones
+	msg, err := ParseMessage([]byte("MSH#$%!&#A\rPID#1##A!F!B$C!T!D%E!R!F##J!S!R\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seg, err := msg.Segment("PID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := struct {
+		ID   string   `hl7:"PID.3"`
+		IDs  []string `hl7:"PID.3"`
+		Name string   `hl7:"PID.5"`
+	}{}
+	if err := seg.Unmarshal(&pid); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "A#B$C&D", pid.ID)
+	assert.Equal(t, []string{"A#B$C&D", "E%F"}, pid.IDs)
+	assert.Equal(t, "J$R", pid.Name)
+
+	// the same values as Message.Unmarshal
+	msgPID := pid
+	if err := msg.Unmarshal(&msgPID); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pid, msgPID)
+}
@@ -0,0 +1,56 @@
+package golevel7
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	numericRe  = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)$`)
+	seqIDRe    = regexp.MustCompile(`^[0-9]+$`)
+	timeOnlyRe = regexp.MustCompile(`^([01][0-9]|2[0-3])([0-5][0-9]([0-5][0-9](\.[0-9]{1,4})?)?)?([+-][0-9]{4})?$`)
+)
+
+// CheckDataType checks that v, a decoded value, conforms to the HL7 data type dt
+// NM numeric, SI sequence id, DT date, TM time, DTM and TS date / time are checked
+// ID and IS codes must not contain spaces, other data types are not checked
+// Empty values conform to every data type
+func CheckDataType(dt, v string) error {
+	if v == "" {
+		return nil
+	}
+	switch strings.ToUpper(dt) {
+	case "NM":
+		if !numericRe.MatchString(v) {
+			return fmt.Errorf("%q is not a number", v)
+		}
+	case "SI":
+		if !seqIDRe.MatchString(v) {
+			return fmt.Errorf("%q is not a sequence id", v)
+		}
+	case "DT":
+		layouts := map[int]string{4: "2006", 6: "200601", 8: "20060102"}
+		layout, ok := layouts[len(v)]
+		if !ok {
+			return fmt.Errorf("%q is not a date", v)
+		}
+		if _, err := time.Parse(layout, v); err != nil {
+			return fmt.Errorf("%q is not a date", v)
+		}
+	case "TM":
+		if !timeOnlyRe.MatchString(v) {
+			return fmt.Errorf("%q is not a time", v)
+		}
+	case "DTM", "TS":
+		if _, err := ParseTime(v); err != nil {
+			return err
+		}
+	case "ID", "IS":
+		if strings.ContainsAny(v, " \t") {
+			return fmt.Errorf("%q is not a coded value", v)
+		}
+	}
+	return nil
+}
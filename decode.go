@@ -1,55 +1,150 @@
 package golevel7
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"io"
-	//"log"
+	"os"
+	"time"
+
+	"github.com/mhald/golevel7/commons"
 )
 
+// ErrMessageTooLarge is returned by Decoder.Decode for a message larger than MaxMessageSize
+var ErrMessageTooLarge = errors.New("hl7: message too large")
+
 // Decoder reades hl7 messages from a stream
 type Decoder struct {
-	r io.Reader
+	MaxMessageSize int // largest message accepted in bytes, 0 means 10MB
+
+	r     io.Reader
+	buf   []byte
+	start int // start of the data not decoded yet in buf
+	eof   bool
+	count int
+	err   error
 }
 
 // NewDecoder returns a new Decoder that reades from from stream r
-// Assumes one message per stream
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{r: r}
 }
 
 const bufCap = 1024 * 100
 
-func readBuf(reader io.Reader) ([]byte, error) {
-	r := bufio.NewReader(reader)
-	superBuf := []byte{}
-	var err error
+// deadlineReader is a reader with a read deadline like net.Conn
+type deadlineReader interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// Decode reads the next message from the stream, one message at a time
+// Messages can be MLLP framed, separated by line breaks or follow each other, see
+// NewMessageScanner. Without MLLP framing a message ends with the next MSH segment or the stream
+//
+// It returns io.EOF at the end of the stream, a *ParseError for a message which can not be
+// parsed and ErrMessageTooLarge for a message larger than MaxMessageSize. Decode can be
+// called again after a *ParseError or an error caused by ctx
+//
+// The deadline of ctx is the read deadline of readers with a SetReadDeadline method, like
+// net.Conn, their reads are interrupted when ctx is canceled. Other readers check ctx between reads
+func (d *Decoder) Decode(ctx context.Context) (*Message, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if dr, ok := d.r.(deadlineReader); ok {
+		t, _ := ctx.Deadline()
+		dr.SetReadDeadline(t)
+		done := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			dr.SetReadDeadline(time.Unix(1, 0))
+			close(done)
+		})
+		defer func() {
+			if !stop() {
+				<-done
+			}
+			dr.SetReadDeadline(time.Time{})
+		}()
+	}
+	max := d.MaxMessageSize
+	if max <= 0 {
+		max = scanBufferSize
+	}
 	for {
-		buf := make([]byte, 0, bufCap)
-		n, err := r.Read(buf[:cap(buf)])
-		buf = buf[:n]
-		quit := false
-		switch {
-		case err == io.EOF:
-			//log.Printf("->err == io.EOF")
-			superBuf = append(superBuf, buf...)
-			quit = true
-		case n < bufCap:
-			//log.Printf("->n < bufCap")
-			superBuf = append(superBuf, buf...)
-			//quit = true
-		case err != nil:
-			//log.Printf("->err != nil")
-			superBuf = nil
-		default:
-			//log.Printf("->default")
-			superBuf = append(superBuf, buf...)
+		if d.start < len(d.buf) || d.eof {
+			advance, token, _ := commons.ScanMessages(d.buf[d.start:], d.eof)
+			d.start += advance
+			if token != nil {
+				return d.parse(token)
+			}
+			if advance > 0 {
+				continue
+			}
+			if d.eof {
+				return nil, io.EOF
+			}
 		}
-		if quit {
-			break
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(d.buf)-d.start >= max {
+			d.err = ErrMessageTooLarge
+			return nil, d.err
+		}
+		if err := d.read(max); err != nil {
+			// the read deadline can pass just before ctx is done
+			if _, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) {
+				<-ctx.Done()
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+	}
+}
+
+// read reads more data into buf
+func (d *Decoder) read(max int) error {
+	if d.start > 0 {
+		n := copy(d.buf, d.buf[d.start:])
+		d.buf = d.buf[:n]
+		d.start = 0
+	}
+	if len(d.buf) == cap(d.buf) {
+		size := 2 * cap(d.buf)
+		if size < bufCap {
+			size = bufCap
 		}
+		if size > max+1 {
+			size = max + 1
+		}
+		d.buf = append(make([]byte, 0, size), d.buf...)
+	}
+	n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+	d.buf = d.buf[:len(d.buf)+n]
+	if err == io.EOF {
+		d.eof = true
+		return nil
+	}
+	return err
+}
+
+// parse parses the message token
+func (d *Decoder) parse(token []byte) (*Message, error) {
+	index := d.count
+	d.count++
+	msg, err := ParseMessage(token)
+	if err != nil {
+		perr, ok := err.(*ParseError)
+		if !ok {
+			perr = &ParseError{Segment: -1, FieldSeq: -1, Err: err}
+		}
+		perr.MsgIndex = index
+		return nil, perr
 	}
-	return superBuf, err
+	return msg, nil
 }
 
 // Split will split a set of HL7 messages
@@ -69,16 +164,27 @@ func Split(buf []byte) [][]byte {
 }
 
 // Messages returns a new Message slice parsed from stream r
+// Messages that fail to parse are left out of the slice and reported
+// in the returned error which will be of type ParseErrors
 func (d *Decoder) Messages() ([]*Message, error) {
-	buf, err := readBuf(d.r)
-	if err != nil {
-		return nil, err
-	}
-	bufs := Split(buf)
 	z := []*Message{}
-	for _, buf := range bufs {
-		msg := NewMessage(buf)
+	perrs := ParseErrors{}
+	for {
+		msg, err := d.Decode(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if perr, ok := err.(*ParseError); ok {
+			perrs = append(perrs, perr)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
 		z = append(z, msg)
 	}
+	if len(perrs) != 0 {
+		return z, perrs
+	}
 	return z, nil
 }
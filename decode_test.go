@@ -1,8 +1,13 @@
 package golevel7
 
 import (
+	"context"
+	"io"
+	"net"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 type my7 struct {
@@ -36,3 +41,118 @@ func TestDecode(t *testing.T) {
 		t.Errorf("Expected Jones got %s\n", st.LastName)
 	}
 }
+
+func TestDecodeParseErrors(t *testing.T) {
+	data := "\x0bMSH|^~\\&|A|B\rPID|||1\x1c\x0d" +
+		"\x0bMSH|^~\\&|A|B\rbad|||2\x1c\x0d" +
+		"\x0bMSH|^~\\&|A|B\rPID|||3\x1c\x0d"
+	msgs, err := NewDecoder(strings.NewReader(data)).Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 messages got %v\n", len(msgs))
+	}
+	perrs, ok := err.(ParseErrors)
+	if !ok {
+		t.Fatalf("Expected ParseErrors got %T", err)
+	}
+	if len(perrs) != 1 {
+		t.Fatalf("Expected 1 error got %d", len(perrs))
+	}
+	if perrs[0].MsgIndex != 1 || perrs[0].Segment != 1 || perrs[0].SegmentName != "bad" {
+		t.Errorf("Unexpected parse error %+v", perrs[0])
+	}
+}
+
+func TestDecoderDecodeStream(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	dec := NewDecoder(server)
+	for i, id := range []string{"1", "2"} {
+		go WriteMLLP(client, []byte("MSH|^~\\&|A|B|||||ADT^A01|"+id+"|P|2.5\rPID|||"+id))
+		// each message is returned when its frame ends, before the next one is sent
+		msg, err := dec.Decode(context.Background())
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if v, _ := msg.Find("MSH.10"); v != id {
+			t.Errorf("Expected %s got %s", id, v)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := dec.Decode(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded got %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := dec.Decode(ctx); err != context.Canceled {
+		t.Errorf("Expected canceled got %v", err)
+	}
+
+	// the decoder is usable after a context error
+	go func() {
+		WriteMLLP(client, []byte("MSH|^~\\&|A|B|||||ADT^A01|3|P|2.5"))
+		client.Close()
+	}()
+	msg, err := dec.Decode(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := msg.Find("MSH.10"); v != "3" {
+		t.Errorf("Expected 3 got %s", v)
+	}
+	if _, err := dec.Decode(context.Background()); err != io.EOF {
+		t.Errorf("Expected EOF got %v", err)
+	}
+}
+
+func TestDecoderDecodeSeparators(t *testing.T) {
+	for name, data := range map[string]string{
+		"newline":      "MSH|^~\\&|A|B|||||ADT^A01|1\nPID|||1\n\nMSH|^~\\&|A|B|||||ADT^A01|2\nPID|||2\n",
+		"concatenated": "MSH|^~\\&|A|B|||||ADT^A01|1\rPID|||1\rMSH|^~\\&|A|B|||||ADT^A01|2\rPID|||2",
+		"mllp":         "\x0bMSH|^~\\&|A|B|||||ADT^A01|1\rPID|||1\x1c\r\x0bMSH|^~\\&|A|B|||||ADT^A01|2\rPID|||2\x1c\r",
+	} {
+		dec := NewDecoder(strings.NewReader(data))
+		for _, id := range []string{"1", "2"} {
+			msg, err := dec.Decode(context.Background())
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if v, _ := msg.Find("PID.3"); v != id {
+				t.Errorf("%s: Expected %s got %s", name, id, v)
+			}
+			if len(msg.Segments) != 2 {
+				t.Errorf("%s: Expected 2 segments got %d", name, len(msg.Segments))
+			}
+		}
+		if _, err := dec.Decode(context.Background()); err != io.EOF {
+			t.Errorf("%s: Expected EOF got %v", name, err)
+		}
+	}
+}
+
+func TestDecoderDecodeErrors(t *testing.T) {
+	data := "MSH|^~\\&|A|B\rbad|||1\rMSH|^~\\&|A|B\rPID|||2"
+	dec := NewDecoder(strings.NewReader(data))
+	_, err := dec.Decode(context.Background())
+	if perr, ok := err.(*ParseError); !ok || perr.MsgIndex != 0 {
+		t.Fatalf("Expected *ParseError for message 0 got %v", err)
+	}
+	msg, err := dec.Decode(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := msg.Find("PID.3"); v != "2" {
+		t.Errorf("Expected 2 got %s", v)
+	}
+
+	dec = NewDecoder(strings.NewReader("MSH|^~\\&|A|B\rNTE|||" + strings.Repeat("x", 1000) + "\rMSH|^~\\&|A|B"))
+	dec.MaxMessageSize = 512
+	if _, err := dec.Decode(context.Background()); err != ErrMessageTooLarge {
+		t.Errorf("Expected ErrMessageTooLarge got %v", err)
+	}
+	if _, err := dec.Decode(context.Background()); err != ErrMessageTooLarge {
+		t.Errorf("Expected ErrMessageTooLarge to be sticky got %v", err)
+	}
+}
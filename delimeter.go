@@ -1,5 +1,11 @@
 package golevel7
 
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
 const eof = rune(0)
 const endMsg = '\x0A'
 const segTerm = '\x0D'
@@ -28,3 +34,111 @@ func NewDelimeters() *Delimeters {
 		Truncate:       '#',
 	}
 }
+
+// encodingChars returns the encoding characters of MSH.2
+// DelimeterField when set, otherwise component, repetition, escape and subcomponent
+func (d *Delimeters) encodingChars() string {
+	if d.DelimeterField != "" {
+		return d.DelimeterField
+	}
+	return string([]rune{d.Component, d.Repetition, d.Escape, d.SubComponent})
+}
+
+// validate checks that the delimeters can be used to build a message
+// they have to be valid delimeter characters and distinct from each other
+func (d *Delimeters) validate() error {
+	chars := []rune{d.Field, d.Component, d.Repetition, d.Escape, d.SubComponent}
+	for i, ch := range chars {
+		if !isDelimeter(ch) {
+			return fmt.Errorf("Invalid delimeter %q", ch)
+		}
+		for _, other := range chars[:i] {
+			if ch == other {
+				return fmt.Errorf("Delimeter %q is used twice", ch)
+			}
+		}
+	}
+	enc := []rune(d.encodingChars())
+	if len(enc) < 4 || string(enc[:4]) != string(chars[1:]) {
+		return fmt.Errorf("DelimeterField %q does not match the delimeters", d.DelimeterField)
+	}
+	return nil
+}
+
+// isDelimeter reports if ch can be used as a delimeter
+// letters, digits and the segment terminator are not allowed
+func isDelimeter(ch rune) bool {
+	switch {
+	case ch == segTerm || ch == endMsg || ch == eof:
+		return false
+	case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		return false
+	}
+	return true
+}
+
+// isSegmentName reports if name is a valid three character segment name
+func isSegmentName(name []rune) bool {
+	if len(name) != 3 {
+		return false
+	}
+	for _, ch := range name {
+		if !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDelimeters reads the delimeters from MSH.1 and MSH.2 at the start of v
+// MSH.2 has 4 encoding characters or 5 with the truncation character
+func parseDelimeters(v []byte) (Delimeters, error) {
+	d := Delimeters{}
+	if len(v) < 8 {
+		return d, newParseError(len(v), 0, "", -1, "Invalid message length less than 8 bytes")
+	}
+	if string(v[:3]) != "MSH" {
+		return d, newParseError(0, 0, string(v[:3]), 0, "Invalid message: Missing MSH segment -> %q", string(v[:3]))
+	}
+	off := 3
+	for i := 3; i < 8; i++ {
+		ch, size := utf8.DecodeRune(v[off:])
+		if size == 0 || ch == eof {
+			return d, newParseError(i, 0, "MSH", -1, "Invalid message: eof while parsing MSH")
+		}
+		off += size
+		if !isDelimeter(ch) {
+			if i == 3 {
+				return d, newParseError(i, 0, "MSH", 1, "Invalid field separator %q", ch)
+			}
+			return d, newParseError(i, 0, "MSH", 2, "Invalid encoding character %q", ch)
+		}
+		if i > 3 && ch == d.Field {
+			return d, newParseError(i, 0, "MSH", 2, "Invalid message: field separator %q used as encoding character", ch)
+		}
+		switch i {
+		case 3:
+			d.Field = ch
+		case 4:
+			d.Component = ch
+		case 5:
+			d.Repetition = ch
+		case 6:
+			d.Escape = ch
+		case 7:
+			d.SubComponent = ch
+		}
+	}
+	// v2.7 adds the truncation character to the encoding characters
+	if ch, size := utf8.DecodeRune(v[off:]); size != 0 && ch != d.Field && isDelimeter(ch) &&
+		!strings.ContainsRune(string(v[4:off]), ch) {
+		d.Truncate = ch
+		off += size
+	}
+	if enc := v[4:off]; string(enc) == "^~\\&" {
+		d.DelimeterField = "^~\\&" // the usual encoding characters, without allocating
+	} else {
+		d.DelimeterField = string(enc)
+	}
+	return d, nil
+}
@@ -0,0 +1,270 @@
+package golevel7
+
+import (
+	"errors"
+	"fmt"
+)
+
+// segmentIndexes returns the indexes in m.Segments of the segments matched by the Location
+// all occurrences unless the location specifies one
+func (m *Message) segmentIndexes(l *Location) []int {
+	idx := []int{}
+	n := 0
+	for i := range m.Segments {
+		if m.Segments[i].Name() != l.Segment {
+			continue
+		}
+		n++
+		if l.SegIdx == 0 || l.SegIdx == n {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// segmentIndex returns the index in m.Segments of the segment occurrence at Location
+// the first occurrence unless the location specifies one
+func (m *Message) segmentIndex(l *Location) (int, error) {
+	if l.Segment == "" {
+		return -1, errors.New("Segment is required")
+	}
+	idx := m.segmentIndexes(l)
+	if len(idx) == 0 {
+		return -1, fmt.Errorf("Segment %v not found", l)
+	}
+	return idx[0], nil
+}
+
+// parseNewSegment parses v, a segment encoded with the delimeters of m
+func (m *Message) parseNewSegment(v string) (Segment, error) {
+	seg := Segment{Value: []rune(v)}
+	if err := seg.parse(&m.Delimeters); err != nil {
+		return Segment{}, err
+	}
+	return seg, nil
+}
+
+// insertSegment inserts seg at index i of m.Segments
+func (m *Message) insertSegment(i int, seg Segment) {
+	m.Segments = append(m.Segments, Segment{})
+	copy(m.Segments[i+1:], m.Segments[i:])
+	m.Segments[i] = seg
+}
+
+// InsertSegmentAfter parses v, a segment encoded with the delimeters of the message,
+// and inserts it after the segment occurrence at Location, the first one unless specified
+// Segment pointers obtained from the message before the call are no longer valid
+func (m *Message) InsertSegmentAfter(l *Location, v string) error {
+	i, err := m.segmentIndex(l)
+	if err != nil {
+		return err
+	}
+	seg, err := m.parseNewSegment(v)
+	if err != nil {
+		return err
+	}
+	m.insertSegment(i+1, seg)
+	m.Value = m.encode()
+	return nil
+}
+
+// InsertSegmentBefore is like InsertSegmentAfter but inserts the segment before the
+// segment occurrence at Location
+func (m *Message) InsertSegmentBefore(l *Location, v string) error {
+	i, err := m.segmentIndex(l)
+	if err != nil {
+		return err
+	}
+	seg, err := m.parseNewSegment(v)
+	if err != nil {
+		return err
+	}
+	m.insertSegment(i, seg)
+	m.Value = m.encode()
+	return nil
+}
+
+// DeleteSegments deletes the segments matched by the Location, all occurrences unless
+// the location specifies one, and returns the number of segments deleted
+//
+//	msg.DeleteSegments(NewLocation("ZXX")) // strips all ZXX segments
+func (m *Message) DeleteSegments(l *Location) int {
+	idx := m.segmentIndexes(l)
+	for j := len(idx) - 1; j >= 0; j-- {
+		m.Segments = append(m.Segments[:idx[j]], m.Segments[idx[j]+1:]...)
+	}
+	if len(idx) != 0 {
+		m.Value = m.encode()
+	}
+	return len(idx)
+}
+
+// MoveSegmentAfter moves the segment occurrence at l after the segment occurrence at to
+// occurrences are the first ones unless specified
+func (m *Message) MoveSegmentAfter(l, to *Location) error {
+	return m.moveSegment(l, to, 1)
+}
+
+// MoveSegmentBefore moves the segment occurrence at l before the segment occurrence at to
+// occurrences are the first ones unless specified
+func (m *Message) MoveSegmentBefore(l, to *Location) error {
+	return m.moveSegment(l, to, 0)
+}
+
+// moveSegment moves the segment at l to the index of the segment at to plus offset
+func (m *Message) moveSegment(l, to *Location, offset int) error {
+	from, err := m.segmentIndex(l)
+	if err != nil {
+		return err
+	}
+	i, err := m.segmentIndex(to)
+	if err != nil {
+		return err
+	}
+	if from == i {
+		return nil
+	}
+	seg := m.Segments[from]
+	m.Segments = append(m.Segments[:from], m.Segments[from+1:]...)
+	if i > from {
+		i--
+	}
+	m.insertSegment(i+offset, seg)
+	m.Value = m.encode()
+	return nil
+}
+
+// AddRepetition appends a repetition of the field at Location with the value val
+// val is escaped as by Set, an empty field gets val as its first repetition
+// The segment occurrence is the first one unless specified, it is appended if missing
+func (m *Message) AddRepetition(l *Location, val string) error {
+	if l.FieldSeq < 1 {
+		return errors.New("Field is required")
+	}
+	if isDelimeterField(l) {
+		return fmt.Errorf("%v can not repeat", l)
+	}
+	rl := *l
+	rl.FieldRep = 1
+	if seg, err := m.segmentAt(l.Segment, l.SegIdx); err == nil {
+		flds, _ := seg.AllFields(l.FieldSeq)
+		if len(flds) > 1 || (len(flds) == 1 && len(flds[0].Value) != 0) {
+			rl.FieldRep = len(flds) + 1
+		}
+	}
+	return m.Set(&rl, val)
+}
+
+// RemoveRepetition removes the repetition of the field at Location
+// The location has to specify the repetition, removing the only one clears the field
+func (m *Message) RemoveRepetition(l *Location) error {
+	if l.FieldRep < 1 {
+		return errors.New("Repetition is required")
+	}
+	if isDelimeterField(l) {
+		return fmt.Errorf("%v can not be removed", l)
+	}
+	seg, err := m.segmentAt(l.Segment, l.SegIdx)
+	if err != nil {
+		return err
+	}
+	if err := seg.removeRepetition(l.FieldSeq, l.FieldRep, &m.Delimeters); err != nil {
+		return err
+	}
+	m.Value = m.encode()
+	return nil
+}
+
+// ClearField empties the field at Location and removes its repetitions
+// if the location specifies a repetition only that one is emptied
+func (m *Message) ClearField(l *Location) error {
+	if l.FieldSeq < 1 {
+		return errors.New("Field is required")
+	}
+	if isDelimeterField(l) {
+		return fmt.Errorf("%v can not be cleared", l)
+	}
+	seg, err := m.segmentAt(l.Segment, l.SegIdx)
+	if err != nil {
+		return err
+	}
+	seg.clearField(l.FieldSeq, l.FieldRep, &m.Delimeters)
+	m.Value = m.encode()
+	return nil
+}
+
+// TruncateEmptyFields removes the trailing empty fields of every segment
+// "PID|1||12001|||" becomes "PID|1||12001"
+func (m *Message) TruncateEmptyFields() {
+	for i := range m.Segments {
+		m.Segments[i].truncate(&m.Delimeters)
+	}
+	m.Value = m.encode()
+}
+
+// removeRepetition removes repetition n (1 based) of the field with sequence number i
+func (s *Segment) removeRepetition(i, n int, seps *Delimeters) error {
+	flds, _ := s.AllFields(i)
+	if n > len(flds) {
+		return fmt.Errorf("Field %d[%d] not found", i, n)
+	}
+	if len(flds) == 1 {
+		s.clearField(i, 0, seps)
+		return nil
+	}
+	rep := 0
+	for idx := range s.Fields {
+		if s.Fields[idx].SeqNum != i {
+			continue
+		}
+		rep++
+		if rep == n {
+			s.Fields = append(s.Fields[:idx], s.Fields[idx+1:]...)
+			break
+		}
+	}
+	s.Value = s.encode(seps)
+	return nil
+}
+
+// clearField empties repetition n (1 based) of the field with sequence number i
+// n == 0 empties the field and removes its other repetitions
+func (s *Segment) clearField(i, n int, seps *Delimeters) {
+	fld := s.Repetition(i, n)
+	if fld == nil {
+		return
+	}
+	fld.Value = nil
+	fld.Components = nil
+	fld.parse(seps)
+	if n == 0 {
+		for idx := len(s.Fields) - 1; idx >= 0; idx-- {
+			if s.Fields[idx].SeqNum == i && &s.Fields[idx] != fld {
+				s.Fields = append(s.Fields[:idx], s.Fields[idx+1:]...)
+			}
+		}
+	}
+	s.Value = s.encode(seps)
+}
+
+// truncate removes the trailing fields with all their repetitions empty
+func (s *Segment) truncate(seps *Delimeters) {
+	if len(s.Fields) == 0 {
+		return
+	}
+	last := 0
+	for _, f := range s.Fields {
+		if len(f.Value) != 0 && f.SeqNum > last {
+			last = f.SeqNum
+		}
+	}
+	flds := s.Fields[:0]
+	for _, f := range s.Fields {
+		if f.SeqNum <= last {
+			flds = append(flds, f)
+		}
+	}
+	s.Fields = flds
+	s.maxSeq = last
+	s.Value = s.encode(seps)
+}
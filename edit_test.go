@@ -0,0 +1,107 @@
+package golevel7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const editMsg = "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\r" +
+	"PID|1||a~b~c||Jones^John|||\r" +
+	"ZXX|1\r" +
+	"OBX|1|NM|GLU||182\r" +
+	"ZXX|2\r" +
+	"OBX|2|NM|HGB||12"
+
+func TestSegmentEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(m *Message) error
+		want string
+	}{
+		{"insert after", func(m *Message) error {
+			return m.InsertSegmentAfter(NewLocation("OBX[2]"), "NTE|1||done")
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c||Jones^John|||\rZXX|1\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB||12\rNTE|1||done"},
+		{"insert before", func(m *Message) error {
+			return m.InsertSegmentBefore(NewLocation("OBX"), "PV1|1|I")
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c||Jones^John|||\rZXX|1\rPV1|1|I\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB||12"},
+		{"delete all", func(m *Message) error {
+			assert.Equal(t, 2, m.DeleteSegments(NewLocation("ZXX")))
+			return nil
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c||Jones^John|||\rOBX|1|NM|GLU||182\rOBX|2|NM|HGB||12"},
+		{"delete occurrence", func(m *Message) error {
+			assert.Equal(t, 1, m.DeleteSegments(NewLocation("ZXX[2]")))
+			assert.Equal(t, 0, m.DeleteSegments(NewLocation("ZYY")))
+			return nil
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c||Jones^John|||\rZXX|1\rOBX|1|NM|GLU||182\rOBX|2|NM|HGB||12"},
+		{"move after", func(m *Message) error {
+			return m.MoveSegmentAfter(NewLocation("ZXX"), NewLocation("OBX[2]"))
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c||Jones^John|||\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB||12\rZXX|1"},
+		{"move before", func(m *Message) error {
+			return m.MoveSegmentBefore(NewLocation("OBX[2]"), NewLocation("OBX"))
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c||Jones^John|||\rZXX|1\rOBX|2|NM|HGB||12\rOBX|1|NM|GLU||182\rZXX|2"},
+		{"add repetition", func(m *Message) error {
+			if err := m.AddRepetition(NewLocation("PID.3"), "d^e"); err != nil {
+				return err
+			}
+			return m.AddRepetition(NewLocation("PID.8"), "M")
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c~d^e||Jones^John|||M\rZXX|1\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB||12"},
+		{"remove repetition", func(m *Message) error {
+			if err := m.RemoveRepetition(NewLocation("PID.3[2]")); err != nil {
+				return err
+			}
+			return m.RemoveRepetition(NewLocation("PID.5[1]"))
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~c|||||\rZXX|1\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB||12"},
+		{"clear field", func(m *Message) error {
+			if err := m.ClearField(NewLocation("PID.3")); err != nil {
+				return err
+			}
+			return m.ClearField(NewLocation("OBX[2].5"))
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||||Jones^John|||\rZXX|1\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB||"},
+		{"clear repetition", func(m *Message) error {
+			return m.ClearField(NewLocation("PID.3[2]"))
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~~c||Jones^John|||\rZXX|1\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB||12"},
+		{"truncate", func(m *Message) error {
+			if err := m.ClearField(NewLocation("OBX[2].5")); err != nil {
+				return err
+			}
+			m.TruncateEmptyFields()
+			return nil
+		}, "MSH|^~\\&|A|B|||20060307||ORU^R01|1|P|2.5\rPID|1||a~b~c||Jones^John\rZXX|1\rOBX|1|NM|GLU||182\rZXX|2\rOBX|2|NM|HGB"},
+	}
+	for _, tt := range tests {
+		msg, err := ParseMessage([]byte(editMsg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.edit(msg); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		assert.Equal(t, tt.want, string(msg.Value), tt.name)
+		assert.Equal(t, tt.want, string(msg.Encode()), tt.name)
+		parsed, err := ParseMessage(msg.Encode())
+		if assert.NoError(t, err, tt.name) {
+			assert.Equal(t, len(parsed.Segments), len(msg.Segments), tt.name)
+		}
+	}
+
+	msg, err := ParseMessage([]byte(editMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, msg.InsertSegmentAfter(NewLocation("PV1"), "NTE|1"))
+	assert.Error(t, msg.InsertSegmentAfter(NewLocation("PID"), "nte|1"))
+	assert.Error(t, msg.RemoveRepetition(NewLocation("PID.3")))
+	assert.Error(t, msg.RemoveRepetition(NewLocation("PID.3[4]")))
+	assert.Error(t, msg.ClearField(NewLocation("MSH.2")))
+	assert.Equal(t, editMsg, string(msg.Encode()))
+
+	// the edited values can be found
+	assert.NoError(t, msg.AddRepetition(NewLocation("PID.3"), "x|y"))
+	vals, _ := msg.FindAll("PID.3")
+	assert.Equal(t, []string{"a", "b", "c", "x|y"}, vals)
+	assert.NoError(t, msg.MoveSegmentAfter(NewLocation("PID"), NewLocation("OBX[2]")))
+	val, _ := msg.Find("PID.5.2")
+	assert.Equal(t, "John", val)
+}
@@ -1,11 +1,12 @@
 package golevel7
 
 import (
-	"bytes"
 	"errors"
 	"io"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Encoder writes hl7 messages to a stream
@@ -38,7 +39,14 @@ func (e *Encoder) Encode(it interface{}) error {
 
 // Marshal will insert values into a message
 // It will panic if interface{} is not a pointer to a struct
+// Messages without delimeters get the default ones
 func Marshal(m *Message, it interface{}) ([]byte, error) {
+	if m.Delimeters.Field == 0 {
+		m.Delimeters = *NewDelimeters()
+	}
+	if err := m.Delimeters.validate(); err != nil {
+		return nil, err
+	}
 	st := reflect.ValueOf(it).Elem()
 	stt := st.Type()
 	repeating := false
@@ -49,42 +57,83 @@ func Marshal(m *Message, it interface{}) ([]byte, error) {
 		if len(parts) == 2 {
 			if parts[1] == "repeating" {
 				repeating = true
-				s := Segment{}
-				s.forceField([]rune(parts[0]), 0)
-				m.Segments = append(m.Segments, s)
+				m.Segments = append(m.Segments, newSegment(parts[0], &m.Delimeters))
 			}
 		} else {
+			if r == "" || NewLocation(r).FieldSeq < 0 {
+				continue
+			}
+			l := fixZeroOffset(NewLocation(r))
+			val, ok, err := encodeValue(st.Field(i), l, &m.Delimeters)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
 			if repeating {
 				// for repeating fields we need to set the last item in the segment which will be the new segment
-				l := fixZeroOffset(NewLocation(r))
-				val := st.Field(i).String()
-				if err := m.SetLast(l, val); err != nil {
-					return nil, err
-				}
-			} else if r != "" {
-				l := fixZeroOffset(NewLocation(r))
-				val := st.Field(i).String()
-				if err := m.Set(l, val); err != nil {
-					return nil, err
-				}
+				err = m.setLastRaw(l, val)
+			} else {
+				err = m.SetRaw(l, val)
+			}
+			if err != nil {
+				return nil, err
 			}
 		}
 	}
 
-	msg := []byte(string(m.Value))
-	msh := append([]byte("MSH"), byte(m.Delimeters.Field))
-	delims := append(msh, []byte(m.Delimeters.DelimeterField+string(m.Delimeters.Field))...)
-	msg = bytes.ReplaceAll(msg, msh, delims)
-	m.Value = []rune(string(msg))
+	m.Value = m.encode()
+	return []byte(string(m.Value)), nil
+}
 
-	return msg, nil
+// encodeValue returns the escaped HL7 value of v for Location l
+// ok is false for nil pointers and zero times which are not set
+// Marshaler implementations are responsible for their own escaping
+func encodeValue(v reflect.Value, l *Location, seps *Delimeters) (val string, ok bool, err error) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return "", false, nil
+	}
+	if implementsMarshaler(v.Type()) {
+		val, err = marshalElement(v, l, seps)
+		return val, err == nil, err
+	}
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", false, nil
+		}
+		val = FormatTime(t)
+	} else {
+		switch v.Kind() {
+		case reflect.Bool:
+			val = "N"
+			if v.Bool() {
+				val = "Y"
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			val = strconv.FormatInt(v.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			val = strconv.FormatUint(v.Uint(), 10)
+		case reflect.Float32, reflect.Float64:
+			val = strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+		default:
+			val = v.String()
+		}
+	}
+	return escape(val, seps, valueLevel(l)), true, nil
 }
 
 // Compensate for the fact that marshall should use non-zero offsets for the component and subcomponent locations.
 func fixZeroOffset(location *Location) *Location {
 	newLoc := &Location{
 		Segment:  location.Segment,
+		SegIdx:   location.SegIdx,
 		FieldSeq: location.FieldSeq,
+		FieldRep: location.FieldRep,
 		Comp:     -1,
 		SubComp:  -1,
 	}
@@ -0,0 +1,144 @@
+package golevel7
+
+import (
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// levels of a value used to decide which delimeters are escaped
+// delimeters below the level of a value are part of its structure
+const (
+	fieldLevel = iota
+	componentLevel
+	subComponentLevel
+)
+
+// Escape returns v with every delimeter in seps replaced by its HL7 escape sequence
+//
+//	\F\ field      \S\ component      \T\ subcomponent
+//	\R\ repetition \E\ escape         \.br\ line feed
+//	\X0D\ carriage return
+func Escape(v string, seps *Delimeters) string {
+	return escape(v, seps, subComponentLevel)
+}
+
+// escape escapes v for a value at level, leaving the delimeters
+// of the levels below it as is
+func escape(v string, seps *Delimeters, level int) string {
+	if seps.Escape == 0 {
+		return v
+	}
+	var b strings.Builder
+	b.Grow(len(v))
+	seq := func(s string) {
+		b.WriteRune(seps.Escape)
+		b.WriteString(s)
+		b.WriteRune(seps.Escape)
+	}
+	for _, ch := range v {
+		switch {
+		case ch == seps.Escape:
+			seq("E")
+		case ch == seps.Field:
+			seq("F")
+		case ch == seps.Repetition:
+			seq("R")
+		case ch == seps.Component && level >= componentLevel:
+			seq("S")
+		case ch == seps.SubComponent && level >= subComponentLevel:
+			seq("T")
+		case ch == endMsg:
+			seq(".br")
+		case ch == segTerm:
+			seq("X0D")
+		default:
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
+
+// Unescape returns v with the HL7 escape sequences for delimeters, hex data
+// and line breaks replaced by the characters they represent. Other escape
+// sequences, like formatting commands, are left as is
+func Unescape(v string, seps *Delimeters) string {
+	if seps.Escape == 0 || !strings.ContainsRune(v, seps.Escape) {
+		return v
+	}
+	rv := []rune(v)
+	var b strings.Builder
+	b.Grow(len(v))
+	for i := 0; i < len(rv); i++ {
+		if rv[i] != seps.Escape {
+			b.WriteRune(rv[i])
+			continue
+		}
+		end := -1
+		for j := i + 1; j < len(rv); j++ {
+			if rv[j] == seps.Escape {
+				end = j
+				break
+			}
+		}
+		if end < 0 {
+			// not terminated, keep the rest as is
+			b.WriteString(string(rv[i:]))
+			break
+		}
+		seq := string(rv[i+1 : end])
+		if s, ok := unescapeSeq(seq, seps); ok {
+			b.WriteString(s)
+		} else {
+			b.WriteString(string(rv[i : end+1]))
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// unescapeSeq returns the value of the escape sequence seq
+// ok is false for sequences that are not decoded
+func unescapeSeq(seq string, seps *Delimeters) (string, bool) {
+	switch seq {
+	case "F":
+		return string(seps.Field), true
+	case "S":
+		return string(seps.Component), true
+	case "T":
+		return string(seps.SubComponent), true
+	case "R":
+		return string(seps.Repetition), true
+	case "E":
+		return string(seps.Escape), true
+	case ".br":
+		return string(endMsg), true
+	}
+	if len(seq) > 1 && seq[0] == 'X' {
+		data, err := hex.DecodeString(seq[1:])
+		if err != nil {
+			return "", false
+		}
+		if utf8.Valid(data) {
+			return string(data), true
+		}
+		// not utf-8, treat as ISO-8859-1
+		rs := make([]rune, len(data))
+		for i, b := range data {
+			rs[i] = rune(b)
+		}
+		return string(rs), true
+	}
+	return "", false
+}
+
+// valueLevel returns the level of the value addressed by l
+func valueLevel(l *Location) int {
+	switch {
+	case l.Comp >= 0 && l.SubComp >= 0:
+		return subComponentLevel
+	case l.Comp >= 0:
+		return componentLevel
+	}
+	return fieldLevel
+}
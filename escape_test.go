@@ -0,0 +1,89 @@
+package golevel7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnescape(t *testing.T) {
+	seps := NewDelimeters()
+	tests := map[string]string{
+		`plain`:                 "plain",
+		`a\F\b\S\c\T\d\R\e\E\f`: `a|b^c&d~e\f`,
+		`line\.br\break`:        "line\nbreak",
+		`\X0D0A\`:               "\r\n",
+		`caf\XC3A9\`:            "café",
+		`caf\XE9\`:              "café",
+		`\H\bold\N\`:            `\H\bold\N\`,
+		`unterminated\F`:        `unterminated\F`,
+		`\Xzz\`:                 `\Xzz\`,
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, Unescape(in, seps), in)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	seps := NewDelimeters()
+	assert.Equal(t, `a\F\b\S\c\T\d\R\e\E\f`, Escape(`a|b^c&d~e\f`, seps))
+	assert.Equal(t, `two\.br\lines\X0D\`, Escape("two\nlines\r", seps))
+	assert.Equal(t, `a\F\b^c&d`, escape(`a|b^c&d`, seps, fieldLevel))
+	assert.Equal(t, `a\F\b\S\c&d`, escape(`a|b^c&d`, seps, componentLevel))
+
+	custom := &Delimeters{Field: '!', Component: '#', Repetition: '*', Escape: '$', SubComponent: '@'}
+	assert.Equal(t, `a$F$b$S$c$E$|^`, Escape(`a!b#c$|^`, custom))
+	assert.Equal(t, `a!b#c$|^`, Unescape(`a$F$b$S$c$E$|^`, custom))
+}
+
+func TestMessageEscaping(t *testing.T) {
+	data := "MSH|^~\\&|A\\T\\B|FAC\rPID|||1||Smith\\S\\Jones^Ann\\E\\\rOBX|1|FT|||C:\\E\\\rNTE|1"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, len(msg.Segments))
+
+	val, _ := msg.Find("MSH.3")
+	assert.Equal(t, "A&B", val)
+	val, _ = msg.Find("PID.5.1")
+	assert.Equal(t, "Smith^Jones", val)
+	val, _ = msg.Find("PID.5.2")
+	assert.Equal(t, `Ann\`, val)
+	val, _ = msg.FindRaw("PID.5.1")
+	assert.Equal(t, `Smith\S\Jones`, val)
+	vals, _ := msg.FindAllRaw("OBX.5")
+	assert.Equal(t, []string{`C:\E\`}, vals)
+
+	// Set uses 0 based component indexes
+	if err := msg.Set(NewLocation("PID.5.0"), "O|Brien^&~"); err != nil {
+		t.Fatal(err)
+	}
+	// & splits the component into subcomponents so it is not escaped
+	val, _ = msg.FindRaw("PID.5")
+	assert.Equal(t, `O\F\Brien\S\&\R\^Ann\E\`, val)
+	val, _ = msg.Find("PID.5.1")
+	assert.Equal(t, "O|Brien^&~", val)
+
+	// delimeters of lower levels split a field value into components
+	if err := msg.Set(NewLocation("PID.11"), "1 Main|St^^Denver"); err != nil {
+		t.Fatal(err)
+	}
+	val, _ = msg.Find("PID.11.3")
+	assert.Equal(t, "Denver", val)
+	val, _ = msg.Find("PID.11.1")
+	assert.Equal(t, "1 Main|St", val)
+
+	if err := msg.SetRaw(NewLocation("NTE.3"), `\H\Important\N\`); err != nil {
+		t.Fatal(err)
+	}
+	val, _ = msg.Find("NTE.3")
+	assert.Equal(t, `\H\Important\N\`, val)
+
+	reparsed, err := ParseMessage([]byte(string(msg.Value)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, _ = reparsed.Find("PID.5.1")
+	assert.Equal(t, "O|Brien^&~", val)
+}
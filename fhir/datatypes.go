@@ -0,0 +1,287 @@
+package fhir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhald/golevel7"
+)
+
+// FHIR code systems used by the conversion
+const (
+	systemActCode         = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	systemInterpretation  = "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation"
+	systemParticipantType = "http://terminology.hl7.org/CodeSystem/v3-ParticipationType"
+	systemIdentifierType  = "http://terminology.hl7.org/CodeSystem/v2-0203"
+	systemPatientClass    = "http://terminology.hl7.org/CodeSystem/v2-0004"
+	systemServiceSection  = "http://terminology.hl7.org/CodeSystem/v2-0074"
+	systemUCUM            = "http://unitsofmeasure.org"
+)
+
+// segment is an occurrence of a segment in the message being converted
+type segment struct {
+	name string
+	idx  int // occurrence, 1 based
+}
+
+// value is a field repetition in the message being converted, read with Message.Find
+type value struct {
+	m   *golevel7.Message
+	loc string // location of the repetition, PID[1].3[2], "" is an empty value
+}
+
+// String returns the whole value
+func (v value) String() string {
+	if v.loc == "" {
+		return ""
+	}
+	s, _ := v.m.Find(v.loc)
+	return s
+}
+
+// comp returns component n of the value, 1 based
+func (v value) comp(n int) string {
+	if v.loc == "" {
+		return ""
+	}
+	s, _ := v.m.Find(fmt.Sprintf("%s.%d", v.loc, n))
+	return s
+}
+
+// sub returns subcomponent s of component n of the value, 1 based
+func (v value) sub(n, s int) string {
+	if v.loc == "" {
+		return ""
+	}
+	str, _ := v.m.Find(fmt.Sprintf("%s.%d.%d", v.loc, n, s))
+	return str
+}
+
+// values returns the non empty repetitions of the field mapped to the FHIR element
+// The field of seg is used when the location is in seg, otherwise the one of the last
+// occurrence seen of the segment of the location, the ORC of an OBR for example
+func (cv *conversion) values(seg segment, element string) []value {
+	loc := cv.c.Locations[element]
+	if loc == "" {
+		return nil
+	}
+	l := golevel7.NewLocation(loc)
+	if l.FieldSeq < 1 {
+		return nil
+	}
+	idx := cv.current[l.Segment]
+	if l.Segment == seg.name {
+		idx = seg.idx
+	}
+	if segs, _ := cv.m.AllSegments(l.Segment); idx == 0 || idx > len(segs) {
+		return nil
+	}
+	field := fmt.Sprintf("%s[%d].%d", l.Segment, idx, l.FieldSeq)
+	reps := []int{l.FieldRep}
+	if l.FieldRep == 0 {
+		all, _ := cv.m.FindAll(field)
+		reps = reps[:0]
+		for i := range all {
+			reps = append(reps, i+1)
+		}
+	}
+	vals := []value{}
+	for _, rep := range reps {
+		v := value{m: cv.m, loc: fmt.Sprintf("%s[%d]", field, rep)}
+		if strings.TrimSpace(v.String()) != "" {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// first returns the first repetition of the field mapped to the FHIR element
+// an empty value if there is none
+func (cv *conversion) first(seg segment, element string) value {
+	vals := cv.values(seg, element)
+	if len(vals) == 0 {
+		return value{}
+	}
+	return vals[0]
+}
+
+// str returns the first repetition of the field mapped to the FHIR element as a string
+func (cv *conversion) str(seg segment, element string) string {
+	vals := cv.values(seg, element)
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0].String()
+}
+
+// nonEmpty returns the non empty strings of vals
+func nonEmpty(vals ...string) []string {
+	z := []string{}
+	for _, v := range vals {
+		if v != "" {
+			z = append(z, v)
+		}
+	}
+	return z
+}
+
+// identifierCX returns the Identifier of a CX value
+func (cv *conversion) identifierCX(v value) Resource {
+	id := Resource{}
+	set(id, "system", cv.c.system(v.sub(4, 1), v.sub(4, 2), v.sub(4, 3)))
+	set(id, "value", v.comp(1))
+	if typ := v.comp(5); typ != "" {
+		id["type"] = Resource{"coding": []interface{}{Resource{"system": systemIdentifierType, "code": typ}}}
+	}
+	return id
+}
+
+// identifierEI returns the Identifier of an EI value, typ is its v2-0203 type
+func (cv *conversion) identifierEI(v value, typ string) Resource {
+	id := Resource{}
+	set(id, "system", cv.c.system(v.comp(2), v.comp(3), v.comp(4)))
+	set(id, "value", v.comp(1))
+	if len(id) != 0 && typ != "" {
+		id["type"] = Resource{"coding": []interface{}{Resource{"system": systemIdentifierType, "code": typ}}}
+	}
+	return id
+}
+
+// codeableConcept returns the CodeableConcept of a CE or CWE value
+// with a coding for the identifier and one for the alternate identifier
+func (cv *conversion) codeableConcept(v value) Resource {
+	cc := Resource{}
+	codings := []interface{}{}
+	for _, i := range []int{1, 4} {
+		code := v.comp(i)
+		if code == "" {
+			continue
+		}
+		coding := Resource{}
+		set(coding, "system", cv.c.system(v.comp(i+2), "", ""))
+		coding["code"] = code
+		set(coding, "display", v.comp(i+1))
+		codings = append(codings, coding)
+	}
+	set(cc, "coding", codings)
+	set(cc, "text", v.comp(2))
+	return cc
+}
+
+// humanName returns the HumanName of an XPN value
+func (cv *conversion) humanName(v value) Resource {
+	name := Resource{}
+	set(name, "use", cv.c.code("nameUse", v.comp(7)))
+	set(name, "family", v.sub(1, 1))
+	set(name, "given", nonEmpty(v.comp(2), v.comp(3)))
+	set(name, "suffix", nonEmpty(v.comp(4)))
+	set(name, "prefix", nonEmpty(v.comp(5)))
+	return name
+}
+
+// address returns the Address of an XAD value
+func (cv *conversion) address(v value) Resource {
+	addr := Resource{}
+	set(addr, "use", cv.c.code("addressUse", v.comp(7)))
+	set(addr, "line", nonEmpty(v.sub(1, 1), v.comp(2)))
+	set(addr, "city", v.comp(3))
+	set(addr, "state", v.comp(4))
+	set(addr, "postalCode", v.comp(5))
+	set(addr, "country", v.comp(6))
+	return addr
+}
+
+// contactPoint returns the ContactPoint of an XTN value
+// use is the use when the value has none
+func (cv *conversion) contactPoint(v value, use string) Resource {
+	cp := Resource{}
+	system := cv.c.code("telecomSystem", v.comp(3))
+	val := v.comp(1)
+	switch {
+	case system == "email" && v.comp(4) != "":
+		val = v.comp(4)
+	case val == "" && v.comp(7) != "":
+		val = strings.Join(nonEmpty(v.comp(5), v.comp(6), v.comp(7)), " ")
+	}
+	if val == "" {
+		return cp
+	}
+	set(cp, "system", system)
+	cp["value"] = val
+	if u := cv.c.code("telecomUse", v.comp(2)); u != "" {
+		use = u
+	}
+	set(cp, "use", use)
+	return cp
+}
+
+// practitioner returns a logical reference to the practitioner of an XCN value
+func (cv *conversion) practitioner(v value) Resource {
+	ref := Resource{}
+	if id := v.comp(1); id != "" {
+		ident := Resource{"value": id}
+		set(ident, "system", cv.c.system(v.sub(9, 1), v.sub(9, 2), v.sub(9, 3)))
+		ref["identifier"] = ident
+	}
+	set(ref, "display", strings.Join(nonEmpty(v.comp(6), v.comp(3), v.comp(4), v.sub(2, 1), v.comp(5)), " "))
+	if len(ref) != 0 {
+		ref["type"] = "Practitioner"
+	}
+	return ref
+}
+
+// quantity returns the Quantity of the number val with the unit of a CE or CWE value
+// nil if val is not a number
+func (cv *conversion) quantity(val string, unit value) Resource {
+	f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		return nil
+	}
+	q := Resource{"value": f}
+	set(q, "unit", unit.comp(1))
+	if text := unit.comp(2); text != "" {
+		q["unit"] = text
+	}
+	if system := cv.c.system(unit.comp(3), "", ""); system != "" && unit.comp(1) != "" {
+		q["system"] = system
+		q["code"] = unit.comp(1)
+	}
+	return q
+}
+
+// dateTime returns the FHIR dateTime of a v2 DTM value, "" if it is not valid
+// the precision of the value is kept, times without an offset are in c.TimeZone
+func (c *Converter) dateTime(v string) string {
+	v = strings.TrimSpace(v)
+	t, err := golevel7.ParseTime(v)
+	if err != nil {
+		return ""
+	}
+	digits := v
+	if i := strings.IndexAny(v, ".+-"); i >= 0 {
+		digits = v[:i]
+	}
+	switch len(digits) {
+	case 4:
+		return t.Format("2006")
+	case 6:
+		return t.Format("2006-01")
+	case 8:
+		return t.Format("2006-01-02")
+	}
+	if !strings.ContainsAny(v, "+-") && c.TimeZone != nil {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), c.TimeZone)
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// date returns the FHIR date of a v2 DT or DTM value, "" if it is not valid
+func (c *Converter) date(v string) string {
+	dt := c.dateTime(v)
+	if len(dt) > 10 {
+		return dt[:10]
+	}
+	return dt
+}
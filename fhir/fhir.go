@@ -0,0 +1,260 @@
+// Package fhir converts HL7 v2 messages into FHIR R4 resources in a transaction Bundle
+//
+// PID is converted into a Patient, PV1 into an Encounter, OBR into a DiagnosticReport or a
+// ServiceRequest, OBX into an Observation and RXE with its ORC into a MedicationRequest.
+// The v2 locations, code tables and code systems used by the conversion are maps of the
+// Converter which can be changed for site specific conventions
+//
+// The Patient and Encounter entries are conditional creates on their first identifier, the
+// ifNoneExist table gives the search parameter used for each resource type
+//
+// Locations are read with Message.Find at the occurrence of their segment being converted,
+// PID.3 of the message is PID[1].3 and OBX.5 of the third OBX is OBX[3].5, the ORC of an
+// OBR is the last one before it. A location without a repetition maps each repetition
+//
+//	c := fhir.NewConverter()
+//	c.Locations["Patient.identifier"] = "PID.2"
+//	c.Tables["administrativeGender"]["X"] = "other"
+//	bundle, err := c.Convert(msg)
+//	b, err := json.Marshal(bundle)
+package fhir
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mhald/golevel7"
+)
+
+// Resource is a FHIR resource or element as it is encoded in JSON
+type Resource map[string]interface{}
+
+// Bundle is a FHIR transaction Bundle
+type Bundle struct {
+	ResourceType string   `json:"resourceType"`
+	Type         string   `json:"type"`
+	Entry        []*Entry `json:"entry"`
+}
+
+// Entry is an entry of a Bundle, resources reference each other by FullURL
+type Entry struct {
+	FullURL  string   `json:"fullUrl"`
+	Resource Resource `json:"resource"`
+	Request  Request  `json:"request"`
+}
+
+// Request is the transaction request of an Entry
+type Request struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	IfNoneExist string `json:"ifNoneExist,omitempty"`
+}
+
+// Resources returns the resources of the bundle of type resourceType, in bundle order
+func (b *Bundle) Resources(resourceType string) []Resource {
+	rs := []Resource{}
+	for _, e := range b.Entry {
+		if e.Resource["resourceType"] == resourceType {
+			rs = append(rs, e.Resource)
+		}
+	}
+	return rs
+}
+
+// Converter converts v2 messages into FHIR resources
+type Converter struct {
+	Locations   map[string]string            // v2 field location of each FHIR element, see DefaultLocations
+	Tables      map[string]map[string]string // v2 codes to FHIR codes by table, see DefaultTables
+	CodeSystems map[string]string            // FHIR system of v2 coding systems and assigning authorities, see DefaultCodeSystems
+	TimeZone    *time.Location               // zone of v2 times without an offset, UTC when nil
+	NewID       func() string                // returns the id of each resource, random UUIDs when nil
+}
+
+// NewConverter returns a Converter with the default locations, tables and code systems
+// the maps are copies which can be changed
+func NewConverter() *Converter {
+	return &Converter{
+		Locations:   DefaultLocations(),
+		Tables:      DefaultTables(),
+		CodeSystems: DefaultCodeSystems(),
+	}
+}
+
+// Convert converts m into a transaction Bundle with a NewConverter
+func Convert(m *golevel7.Message) (*Bundle, error) {
+	return NewConverter().Convert(m)
+}
+
+// Convert converts the segments of m into a transaction Bundle
+// Resources reference the Patient and Encounter of the message, Observations following an
+// OBR converted into a DiagnosticReport are its results and the route of an RXR following
+// an RXE is added to its MedicationRequest. A message without segments to convert returns
+// an empty Bundle
+func (c *Converter) Convert(m *golevel7.Message) (*Bundle, error) {
+	msgType, err := m.Find("MSH.9.1")
+	if err != nil {
+		return nil, err
+	}
+	event, _ := m.Find("MSH.9.2")
+	cv := &conversion{
+		c:       c,
+		m:       m,
+		b:       &Bundle{ResourceType: "Bundle", Type: "transaction", Entry: []*Entry{}},
+		msgType: msgType,
+		event:   event,
+		current: map[string]int{},
+	}
+	for _, s := range m.Segments {
+		name := s.Name()
+		cv.current[name]++
+		seg := segment{name: name, idx: cv.current[name]}
+		switch name {
+		case "PID":
+			if cv.patient == nil {
+				cv.patient = cv.add(cv.convertPatient(seg))
+			}
+		case "PV1":
+			if cv.encounter == nil {
+				cv.encounter = cv.add(cv.convertEncounter(seg))
+			}
+		case "OBR":
+			cv.report = nil
+			if c.code("orderResource", msgType) == "DiagnosticReport" {
+				cv.report = cv.add(cv.convertDiagnosticReport(seg))
+			} else {
+				cv.add(cv.convertServiceRequest(seg))
+			}
+		case "OBX":
+			obs := cv.add(cv.convertObservation(seg))
+			if cv.report != nil {
+				results, _ := cv.report.Resource["result"].([]interface{})
+				cv.report.Resource["result"] = append(results, cv.reference(obs))
+			}
+		case "RXE":
+			cv.medication = cv.add(cv.convertMedicationRequest(seg))
+		case "RXR":
+			if cv.medication != nil {
+				cv.addRoute(cv.medication.Resource, seg)
+			}
+		}
+	}
+	return cv.b, nil
+}
+
+// conversion is the state of the conversion of a message
+type conversion struct {
+	c          *Converter
+	m          *golevel7.Message
+	b          *Bundle
+	msgType    string
+	event      string
+	current    map[string]int // occurrence of the last segment seen by name
+	patient    *Entry
+	encounter  *Entry
+	report     *Entry
+	medication *Entry
+}
+
+// add adds the resource r to the bundle
+// resources with a search parameter in the ifNoneExist table are created only if no
+// resource matches the first identifier of r, see ifNoneExist
+func (cv *conversion) add(r Resource) *Entry {
+	rt := r["resourceType"].(string)
+	e := &Entry{
+		FullURL:  "urn:uuid:" + cv.c.newID(),
+		Resource: r,
+		Request:  Request{Method: "POST", URL: rt, IfNoneExist: ifNoneExist(cv.c.Tables["ifNoneExist"][rt], r)},
+	}
+	cv.b.Entry = append(cv.b.Entry, e)
+	return e
+}
+
+// ifNoneExist returns the query of a conditional create of r, param=system|value with the
+// first identifier of r, or "" when param is "" or r has no identifier
+func ifNoneExist(param string, r Resource) string {
+	ids, _ := r["identifier"].([]interface{})
+	if param == "" || len(ids) == 0 {
+		return ""
+	}
+	id, _ := ids[0].(Resource)
+	token, _ := id["value"].(string)
+	if system, ok := id["system"].(string); ok {
+		token = system + "|" + token
+	}
+	return url.Values{param: {token}}.Encode()
+}
+
+// reference returns a reference to the resource of e
+func (cv *conversion) reference(e *Entry) Resource {
+	if e == nil {
+		return nil
+	}
+	return Resource{"reference": e.FullURL}
+}
+
+// setContext sets the subject and encounter of r to the Patient and Encounter of the message
+func (cv *conversion) setContext(r Resource) {
+	set(r, "subject", cv.reference(cv.patient))
+	set(r, "encounter", cv.reference(cv.encounter))
+}
+
+func (c *Converter) newID() string {
+	if c.NewID != nil {
+		return c.NewID()
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// code returns the FHIR code of the v2 code v in table
+// codes not in the table get the code of "" in the table, if any
+func (c *Converter) code(table, v string) string {
+	t := c.Tables[table]
+	if code, ok := t[v]; ok {
+		return code
+	}
+	return t[""]
+}
+
+// system returns the FHIR system of a v2 coding system or assigning authority name
+// a universal id of type ISO is an OID
+func (c *Converter) system(name, id, idType string) string {
+	if s, ok := c.CodeSystems[name]; ok && name != "" {
+		return s
+	}
+	if id != "" && idType == "ISO" {
+		return "urn:oid:" + id
+	}
+	return ""
+}
+
+// set sets key of r to v unless v is empty
+func set(r Resource, key string, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		return
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return
+		}
+	case Resource:
+		if len(v) == 0 {
+			return
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	}
+	r[key] = v
+}
@@ -0,0 +1,212 @@
+package fhir
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mhald/golevel7"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConverter returns a Converter with sequential ids
+func testConverter() *Converter {
+	c := NewConverter()
+	n := 0
+	c.NewID = func() string {
+		n++
+		return strconv.Itoa(n)
+	}
+	return c
+}
+
+func parse(t *testing.T, data string) *golevel7.Message {
+	msg, err := golevel7.ParseMessage([]byte(data))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return msg
+}
+
+func TestConvertORU(t *testing.T) {
+	msg := parse(t, "MSH|^~\\&|LAB|PA|||20230102030405||ORU^R01|1|P|2.5\r"+
+		"PID|1||1058299^^^HMRN^MR~123-45-6789^^^SSA||JONES^JOHN^A^JR^DR^^L||19700215|M|||1 MAIN ST^APT 2^DENVER^CO^80020^USA^H||(303)555-1212^PRN^PH~^NET^Internet^jj@example.com||||||||||||||||||\r"+
+		"PV1|1|I|4W^401^A||||1234^SMITH^ANNE^^^DR|||||||||||| |||||||||||||||||||||||||20230101120000\r"+
+		"ORC|RE|P100|F200\r"+
+		"OBR|1|P100^EPIC|F200^LAB^1.2.3^ISO|24331-1^Lipid panel^LN|||20230102010000|||||||||||||||20230102030000||CH|F\r"+
+		"OBX|1|NM|2093-3^Cholesterol^LN||196|mg/dL^^UCUM|<200|N|||F|||20230102010000\r"+
+		"OBX|2|NM|2571-8^Triglycerides^LN||40-60|mg/dL|50-150|N|||P\r"+
+		"OBX|3|TX|NOTE^Note||line one~line two||||||F\r")
+	b, err := testConverter().Convert(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Bundle", b.ResourceType)
+	assert.Equal(t, "transaction", b.Type)
+	if !assert.Len(t, b.Entry, 6) {
+		return
+	}
+	for i, e := range b.Entry {
+		assert.Equal(t, "urn:uuid:"+strconv.Itoa(i+1), e.FullURL)
+		assert.Equal(t, "POST", e.Request.Method)
+		assert.Equal(t, e.Resource["resourceType"], e.Request.URL)
+	}
+	// conditional create of the Patient, the Encounter has no identifier
+	assert.Equal(t, "identifier=1058299", b.Entry[0].Request.IfNoneExist)
+	assert.Equal(t, "Encounter", b.Entry[1].Request.URL)
+	assert.Empty(t, b.Entry[1].Request.IfNoneExist)
+	assert.Empty(t, b.Entry[2].Request.IfNoneExist)
+
+	patient := b.Resources("Patient")[0]
+	assert.Equal(t, []interface{}{
+		Resource{"value": "1058299", "type": Resource{"coding": []interface{}{Resource{"system": systemIdentifierType, "code": "MR"}}}},
+		Resource{"system": "http://hl7.org/fhir/sid/us-ssn", "value": "123-45-6789"},
+	}, patient["identifier"])
+	assert.Equal(t, []interface{}{Resource{"use": "official", "family": "JONES", "given": []string{"JOHN", "A"}, "suffix": []string{"JR"}, "prefix": []string{"DR"}}}, patient["name"])
+	assert.Equal(t, "male", patient["gender"])
+	assert.Equal(t, "1970-02-15", patient["birthDate"])
+	assert.Equal(t, []interface{}{Resource{"use": "home", "line": []string{"1 MAIN ST", "APT 2"}, "city": "DENVER", "state": "CO", "postalCode": "80020", "country": "USA"}}, patient["address"])
+	assert.Equal(t, []interface{}{
+		Resource{"system": "phone", "value": "(303)555-1212", "use": "home"},
+		Resource{"system": "email", "value": "jj@example.com"},
+	}, patient["telecom"])
+
+	enc := b.Resources("Encounter")[0]
+	assert.Equal(t, "unknown", enc["status"])
+	assert.Equal(t, Resource{"system": systemActCode, "code": "IMP"}, enc["class"])
+	assert.Nil(t, enc["identifier"], "blank PV1.19")
+	assert.Equal(t, Resource{"reference": "urn:uuid:1"}, enc["subject"])
+	assert.Equal(t, Resource{"start": "2023-01-01T12:00:00Z"}, enc["period"])
+	assert.Equal(t, []interface{}{Resource{
+		"type":       []interface{}{Resource{"coding": []interface{}{Resource{"system": systemParticipantType, "code": "ATND"}}}},
+		"individual": Resource{"identifier": Resource{"value": "1234"}, "display": "DR ANNE SMITH", "type": "Practitioner"},
+	}}, enc["participant"])
+	assert.Equal(t, []interface{}{Resource{"location": Resource{"display": "4W 401 A"}}}, enc["location"])
+
+	assert.Empty(t, b.Resources("ServiceRequest"))
+	report := b.Resources("DiagnosticReport")[0]
+	assert.Equal(t, "final", report["status"])
+	assert.Equal(t, []interface{}{
+		Resource{"value": "P100", "type": Resource{"coding": []interface{}{Resource{"system": systemIdentifierType, "code": "PLAC"}}}},
+		Resource{"system": "urn:oid:1.2.3", "value": "F200", "type": Resource{"coding": []interface{}{Resource{"system": systemIdentifierType, "code": "FILL"}}}},
+	}, report["identifier"])
+	assert.Equal(t, Resource{"coding": []interface{}{Resource{"system": "http://loinc.org", "code": "24331-1", "display": "Lipid panel"}}, "text": "Lipid panel"}, report["code"])
+	assert.Equal(t, []interface{}{Resource{"coding": []interface{}{Resource{"system": systemServiceSection, "code": "CH"}}}}, report["category"])
+	assert.Equal(t, "2023-01-02T01:00:00Z", report["effectiveDateTime"])
+	assert.Equal(t, "2023-01-02T03:00:00Z", report["issued"])
+	assert.Equal(t, Resource{"reference": "urn:uuid:2"}, report["encounter"])
+	assert.Equal(t, []interface{}{Resource{"reference": "urn:uuid:4"}, Resource{"reference": "urn:uuid:5"}, Resource{"reference": "urn:uuid:6"}}, report["result"])
+
+	obs := b.Resources("Observation")
+	if !assert.Len(t, obs, 3) {
+		return
+	}
+	assert.Equal(t, "final", obs[0]["status"])
+	assert.Equal(t, Resource{"value": 196.0, "unit": "mg/dL", "system": systemUCUM, "code": "mg/dL"}, obs[0]["valueQuantity"])
+	assert.Equal(t, []interface{}{Resource{"text": "<200"}}, obs[0]["referenceRange"])
+	assert.Equal(t, []interface{}{Resource{"coding": []interface{}{Resource{"system": systemInterpretation, "code": "N"}}}}, obs[0]["interpretation"])
+	assert.Equal(t, "2023-01-02T01:00:00Z", obs[0]["effectiveDateTime"])
+	assert.Equal(t, Resource{"reference": "urn:uuid:1"}, obs[0]["subject"])
+	// not a number
+	assert.Equal(t, "preliminary", obs[1]["status"])
+	assert.Equal(t, "40-60", obs[1]["valueString"])
+	assert.Equal(t, []interface{}{Resource{"text": "50-150", "low": Resource{"value": 50.0, "unit": "mg/dL"}, "high": Resource{"value": 150.0, "unit": "mg/dL"}}}, obs[1]["referenceRange"])
+	assert.Equal(t, "line one\nline two", obs[2]["valueString"])
+
+	_, err = json.Marshal(b)
+	assert.NoError(t, err)
+}
+
+func TestConvertORM(t *testing.T) {
+	data, err := os.ReadFile("../testdata/msg.hl7")
+	if !assert.NoError(t, err) {
+		return
+	}
+	b, err := testConverter().Convert(parse(t, string(data)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, b.Resources("Patient"), 1)
+	assert.Empty(t, b.Resources("DiagnosticReport"))
+	reqs := b.Resources("ServiceRequest")
+	if !assert.NotEmpty(t, reqs) {
+		return
+	}
+	assert.Equal(t, "order", reqs[0]["intent"])
+	assert.Equal(t, Resource{"reference": b.Entry[0].FullURL}, reqs[0]["subject"])
+	assert.NotEmpty(t, reqs[0]["status"])
+}
+
+func TestConvertRDE(t *testing.T) {
+	msg := parse(t, "MSH|^~\\&|PHARM|PA|||20230102030405||RDE^O11|1|P|2.5\r"+
+		"PID|1||42^^^HMRN||DOE^JANE||19800101|F\r"+
+		"ORC|NW|P1^EPIC|F1^PHARM||||||20230102030000-0500|||99^JONES^MARY\r"+
+		"RXE|^Q8H|197361^Amlodipine 5 MG^RXNORM|5||mg^^UCUM||^Take one tablet^|||30|{tbl}|2\r"+
+		"RXR|PO^Oral^HL70162\r")
+	b, err := testConverter().Convert(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	meds := b.Resources("MedicationRequest")
+	if !assert.Len(t, meds, 1) {
+		return
+	}
+	med := meds[0]
+	assert.Equal(t, "active", med["status"])
+	assert.Equal(t, "order", med["intent"])
+	assert.Equal(t, Resource{"coding": []interface{}{Resource{"system": "http://www.nlm.nih.gov/research/umls/rxnorm", "code": "197361", "display": "Amlodipine 5 MG"}}, "text": "Amlodipine 5 MG"}, med["medicationCodeableConcept"])
+	assert.Equal(t, "2023-01-02T03:00:00-05:00", med["authoredOn"])
+	assert.Equal(t, Resource{"identifier": Resource{"value": "99"}, "display": "MARY JONES", "type": "Practitioner"}, med["requester"])
+	assert.Equal(t, Resource{"reference": "urn:uuid:1"}, med["subject"])
+	assert.Nil(t, med["encounter"])
+	assert.Equal(t, []interface{}{Resource{
+		"text":        "Take one tablet",
+		"doseAndRate": []interface{}{Resource{"doseQuantity": Resource{"value": 5.0, "unit": "mg", "system": systemUCUM, "code": "mg"}}},
+		"route":       Resource{"coding": []interface{}{Resource{"code": "PO", "display": "Oral"}}, "text": "Oral"},
+	}}, med["dosageInstruction"])
+	assert.Equal(t, Resource{"quantity": Resource{"value": 30.0, "unit": "{tbl}"}, "numberOfRepeatsAllowed": 2}, med["dispenseRequest"])
+}
+
+func TestConverterOverrides(t *testing.T) {
+	msg := parse(t, "MSH|^~\\&|ADT|PA|||20230102030405||ADT^A03|1|P|2.5\r"+
+		"PID|1|777|42^^^HMRN||DOE^JANE||1980|X\r"+
+		"PV1|1|Z|||||||||||||||||V9|||||||||||||||||||||||||20230101080000|20230102080000\r")
+	c := testConverter()
+	c.Locations["Patient.identifier"] = "PID.2"
+	delete(c.Locations, "Patient.name")
+	c.Tables["administrativeGender"]["X"] = "other"
+	delete(c.Tables["ifNoneExist"], "Encounter")
+	c.TimeZone = time.FixedZone("", -7*3600)
+	b, err := c.Convert(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	patient := b.Resources("Patient")[0]
+	assert.Equal(t, []interface{}{Resource{"value": "777"}}, patient["identifier"])
+	assert.Nil(t, patient["name"])
+	assert.Equal(t, "other", patient["gender"])
+	assert.Equal(t, "1980", patient["birthDate"])
+
+	enc := b.Resources("Encounter")[0]
+	assert.Equal(t, "finished", enc["status"])
+	// codes not in encounterClass are v2 patient classes
+	assert.Equal(t, Resource{"system": systemPatientClass, "code": "Z"}, enc["class"])
+	assert.Equal(t, []interface{}{Resource{"value": "V9"}}, enc["identifier"])
+	assert.Equal(t, "identifier=777", b.Entry[0].Request.IfNoneExist)
+	assert.Empty(t, b.Entry[1].Request.IfNoneExist)
+	assert.Equal(t, "identifier=urn%3Aoid%3A1.2%7C42", ifNoneExist("identifier",
+		Resource{"identifier": []interface{}{Resource{"system": "urn:oid:1.2", "value": "42"}}}))
+	assert.Equal(t, Resource{"start": "2023-01-01T08:00:00-07:00", "end": "2023-01-02T08:00:00-07:00"}, enc["period"])
+
+	// defaults are not changed
+	assert.Equal(t, "PID.3", DefaultLocations()["Patient.identifier"])
+	assert.NotContains(t, DefaultTables()["administrativeGender"], "X")
+
+	// nothing to convert
+	b, err = Convert(parse(t, "MSH|^~\\&|ADT|PA|||20230102030405||ACK^A01|1|P|2.5\rMSA|AA|1\r"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, b.Entry)
+	}
+}
@@ -0,0 +1,231 @@
+package fhir
+
+import (
+	"strconv"
+	"strings"
+)
+
+// convertPatient returns the Patient of a PID segment
+func (cv *conversion) convertPatient(seg segment) Resource {
+	r := Resource{"resourceType": "Patient"}
+	ids := []interface{}{}
+	for _, v := range cv.values(seg, "Patient.identifier") {
+		ids = append(ids, cv.identifierCX(v))
+	}
+	set(r, "identifier", ids)
+	names := []interface{}{}
+	for _, v := range cv.values(seg, "Patient.name") {
+		names = append(names, cv.humanName(v))
+	}
+	set(r, "name", names)
+	set(r, "gender", cv.c.code("administrativeGender", cv.str(seg, "Patient.gender")))
+	set(r, "birthDate", cv.c.date(cv.str(seg, "Patient.birthDate")))
+	addrs := []interface{}{}
+	for _, v := range cv.values(seg, "Patient.address") {
+		addrs = append(addrs, cv.address(v))
+	}
+	set(r, "address", addrs)
+	telecom := []interface{}{}
+	for _, v := range cv.values(seg, "Patient.telecom") {
+		if cp := cv.contactPoint(v, ""); len(cp) != 0 {
+			telecom = append(telecom, cp)
+		}
+	}
+	for _, v := range cv.values(seg, "Patient.telecom.work") {
+		if cp := cv.contactPoint(v, "work"); len(cp) != 0 {
+			telecom = append(telecom, cp)
+		}
+	}
+	set(r, "telecom", telecom)
+	set(r, "maritalStatus", cv.codeableConcept(cv.first(seg, "Patient.maritalStatus")))
+	if dt := cv.c.dateTime(cv.str(seg, "Patient.deceasedDateTime")); dt != "" {
+		r["deceasedDateTime"] = dt
+	} else if d := cv.str(seg, "Patient.deceasedBoolean"); d != "" {
+		r["deceasedBoolean"] = d == "Y"
+	}
+	return r
+}
+
+// participantTypes are the v3 ParticipationType codes of the Encounter participants
+// mapped by the Encounter.participant.<code> locations
+var participantTypes = []string{"ATND", "REF", "CON", "ADM"}
+
+// convertEncounter returns the Encounter of a PV1 segment
+func (cv *conversion) convertEncounter(seg segment) Resource {
+	r := Resource{"resourceType": "Encounter"}
+	end := cv.c.dateTime(cv.str(seg, "Encounter.period.end"))
+	r["status"] = cv.c.code("encounterStatus", cv.event)
+	if end != "" {
+		r["status"] = "finished"
+	}
+	if class := cv.str(seg, "Encounter.class"); class != "" {
+		if code := cv.c.code("encounterClass", class); code != "" {
+			r["class"] = Resource{"system": systemActCode, "code": code}
+		} else {
+			r["class"] = Resource{"system": systemPatientClass, "code": class}
+		}
+	}
+	ids := []interface{}{}
+	for _, v := range cv.values(seg, "Encounter.identifier") {
+		ids = append(ids, cv.identifierCX(v))
+	}
+	set(r, "identifier", ids)
+	set(r, "subject", cv.reference(cv.patient))
+	period := Resource{}
+	set(period, "start", cv.c.dateTime(cv.str(seg, "Encounter.period.start")))
+	set(period, "end", end)
+	set(r, "period", period)
+	participants := []interface{}{}
+	for _, typ := range participantTypes {
+		for _, v := range cv.values(seg, "Encounter.participant."+typ) {
+			if ref := cv.practitioner(v); len(ref) != 0 {
+				participants = append(participants, Resource{
+					"type":       []interface{}{Resource{"coding": []interface{}{Resource{"system": systemParticipantType, "code": typ}}}},
+					"individual": ref,
+				})
+			}
+		}
+	}
+	set(r, "participant", participants)
+	if v := cv.first(seg, "Encounter.location"); v.String() != "" {
+		display := strings.Join(nonEmpty(v.comp(1), v.comp(2), v.comp(3)), " ")
+		r["location"] = []interface{}{Resource{"location": Resource{"display": display}}}
+	}
+	return r
+}
+
+// orderIdentifiers returns the placer and filler identifiers of an order
+func (cv *conversion) orderIdentifiers(seg segment, resource string) []interface{} {
+	ids := []interface{}{}
+	if id := cv.identifierEI(cv.first(seg, resource+".identifier.placer"), "PLAC"); len(id) != 0 {
+		ids = append(ids, id)
+	}
+	if id := cv.identifierEI(cv.first(seg, resource+".identifier.filler"), "FILL"); len(id) != 0 {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// convertServiceRequest returns the ServiceRequest of an OBR segment and its ORC
+func (cv *conversion) convertServiceRequest(seg segment) Resource {
+	r := Resource{"resourceType": "ServiceRequest", "intent": "order"}
+	r["status"] = cv.c.code("serviceRequestStatus", cv.str(seg, "ServiceRequest.status"))
+	set(r, "identifier", cv.orderIdentifiers(seg, "ServiceRequest"))
+	set(r, "code", cv.codeableConcept(cv.first(seg, "ServiceRequest.code")))
+	cv.setContext(r)
+	set(r, "occurrenceDateTime", cv.c.dateTime(cv.str(seg, "ServiceRequest.occurrenceDateTime")))
+	set(r, "authoredOn", cv.c.dateTime(cv.str(seg, "ServiceRequest.authoredOn")))
+	set(r, "requester", cv.practitioner(cv.first(seg, "ServiceRequest.requester")))
+	return r
+}
+
+// convertDiagnosticReport returns the DiagnosticReport of an OBR segment
+// the Observations of the OBX segments following it are added as its results
+func (cv *conversion) convertDiagnosticReport(seg segment) Resource {
+	r := Resource{"resourceType": "DiagnosticReport"}
+	r["status"] = cv.c.code("diagnosticReportStatus", cv.str(seg, "DiagnosticReport.status"))
+	set(r, "identifier", cv.orderIdentifiers(seg, "DiagnosticReport"))
+	if section := cv.str(seg, "DiagnosticReport.category"); section != "" {
+		r["category"] = []interface{}{Resource{"coding": []interface{}{Resource{"system": systemServiceSection, "code": section}}}}
+	}
+	set(r, "code", cv.codeableConcept(cv.first(seg, "DiagnosticReport.code")))
+	cv.setContext(r)
+	set(r, "effectiveDateTime", cv.c.dateTime(cv.str(seg, "DiagnosticReport.effectiveDateTime")))
+	if issued := cv.c.dateTime(cv.str(seg, "DiagnosticReport.issued")); strings.Contains(issued, "T") {
+		r["issued"] = issued
+	}
+	return r
+}
+
+// convertObservation returns the Observation of an OBX segment
+// the value is converted according to the value type of OBX.2
+func (cv *conversion) convertObservation(seg segment) Resource {
+	r := Resource{"resourceType": "Observation"}
+	r["status"] = cv.c.code("observationStatus", cv.str(seg, "Observation.status"))
+	set(r, "code", cv.codeableConcept(cv.first(seg, "Observation.code")))
+	cv.setContext(r)
+	set(r, "effectiveDateTime", cv.c.dateTime(cv.str(seg, "Observation.effectiveDateTime")))
+	vals := cv.values(seg, "Observation.value")
+	if len(vals) != 0 {
+		switch typ := cv.str(seg, "Observation.valueType"); typ {
+		case "NM":
+			if q := cv.quantity(vals[0].String(), cv.first(seg, "Observation.unit")); q != nil {
+				r["valueQuantity"] = q
+			} else {
+				r["valueString"] = vals[0].String()
+			}
+		case "CE", "CWE", "CNE":
+			set(r, "valueCodeableConcept", cv.codeableConcept(vals[0]))
+		case "DT", "DTM", "TS":
+			set(r, "valueDateTime", cv.c.dateTime(vals[0].String()))
+		default:
+			text := []string{}
+			for _, v := range vals {
+				text = append(text, v.String())
+			}
+			r["valueString"] = strings.Join(text, "\n")
+		}
+	}
+	interpretation := []interface{}{}
+	for _, v := range cv.values(seg, "Observation.interpretation") {
+		interpretation = append(interpretation, Resource{"coding": []interface{}{Resource{"system": systemInterpretation, "code": v.String()}}})
+	}
+	set(r, "interpretation", interpretation)
+	if rng := cv.str(seg, "Observation.referenceRange"); rng != "" {
+		rr := Resource{"text": rng}
+		if parts := strings.SplitN(rng, "-", 2); len(parts) == 2 {
+			unit := cv.first(seg, "Observation.unit")
+			set(rr, "low", cv.quantity(parts[0], unit))
+			set(rr, "high", cv.quantity(parts[1], unit))
+		}
+		r["referenceRange"] = []interface{}{rr}
+	}
+	return r
+}
+
+// convertMedicationRequest returns the MedicationRequest of an RXE segment and its ORC
+func (cv *conversion) convertMedicationRequest(seg segment) Resource {
+	r := Resource{"resourceType": "MedicationRequest", "intent": "order"}
+	r["status"] = cv.c.code("medicationRequestStatus", cv.str(seg, "MedicationRequest.status"))
+	set(r, "identifier", cv.orderIdentifiers(seg, "MedicationRequest"))
+	set(r, "medicationCodeableConcept", cv.codeableConcept(cv.first(seg, "MedicationRequest.medication")))
+	cv.setContext(r)
+	set(r, "authoredOn", cv.c.dateTime(cv.str(seg, "MedicationRequest.authoredOn")))
+	set(r, "requester", cv.practitioner(cv.first(seg, "MedicationRequest.requester")))
+	dosage := Resource{}
+	if instr := cv.first(seg, "MedicationRequest.dosageInstruction.text"); instr.String() != "" {
+		text := instr.comp(2)
+		if text == "" {
+			text = instr.comp(1)
+		}
+		dosage["text"] = text
+	}
+	if dose := cv.quantity(cv.str(seg, "MedicationRequest.dosageInstruction.dose"), cv.first(seg, "MedicationRequest.dosageInstruction.doseUnit")); dose != nil {
+		dosage["doseAndRate"] = []interface{}{Resource{"doseQuantity": dose}}
+	}
+	set(r, "dosageInstruction", []interface{}{dosage})
+	if len(dosage) == 0 {
+		delete(r, "dosageInstruction")
+	}
+	dispense := Resource{}
+	set(dispense, "quantity", cv.quantity(cv.str(seg, "MedicationRequest.dispenseRequest.quantity"), cv.first(seg, "MedicationRequest.dispenseRequest.unit")))
+	if n, err := strconv.Atoi(cv.str(seg, "MedicationRequest.dispenseRequest.numberOfRepeatsAllowed")); err == nil {
+		dispense["numberOfRepeatsAllowed"] = n
+	}
+	set(r, "dispenseRequest", dispense)
+	return r
+}
+
+// addRoute adds the route of an RXR segment to the dosage of the MedicationRequest r
+func (cv *conversion) addRoute(r Resource, seg segment) {
+	route := cv.codeableConcept(cv.first(seg, "MedicationRequest.dosageInstruction.route"))
+	if len(route) == 0 {
+		return
+	}
+	dosages, _ := r["dosageInstruction"].([]interface{})
+	if len(dosages) == 0 {
+		dosages = []interface{}{Resource{}}
+		r["dosageInstruction"] = dosages
+	}
+	dosages[0].(Resource)["route"] = route
+}
@@ -0,0 +1,127 @@
+package fhir
+
+// DefaultLocations returns the v2 field location of each FHIR element converted
+// Locations in another segment than the one converted are read from the last occurrence
+// of that segment before it, ServiceRequest.status is ORC.1 of the order for example
+// An element without a location is not converted
+func DefaultLocations() map[string]string {
+	return map[string]string{
+		"Patient.identifier":       "PID.3",
+		"Patient.name":             "PID.5",
+		"Patient.birthDate":        "PID.7",
+		"Patient.gender":           "PID.8",
+		"Patient.address":          "PID.11",
+		"Patient.telecom":          "PID.13",
+		"Patient.telecom.work":     "PID.14",
+		"Patient.maritalStatus":    "PID.16",
+		"Patient.deceasedDateTime": "PID.29",
+		"Patient.deceasedBoolean":  "PID.30",
+
+		"Encounter.class":            "PV1.2",
+		"Encounter.location":         "PV1.3",
+		"Encounter.participant.ATND": "PV1.7",
+		"Encounter.participant.REF":  "PV1.8",
+		"Encounter.participant.CON":  "PV1.9",
+		"Encounter.participant.ADM":  "PV1.17",
+		"Encounter.identifier":       "PV1.19",
+		"Encounter.period.start":     "PV1.44",
+		"Encounter.period.end":       "PV1.45",
+
+		"ServiceRequest.status":             "ORC.1",
+		"ServiceRequest.identifier.placer":  "OBR.2",
+		"ServiceRequest.identifier.filler":  "OBR.3",
+		"ServiceRequest.code":               "OBR.4",
+		"ServiceRequest.occurrenceDateTime": "OBR.7",
+		"ServiceRequest.authoredOn":         "ORC.9",
+		"ServiceRequest.requester":          "OBR.16",
+
+		"DiagnosticReport.identifier.placer": "OBR.2",
+		"DiagnosticReport.identifier.filler": "OBR.3",
+		"DiagnosticReport.code":              "OBR.4",
+		"DiagnosticReport.effectiveDateTime": "OBR.7",
+		"DiagnosticReport.issued":            "OBR.22",
+		"DiagnosticReport.category":          "OBR.24",
+		"DiagnosticReport.status":            "OBR.25",
+
+		"Observation.valueType":         "OBX.2",
+		"Observation.code":              "OBX.3",
+		"Observation.value":             "OBX.5",
+		"Observation.unit":              "OBX.6",
+		"Observation.referenceRange":    "OBX.7",
+		"Observation.interpretation":    "OBX.8",
+		"Observation.status":            "OBX.11",
+		"Observation.effectiveDateTime": "OBX.14",
+
+		"MedicationRequest.status":                                 "ORC.1",
+		"MedicationRequest.identifier.placer":                      "ORC.2",
+		"MedicationRequest.identifier.filler":                      "ORC.3",
+		"MedicationRequest.authoredOn":                             "ORC.9",
+		"MedicationRequest.requester":                              "ORC.12",
+		"MedicationRequest.medication":                             "RXE.2",
+		"MedicationRequest.dosageInstruction.dose":                 "RXE.3",
+		"MedicationRequest.dosageInstruction.doseUnit":             "RXE.5",
+		"MedicationRequest.dosageInstruction.text":                 "RXE.7",
+		"MedicationRequest.dispenseRequest.quantity":               "RXE.10",
+		"MedicationRequest.dispenseRequest.unit":                   "RXE.11",
+		"MedicationRequest.dispenseRequest.numberOfRepeatsAllowed": "RXE.12",
+		"MedicationRequest.dosageInstruction.route":                "RXR.1",
+	}
+}
+
+// DefaultTables returns the tables of v2 codes to FHIR codes
+// the code of "" is used for codes not in the table. orderResource is the resource
+// of an OBR by message type, MSH.9.1, and encounterStatus the Encounter status by
+// trigger event, MSH.9.2, unless PV1.45 has a discharge date
+func DefaultTables() map[string]map[string]string {
+	return map[string]map[string]string{
+		"administrativeGender": {"M": "male", "F": "female", "O": "other", "A": "other", "U": "unknown", "": "unknown"},
+		"nameUse":              {"L": "official", "D": "usual", "M": "maiden", "N": "nickname", "TEMP": "temp"},
+		"addressUse":           {"H": "home", "B": "work", "O": "work", "C": "temp", "BA": "old"},
+		"telecomUse":           {"PRN": "home", "ORN": "home", "VHN": "home", "WPN": "work", "PRS": "mobile", "EMR": "temp"},
+		"telecomSystem":        {"PH": "phone", "CP": "phone", "FX": "fax", "BP": "pager", "Internet": "email", "X.400": "email", "": "phone"},
+		"encounterClass":       {"I": "IMP", "O": "AMB", "E": "EMER", "P": "PRENC"},
+		"encounterStatus": {
+			"A01": "in-progress", "A02": "in-progress", "A03": "finished", "A04": "arrived", "A05": "planned",
+			"A06": "in-progress", "A07": "in-progress", "A08": "in-progress", "A11": "cancelled", "A13": "in-progress",
+			"A14": "planned", "A38": "cancelled", "": "unknown",
+		},
+		"ifNoneExist":   {"Patient": "identifier", "Encounter": "identifier"},
+		"orderResource": {"ORU": "DiagnosticReport", "OUL": "DiagnosticReport", "": "ServiceRequest"},
+		"serviceRequestStatus": {
+			"NW": "active", "OK": "active", "SC": "active", "XO": "active", "RL": "active",
+			"CA": "revoked", "CR": "revoked", "OC": "revoked", "DC": "revoked", "OD": "revoked",
+			"HD": "on-hold", "OH": "on-hold", "CM": "completed", "": "unknown",
+		},
+		"medicationRequestStatus": {
+			"NW": "active", "OK": "active", "SC": "active", "XO": "active", "RL": "active",
+			"CA": "cancelled", "CR": "cancelled", "OC": "cancelled", "DC": "stopped", "OD": "stopped",
+			"HD": "on-hold", "OH": "on-hold", "CM": "completed", "": "unknown",
+		},
+		"diagnosticReportStatus": {
+			"O": "registered", "I": "registered", "S": "partial", "A": "partial", "R": "partial",
+			"P": "preliminary", "C": "corrected", "F": "final", "X": "cancelled", "": "unknown",
+		},
+		"observationStatus": {
+			"I": "registered", "P": "preliminary", "R": "preliminary", "S": "preliminary", "F": "final",
+			"C": "corrected", "X": "cancelled", "D": "entered-in-error", "W": "entered-in-error", "": "unknown",
+		},
+	}
+}
+
+// DefaultCodeSystems returns the FHIR systems of v2 coding systems, CWE.3, and assigning
+// authorities, CX.4. Assigning authorities with an ISO universal id not in the map are OIDs
+func DefaultCodeSystems() map[string]string {
+	return map[string]string{
+		"LN":     "http://loinc.org",
+		"SCT":    "http://snomed.info/sct",
+		"SNM":    "http://snomed.info/sct",
+		"I10":    "http://hl7.org/fhir/sid/icd-10",
+		"I10C":   "http://hl7.org/fhir/sid/icd-10-cm",
+		"I9CDX":  "http://hl7.org/fhir/sid/icd-9-cm",
+		"NDC":    "http://hl7.org/fhir/sid/ndc",
+		"RXNORM": "http://www.nlm.nih.gov/research/umls/rxnorm",
+		"CVX":    "http://hl7.org/fhir/sid/cvx",
+		"UCUM":   systemUCUM,
+		"SSA":    "http://hl7.org/fhir/sid/us-ssn",
+	}
+}
@@ -40,6 +40,15 @@ func (f *Field) String() string {
 	return fmt.Sprintf("\t%v: %v", commons.FieldNames[f.SegName][f.SeqNum], string(f.Value))
 }
 
+// fieldName returns the name of field seq of segment seg in commons.FieldNames, "" when unknown
+func fieldName(seg string, seq int) string {
+	names := commons.FieldNames[seg]
+	if seq < 0 || seq >= len(names) {
+		return ""
+	}
+	return names[seq]
+}
+
 func (f *Field) parse(seps *Delimeters) error {
 	r := strings.NewReader(string(f.Value))
 	i := 0
@@ -60,9 +69,6 @@ func (f *Field) parse(seps *Delimeters) error {
 			cmp.parse(seps)
 			f.Components = append(f.Components, cmp)
 			i = ii
-		case ch == seps.Escape:
-			ii++
-			r.ReadRune()
 		}
 	}
 }
@@ -75,6 +81,18 @@ func (f *Field) encode(seps *Delimeters) []rune {
 	return []rune(string(strings.Join(buf, string(seps.Component))))
 }
 
+// clone returns a deep copy of the field
+func (f *Field) clone() Field {
+	c := Field{SegName: f.SegName, SeqNum: f.SeqNum, Value: cloneRunes(f.Value)}
+	if f.Components != nil {
+		c.Components = make([]Component, len(f.Components))
+		for i := range f.Components {
+			c.Components[i] = f.Components[i].clone()
+		}
+	}
+	return c
+}
+
 // Component returns the component i
 func (f *Field) Component(i int) (*Component, error) {
 	if i > len(f.Components) || i < 1 {
@@ -108,10 +126,13 @@ func (f *Field) getObject(l *Location) (ValueGetter, error) {
 
 // Set will insert a value into a message at Location
 func (f *Field) Set(l *Location, val string, seps *Delimeters) error {
-	loc := l.Comp
-	if loc < 0 {
-		loc = 0
+	if l.Comp < 0 {
+		// the whole field is replaced, components are parsed from val
+		f.Value = []rune(val)
+		f.Components = nil
+		return f.parse(seps)
 	}
+	loc := l.Comp
 	if x := loc - len(f.Components) + 1; x > 0 {
 		f.Components = append(f.Components, make([]Component, x)...)
 	}
@@ -7,11 +7,11 @@ toolchain go1.21.0
 require (
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/net v0.0.0-20190324223953-e3b2ff56ed87
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/text v0.3.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,229 @@
+package golevel7
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Structure defines the segments and segment groups of a message structure
+// A Structure without Children is a segment, one with Children is a group
+// The root Structure is named after the message structure, ORU_R01
+type Structure struct {
+	Name      string       // message structure, group or segment name
+	Required  bool         // the segment or group must be present
+	Repeating bool         // the segment or group may repeat
+	Children  []*Structure // segments and groups of a group, in order
+}
+
+// IsGroup reports if s defines a group of segments
+func (s *Structure) IsGroup() bool {
+	return len(s.Children) != 0
+}
+
+// contains reports if the segment name is part of s or one of its groups
+func (s *Structure) contains(name string) bool {
+	for _, c := range s.Children {
+		if c.Name == name && !c.IsGroup() {
+			return true
+		}
+		if c.IsGroup() && c.contains(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// starts reports if segment name can be the first segment of the group s
+func (s *Structure) starts(name string) bool {
+	for _, c := range s.Children {
+		if c.IsGroup() {
+			if c.starts(name) {
+				return true
+			}
+		} else if c.Name == name {
+			return true
+		}
+		if c.Required {
+			return false
+		}
+	}
+	return false
+}
+
+// Group is an instance of a segment group in a message
+type Group struct {
+	Name     string     // group name, the message structure for the root group
+	Segments []*Segment // segments of the group in message order, including the ones of child groups
+	Groups   []*Group   // child groups in message order
+}
+
+// Group returns the first child group with name
+func (g *Group) Group(name string) (*Group, error) {
+	for _, c := range g.Groups {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("Group %s not found", name)
+}
+
+// AllGroups returns the groups with name found in g and its descendants in message order
+// groups nested inside a matching group are not returned
+func (g *Group) AllGroups(name string) []*Group {
+	groups := []*Group{}
+	for _, c := range g.Groups {
+		if c.Name == name {
+			groups = append(groups, c)
+			continue
+		}
+		groups = append(groups, c.AllGroups(name)...)
+	}
+	return groups
+}
+
+// Segment returns the first segment of the group with name
+func (g *Group) Segment(name string) (*Segment, error) {
+	for _, s := range g.Segments {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("Segment %s not found in group %s", name, g.Name)
+}
+
+// AllSegments returns the segments of the group with name
+func (g *Group) AllSegments(name string) []*Segment {
+	segs := []*Segment{}
+	for _, s := range g.Segments {
+		if s.Name() == name {
+			segs = append(segs, s)
+		}
+	}
+	return segs
+}
+
+// Message returns a message made of the segments of the group
+// the segments are shared with the message the group was parsed from
+func (g *Group) Message(seps *Delimeters) *Message {
+	m := &Message{Delimeters: *seps}
+	for _, s := range g.Segments {
+		m.Segments = append(m.Segments, *s)
+	}
+	m.Value = m.encode()
+	return m
+}
+
+// String returns the group tree with one line per group and segment
+func (g *Group) String() string {
+	var b strings.Builder
+	g.write(&b, "")
+	return b.String()
+}
+
+func (g *Group) write(b *strings.Builder, indent string) {
+	b.WriteString(indent + g.Name + "\n")
+	indent += "  "
+	written := -1
+	for _, s := range g.Segments {
+		if i := g.groupOf(s); i >= 0 {
+			if i != written {
+				g.Groups[i].write(b, indent)
+				written = i
+			}
+			continue
+		}
+		b.WriteString(indent + s.Name() + "\n")
+	}
+}
+
+// groupOf returns the index of the child group holding s, -1 if s is a direct segment
+func (g *Group) groupOf(s *Segment) int {
+	for i, c := range g.Groups {
+		for _, cs := range c.Segments {
+			if cs == s {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Groups parses the message into a tree of segment groups
+// using the Structure registered for its message type, see LookupStructure
+func (m *Message) Groups() (*Group, error) {
+	msgType, _ := m.Find("MSH.9")
+	s, err := LookupStructure(msgType)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGroups(m, s)
+}
+
+// ParseGroups parses the segments of m into a tree of groups defined by s
+// Segments which are not part of s, like Z segments, belong to the group of the
+// segment before them. An error is returned if a segment is out of place or a required
+// segment or group is missing
+func ParseGroups(m *Message, s *Structure) (*Group, error) {
+	segs := make([]*Segment, len(m.Segments))
+	for i := range m.Segments {
+		segs[i] = &m.Segments[i]
+	}
+	root := &Group{Name: s.Name}
+	pos, err := matchGroup(s, s, segs, 0, root)
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(segs) {
+		return nil, fmt.Errorf("Segment %s (%d) is not allowed here by %s", segs[pos].Name(), pos, s.Name)
+	}
+	return root, nil
+}
+
+// matchGroup matches the children of def against segs starting at pos
+// the matched segments and groups are added to g and the next position is returned
+func matchGroup(root, def *Structure, segs []*Segment, pos int, g *Group) (int, error) {
+	for _, c := range def.Children {
+		matched := 0
+		for pos < len(segs) {
+			if !c.IsGroup() {
+				if segs[pos].Name() != c.Name {
+					break
+				}
+				g.Segments = append(g.Segments, segs[pos])
+				pos++
+				// unknown segments follow the segment they come after
+				for pos < len(segs) && !root.contains(segs[pos].Name()) {
+					g.Segments = append(g.Segments, segs[pos])
+					pos++
+				}
+			} else {
+				if !c.starts(segs[pos].Name()) {
+					break
+				}
+				sub := &Group{Name: c.Name}
+				next, err := matchGroup(root, c, segs, pos, sub)
+				if err != nil {
+					return pos, err
+				}
+				if next == pos {
+					break
+				}
+				g.Segments = append(g.Segments, sub.Segments...)
+				g.Groups = append(g.Groups, sub)
+				pos = next
+			}
+			matched++
+			if !c.Repeating {
+				break
+			}
+		}
+		if c.Required && matched == 0 {
+			kind := "Segment"
+			if c.IsGroup() {
+				kind = "Group"
+			}
+			return pos, fmt.Errorf("%s %s required by %s is missing (%d)", kind, c.Name, def.Name, pos)
+		}
+	}
+	return pos, nil
+}
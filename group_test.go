@@ -0,0 +1,189 @@
+package golevel7
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const groupMsg = "MSH|^~\\&|LAB|PA|EPIC|IHS|20050615230600||ORU^R01|1|P|2.5\r" +
+	"PID|1||12001||Jones^John\r" +
+	"PV1|1|I\r" +
+	"ORC|RE\r" +
+	"OBR|1|||CBC^HEMOGRAM\r" +
+	"NTE|1||order note\r" +
+	"OBX|1|NM|WBC||14.3\r" +
+	"NTE|1||wbc note\r" +
+	"ZXX|custom\r" +
+	"OBX|2|NM|RBC||3.81\r" +
+	"OBR|2|||LIPID^LIPID PANEL\r" +
+	"OBX|1|NM|LDL||49\r" +
+	"NTE|1||ldl note 1\r" +
+	"NTE|2||ldl note 2"
+
+func TestGroups(t *testing.T) {
+	msg, err := ParseMessage([]byte(groupMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := msg.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ORU_R01", root.Name)
+	assert.Equal(t, len(msg.Segments), len(root.Segments))
+
+	results := root.AllGroups("PATIENT_RESULT")
+	if !assert.Equal(t, 1, len(results)) {
+		return
+	}
+	patient, err := results[0].Group("PATIENT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"PID", "PV1"}, groupSegmentNames(patient))
+
+	orders := results[0].AllGroups("ORDER_OBSERVATION")
+	if !assert.Equal(t, 2, len(orders)) {
+		return
+	}
+	assert.Equal(t, []string{"ORC", "OBR", "NTE", "OBX", "NTE", "ZXX", "OBX"}, groupSegmentNames(orders[0]))
+	obs := orders[0].AllGroups("OBSERVATION")
+	if assert.Equal(t, 2, len(obs)) {
+		assert.Equal(t, []string{"OBX", "NTE", "ZXX"}, groupSegmentNames(obs[0]))
+		assert.Equal(t, []string{"OBX"}, groupSegmentNames(obs[1]))
+	}
+	assert.Equal(t, 3, len(root.AllGroups("OBSERVATION")))
+	_, err = orders[1].Group("TIMING_QTY")
+	assert.Error(t, err)
+	if obr, err := orders[0].Segment("OBR"); assert.NoError(t, err) {
+		assert.Equal(t, "OBR", obr.Name())
+	}
+	_, err = orders[1].Segment("PID")
+	assert.EqualError(t, err, "Segment PID not found in group ORDER_OBSERVATION")
+
+	want := "ORU_R01\n" +
+		"  MSH\n" +
+		"  PATIENT_RESULT\n" +
+		"    PATIENT\n" +
+		"      PID\n" +
+		"      VISIT\n" +
+		"        PV1\n" +
+		"    ORDER_OBSERVATION\n" +
+		"      ORC\n" +
+		"      OBR\n" +
+		"      NTE\n" +
+		"      OBSERVATION\n" +
+		"        OBX\n" +
+		"        NTE\n" +
+		"        ZXX\n" +
+		"      OBSERVATION\n" +
+		"        OBX\n" +
+		"    ORDER_OBSERVATION\n" +
+		"      OBR\n" +
+		"      OBSERVATION\n" +
+		"        OBX\n" +
+		"        NTE\n" +
+		"        NTE\n"
+	assert.Equal(t, want, root.String())
+}
+
+func TestGroupsErrors(t *testing.T) {
+	msg, err := ParseMessage([]byte("MSH|^~\\&|A||||||ORU^R01|1|P|2.5\rOBR|1\rOBX|1\rPV1|1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = msg.Groups()
+	assert.Error(t, err)
+
+	// required segments and groups
+	for data, want := range map[string]string{
+		"PID|1\rORC|RE\rOBX|1": "Segment OBR required by ORDER_OBSERVATION is missing (3)",
+		"PID|1\rPV1|1":         "Group ORDER_OBSERVATION required by PATIENT_RESULT is missing (3)",
+		"":                     "Group PATIENT_RESULT required by ORU_R01 is missing (1)",
+	} {
+		msg, err = ParseMessage([]byte("MSH|^~\\&|A||||||ORU^R01|1|P|2.5\r" + data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = msg.Groups()
+		assert.EqualError(t, err, want, data)
+	}
+
+	msg, err = ParseMessage([]byte("MSH|^~\\&|A||||||ZZZ^Z01|1|P|2.5\rPID|1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = msg.Groups()
+	assert.Error(t, err)
+
+	s, err := LookupStructure("ADT^A08^ADT_A01")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ADT_A01", s.Name)
+	}
+	s, err = LookupStructure("ADT^A04")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ADT_A01", s.Name)
+	}
+}
+
+func TestUnmarshalGroups(t *testing.T) {
+	msg, err := ParseMessage([]byte(groupMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type observation struct {
+		SetID int      `hl7:"OBX.1"`
+		Code  string   `hl7:"OBX.3"`
+		Value float64  `hl7:"OBX.5"`
+		Notes []string `hl7:"NTE.3"`
+	}
+	type order struct {
+		Service      string        `hl7:"OBR.4.1"`
+		Notes        []string      `hl7:"NTE.3"`
+		Observations []observation `hl7:"OBSERVATION"`
+	}
+	type result struct {
+		Patient struct {
+			ID       string `hl7:"PID.3"`
+			Location string `hl7:"PV1.2"`
+		} `hl7:"PATIENT"`
+		Orders []order `hl7:"ORDER_OBSERVATION"`
+	}
+	st := struct {
+		ControlID string   `hl7:"MSH.10"`
+		Results   []result `hl7:"PATIENT_RESULT"`
+	}{}
+	if err := msg.Unmarshal(&st); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "1", st.ControlID)
+	if !assert.Equal(t, 1, len(st.Results)) {
+		return
+	}
+	res := st.Results[0]
+	assert.Equal(t, "12001", res.Patient.ID)
+	assert.Equal(t, "I", res.Patient.Location)
+	if !assert.Equal(t, 2, len(res.Orders)) {
+		return
+	}
+	assert.Equal(t, "CBC", res.Orders[0].Service)
+	assert.Equal(t, []observation{
+		{SetID: 1, Code: "WBC", Value: 14.3, Notes: []string{"wbc note"}},
+		{SetID: 2, Code: "RBC", Value: 3.81, Notes: []string{}},
+	}, res.Orders[0].Observations)
+	assert.Equal(t, "LIPID", res.Orders[1].Service)
+	assert.Equal(t, []observation{
+		{SetID: 1, Code: "LDL", Value: 49, Notes: []string{"ldl note 1", "ldl note 2"}},
+	}, res.Orders[1].Observations)
+	// NTE.3 of an order holds its own and its observations notes
+	assert.Equal(t, []string{"order note", "wbc note"}, res.Orders[0].Notes)
+}
+
+func groupSegmentNames(g *Group) []string {
+	names := []string{}
+	for _, s := range g.Segments {
+		names = append(names, s.Name())
+	}
+	return names
+}
@@ -0,0 +1,217 @@
+package golevel7
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrorCode is an HL7 error code from table 0357
+type ErrorCode int
+
+// ErrorCode values of table 0357
+const (
+	ErrCodeAccepted             ErrorCode = 0
+	ErrCodeSegmentSequence      ErrorCode = 100
+	ErrCodeRequiredFieldMissing ErrorCode = 101
+	ErrCodeDataType             ErrorCode = 102
+	ErrCodeTableValueNotFound   ErrorCode = 103
+	ErrCodeValueTooLong         ErrorCode = 104
+	ErrCodeApplicationError     ErrorCode = 199 // other error, not a reject
+	ErrCodeUnsupportedMsgType   ErrorCode = 200
+	ErrCodeUnsupportedEvent     ErrorCode = 201
+	ErrCodeUnsupportedProcID    ErrorCode = 202
+	ErrCodeUnsupportedVersion   ErrorCode = 203
+	ErrCodeUnknownKey           ErrorCode = 204
+	ErrCodeDuplicateKey         ErrorCode = 205
+	ErrCodeRecordLocked         ErrorCode = 206
+	ErrCodeInternal             ErrorCode = 207
+)
+
+var errorCodeText = map[ErrorCode]string{
+	ErrCodeAccepted:             "Message accepted",
+	ErrCodeSegmentSequence:      "Segment sequence error",
+	ErrCodeRequiredFieldMissing: "Required field missing",
+	ErrCodeDataType:             "Data type error",
+	ErrCodeTableValueNotFound:   "Table value not found",
+	ErrCodeValueTooLong:         "Value too long",
+	ErrCodeApplicationError:     "Other error",
+	ErrCodeUnsupportedMsgType:   "Unsupported message type",
+	ErrCodeUnsupportedEvent:     "Unsupported event code",
+	ErrCodeUnsupportedProcID:    "Unsupported processing id",
+	ErrCodeUnsupportedVersion:   "Unsupported version id",
+	ErrCodeUnknownKey:           "Unknown key identifier",
+	ErrCodeDuplicateKey:         "Duplicate key identifier",
+	ErrCodeRecordLocked:         "Application record locked",
+	ErrCodeInternal:             "Application internal error",
+}
+
+// Text returns the description of the code in table 0357
+func (c ErrorCode) Text() string {
+	return errorCodeText[c]
+}
+
+// IsReject reports if the code rejects the message for reasons unrelated to its content,
+// unsupported message type, event, processing id or version and internal errors
+func (c ErrorCode) IsReject() bool {
+	return (c >= ErrCodeUnsupportedMsgType && c <= ErrCodeUnsupportedVersion) || c == ErrCodeInternal
+}
+
+// Severity is the severity of an HL7 error from table 0516
+type Severity string
+
+// Severity values of table 0516
+const (
+	SeverityError   Severity = "E"
+	SeverityWarning Severity = "W"
+	SeverityInfo    Severity = "I"
+)
+
+// HL7Error is an error reported back to the sender in an ERR segment
+type HL7Error struct {
+	Location *Location // location of the error in the message, can be nil
+	Code     ErrorCode // HL7 error code, table 0357
+	Severity Severity  // defaults to SeverityError
+	Message  string    // user message
+}
+
+// NewHL7Error returns an HL7Error with severity E for the location loc
+func NewHL7Error(loc string, code ErrorCode, format string, args ...interface{}) *HL7Error {
+	e := &HL7Error{Code: code, Severity: SeverityError, Message: fmt.Sprintf(format, args...)}
+	if loc != "" {
+		e.Location = NewLocation(loc)
+	}
+	return e
+}
+
+func (e *HL7Error) Error() string {
+	str := fmt.Sprintf("hl7: %d %s", e.Code, e.Code.Text())
+	if e.Location != nil {
+		str += " at " + e.Location.String()
+	}
+	if e.Message != "" {
+		str += ": " + e.Message
+	}
+	return str
+}
+
+// severity returns the severity, SeverityError when not set
+func (e *HL7Error) severity() Severity {
+	if e.Severity == "" {
+		return SeverityError
+	}
+	return e.Severity
+}
+
+// HL7Errors is a list of HL7Error reported in one acknowledgement
+type HL7Errors []*HL7Error
+
+func (e HL7Errors) Error() string {
+	strs := make([]string, len(e))
+	for i := range e {
+		strs[i] = e[i].Error()
+	}
+	return strings.Join(strs, "; ")
+}
+
+// toHL7Errors converts err into the HL7 errors to report
+// *HL7Error and HL7Errors are used as is, a *ValidationReport gives one error per
+// violation, parse errors become data type errors
+// and other errors application errors, ErrCodeApplicationError
+func toHL7Errors(err error) HL7Errors {
+	if err == nil {
+		return nil
+	}
+	var errs HL7Errors
+	if errors.As(err, &errs) {
+		return errs
+	}
+	var herr *HL7Error
+	if errors.As(err, &herr) {
+		return HL7Errors{herr}
+	}
+	var report *ValidationReport
+	if errors.As(err, &report) {
+		return report.HL7Errors()
+	}
+	var perrs ParseErrors
+	if errors.As(err, &perrs) {
+		for _, pe := range perrs {
+			errs = append(errs, parseHL7Error(pe))
+		}
+		return errs
+	}
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		return HL7Errors{parseHL7Error(perr)}
+	}
+	return HL7Errors{{Code: ErrCodeApplicationError, Severity: SeverityError, Message: err.Error()}}
+}
+
+// parseHL7Error returns the HL7Error reporting the parse error pe
+func parseHL7Error(pe *ParseError) *HL7Error {
+	e := &HL7Error{Code: ErrCodeDataType, Severity: SeverityError, Message: pe.Err.Error()}
+	if pe.SegmentName != "" {
+		e.Location = &Location{Segment: pe.SegmentName, FieldSeq: pe.FieldSeq, Comp: -1, SubComp: -1}
+		if pe.FieldSeq <= 0 {
+			e.Code = ErrCodeSegmentSequence
+			e.Location.FieldSeq = -1
+		}
+	}
+	return e
+}
+
+// errFields returns the raw values of ERR-1, ERR-2, ERR-3, ERR-4 and ERR-8 for e
+func (e *HL7Error) errFields(seps *Delimeters) map[int]string {
+	comp := func(vals ...string) string {
+		for i := range vals {
+			vals[i] = Escape(vals[i], seps)
+		}
+		for len(vals) > 0 && vals[len(vals)-1] == "" {
+			vals = vals[:len(vals)-1]
+		}
+		return strings.Join(vals, string(seps.Component))
+	}
+	sub := func(vals ...string) string {
+		for i := range vals {
+			vals[i] = Escape(vals[i], seps)
+		}
+		return strings.Join(vals, string(seps.SubComponent))
+	}
+	num := func(i int) string {
+		if i < 0 {
+			return ""
+		}
+		return strconv.Itoa(i)
+	}
+	atLeastOne := func(i int) int {
+		if i < 1 {
+			return 1
+		}
+		return i
+	}
+
+	code := strconv.Itoa(int(e.Code))
+	flds := map[int]string{
+		3: comp(code, e.Code.Text(), "HL70357"),
+		4: string(e.severity()),
+		8: Escape(e.Message, seps),
+	}
+	if l := e.Location; l != nil {
+		// ERR-1 ELD, kept for receivers before version 2.5
+		flds[1] = strings.Join([]string{
+			Escape(l.Segment, seps),
+			strconv.Itoa(atLeastOne(l.SegIdx)),
+			num(l.FieldSeq),
+			sub(code, e.Code.Text(), "HL70357"),
+		}, string(seps.Component))
+		// ERR-2 ERL
+		erl := []string{l.Segment, strconv.Itoa(atLeastOne(l.SegIdx))}
+		if l.FieldSeq >= 0 {
+			erl = append(erl, num(l.FieldSeq), strconv.Itoa(atLeastOne(l.FieldRep)), num(l.Comp), num(l.SubComp))
+		}
+		flds[2] = comp(erl...)
+	}
+	return flds
+}
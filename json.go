@@ -0,0 +1,259 @@
+package golevel7
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonMessage is the JSON shape of a Message
+type jsonMessage struct {
+	Segments []jsonSegment `json:"segments"`
+}
+
+// jsonSegment is the JSON shape of a Segment, fields are keyed by sequence number
+type jsonSegment struct {
+	Name   string     `json:"name"`
+	Fields jsonFields `json:"fields"`
+}
+
+// jsonFields are the fields of a segment in sequence number order
+type jsonFields []jsonField
+
+// jsonField is the list of repetitions of a field, each one is a string
+// or an array of components which are a string or an array of subcomponents
+type jsonField struct {
+	seq  int
+	reps []interface{}
+}
+
+// MarshalJSON encodes the message as JSON, it implements json.Marshaler
+//
+//	{"segments": [
+//	  {"name": "MSH", "fields": {"1": ["|"], "2": ["^~\\&"], "9": [["ORU", "R01"]], "10": ["1"]}},
+//	  {"name": "PID", "fields": {"3": [["1", "", "", "MRN"], ["2"]], "5": [["Jones", "John"]], "8": ["M"]}}
+//	]}
+//
+// Segments are in message order with their fields keyed by sequence number, in order. A field is
+// an array of repetitions, a repetition with one component and no subcomponents is a string,
+// otherwise an array of components. A component with one subcomponent is a string, otherwise an
+// array of subcomponents, &a is [["", "a"]]
+// Values are decoded like Get does, MSH.1 and MSH.2 are the delimeters as is. Empty fields are
+// left out unless they are the last of the segment, which keeps the trailing delimeters
+// The names of the fields are in commons.FieldNames
+func (m *Message) MarshalJSON() ([]byte, error) {
+	jm := jsonMessage{Segments: make([]jsonSegment, len(m.Segments))}
+	for i := range m.Segments {
+		s := &m.Segments[i]
+		js := jsonSegment{Name: s.Name(), Fields: jsonFields{}}
+		fields, first := s.rawFields(&m.Delimeters)
+		if first == 2 {
+			js.Fields = append(js.Fields,
+				jsonField{seq: 1, reps: []interface{}{string(m.Delimeters.Field)}},
+				jsonField{seq: 2, reps: []interface{}{fields[0]}})
+			fields = fields[1:]
+			first = 3
+		}
+		for j, f := range fields {
+			if f == "" && j < len(fields)-1 {
+				continue
+			}
+			jf := jsonField{seq: first + j}
+			for _, rep := range strings.Split(f, string(m.Delimeters.Repetition)) {
+				jf.reps = append(jf.reps, m.jsonRepetition(rep))
+			}
+			js.Fields = append(js.Fields, jf)
+		}
+		jm.Segments[i] = js
+	}
+	return json.Marshal(jm)
+}
+
+// jsonRepetition returns the JSON value of the encoded field repetition v
+func (m *Message) jsonRepetition(v string) interface{} {
+	comps := strings.Split(v, string(m.Delimeters.Component))
+	vals := make([]interface{}, len(comps))
+	for i, c := range comps {
+		subs := strings.Split(c, string(m.Delimeters.SubComponent))
+		if len(subs) == 1 {
+			vals[i] = Unescape(c, &m.Delimeters)
+			continue
+		}
+		for j := range subs {
+			subs[j] = Unescape(subs[j], &m.Delimeters)
+		}
+		vals[i] = subs
+	}
+	// a single component is a string, unless it has subcomponents which would be
+	// read back as components
+	if _, ok := vals[0].(string); ok && len(vals) == 1 {
+		return vals[0]
+	}
+	return vals
+}
+
+// UnmarshalJSON decodes a message encoded by MarshalJSON, it implements json.Unmarshaler
+// The message is built in ER7 with the delimeters of MSH.1 and MSH.2, the default ones
+// when they are missing, and parsed. Values are escaped like Set does, escape sequences
+// which Get leaves as is, like \H\, are kept
+func (m *Message) UnmarshalJSON(data []byte) error {
+	jm := jsonMessage{}
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return err
+	}
+	if len(jm.Segments) == 0 || jm.Segments[0].Name != "MSH" {
+		return fmt.Errorf("Invalid message: Missing MSH segment")
+	}
+	def := NewDelimeters()
+	msh1, msh2 := string(def.Field), def.DelimeterField
+	for _, f := range jm.Segments[0].Fields {
+		if s, ok := f.first(); ok && f.seq == 1 {
+			msh1 = s
+		} else if ok && f.seq == 2 {
+			msh2 = s
+		}
+	}
+	seps, err := parseDelimeters([]byte("MSH" + msh1 + msh2 + msh1))
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, js := range jm.Segments {
+		if !isSegmentName([]rune(js.Name)) {
+			return fmt.Errorf("Invalid segment name %q", js.Name)
+		}
+		fields := map[int][]string{}
+		for _, f := range js.Fields {
+			if js.Name == "MSH" && f.seq <= 2 {
+				continue
+			}
+			for _, rep := range f.reps {
+				v, err := jsonValue(rep, &seps, fieldLevel)
+				if err != nil {
+					return fmt.Errorf("%s.%d: %v", js.Name, f.seq, err)
+				}
+				fields[f.seq] = append(fields[f.seq], v)
+			}
+			if len(f.reps) == 0 {
+				fields[f.seq] = nil
+			}
+		}
+		writeSegment(&b, js.Name, fields, &seps)
+		b.WriteRune(segTerm)
+	}
+	msg := &Message{Value: []rune(b.String())}
+	if err := msg.parse(); err != nil {
+		return err
+	}
+	*m = *msg
+	return nil
+}
+
+// first returns the first repetition of the field if it is a string
+func (f jsonField) first() (string, bool) {
+	if len(f.reps) == 0 {
+		return "", false
+	}
+	s, ok := f.reps[0].(string)
+	return s, ok
+}
+
+// jsonValue returns the encoded value of a repetition, component or subcomponent at level
+func jsonValue(v interface{}, seps *Delimeters, level int) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return escapeJSON(v, seps), nil
+	case nil:
+		return "", nil
+	case []interface{}:
+		if level == subComponentLevel {
+			return "", fmt.Errorf("subcomponents can not be arrays")
+		}
+		sep := seps.Component
+		if level == componentLevel {
+			sep = seps.SubComponent
+		}
+		parts := make([]string, len(v))
+		for i := range v {
+			p, err := jsonValue(v[i], seps, level+1)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = p
+		}
+		return strings.Join(parts, string(sep)), nil
+	}
+	return "", fmt.Errorf("invalid value %v", v)
+}
+
+// escapeJSON escapes the decoded value v keeping the escape sequences Unescape leaves as is
+func escapeJSON(v string, seps *Delimeters) string {
+	esc := seps.Escape
+	if esc == 0 || !strings.ContainsRune(v, esc) {
+		return Escape(v, seps)
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexRune(v, esc)
+		if i < 0 {
+			break
+		}
+		rest := v[i+utf8.RuneLen(esc):]
+		j := strings.IndexRune(rest, esc)
+		if j < 0 {
+			break
+		}
+		if _, decoded := unescapeSeq(rest[:j], seps); decoded || rest[:j] == "" {
+			b.WriteString(Escape(v[:i+utf8.RuneLen(esc)], seps))
+			v = rest
+			continue
+		}
+		end := i + utf8.RuneLen(esc) + j + utf8.RuneLen(esc)
+		b.WriteString(Escape(v[:i], seps))
+		b.WriteString(v[i:end])
+		v = v[end:]
+	}
+	b.WriteString(Escape(v, seps))
+	return b.String()
+}
+
+// MarshalJSON encodes the fields as an object keyed by sequence number, in order
+func (fs jsonFields) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range fs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v, err := json.Marshal(f.reps)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(`"` + strconv.Itoa(f.seq) + `":`)
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// UnmarshalJSON decodes the fields object
+func (fs *jsonFields) UnmarshalJSON(data []byte) error {
+	obj := map[string][]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*fs = jsonFields{}
+	for k, reps := range obj {
+		seq, err := strconv.Atoi(k)
+		if err != nil || seq < 1 {
+			return fmt.Errorf("Invalid field sequence number %q", k)
+		}
+		*fs = append(*fs, jsonField{seq: seq, reps: reps})
+	}
+	sort.Slice(*fs, func(i, j int) bool { return (*fs)[i].seq < (*fs)[j].seq })
+	return nil
+}
@@ -0,0 +1,120 @@
+package golevel7
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageJSON(t *testing.T) {
+	data := "MSH|^~\\&|LAB|PA|||20050615230600||ORU^R01|1|T|2.5\r" +
+		"PID|1||1058299^^^HMRN~555||JONES^JOHN^A&B||||||1 MAIN ST\\F\\B\r" +
+		"OBX|1|TX|NOTE||line one\\.br\\two \\H\\bold\\N\\|\r" +
+		"ZPI|a||\r"
+	msg, err := ParseMessage([]byte(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := json.Marshal(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `{"segments":[`+
+		`{"name":"MSH","fields":{"1":["|"],"2":["^~\\\u0026"],"3":["LAB"],"4":["PA"],"7":["20050615230600"],"9":[["ORU","R01"]],"10":["1"],"11":["T"],"12":["2.5"]}},`+
+		`{"name":"PID","fields":{"1":["1"],"3":[["1058299","","","HMRN"],"555"],"5":[["JONES","JOHN",["A","B"]]],"11":["1 MAIN ST|B"]}},`+
+		`{"name":"OBX","fields":{"1":["1"],"2":["TX"],"3":["NOTE"],"5":["line one\ntwo \\H\\bold\\N\\"],"6":[""]}},`+
+		`{"name":"ZPI","fields":{"1":["a"],"3":[""]}}]}`, string(out))
+
+	back := &Message{}
+	if assert.NoError(t, json.Unmarshal(out, back)) {
+		assert.Equal(t, data, string(back.Encode()))
+	}
+
+	// named keys are not sequence numbers
+	assert.Error(t, json.Unmarshal([]byte(`{"segments":[{"name":"MSH","fields":{"x":["1"]}}]}`), back))
+	assert.Error(t, json.Unmarshal([]byte(`{"segments":[{"name":"PID","fields":{}}]}`), back))
+}
+
+func TestMessageJSONBuild(t *testing.T) {
+	// the delimeters default to the usual ones and values are escaped
+	doc := `{"segments":[
+		{"name":"MSH","fields":{"9":[["ADT","A01"]],"10":["42"]}},
+		{"name":"PID","fields":{"3":[["1",null,null,"MRN"]],"5":[["O^Brien","Pat"]]}}
+	]}`
+	msg := &Message{}
+	if !assert.NoError(t, json.Unmarshal([]byte(doc), msg)) {
+		return
+	}
+	assert.Equal(t, "MSH|^~\\&|||||||ADT^A01|42\rPID|||1^^^MRN||O\\S\\Brien^Pat\r", string(msg.Encode()))
+	v, _ := msg.Find("PID.5.1")
+	assert.Equal(t, "O^Brien", v)
+}
+
+func TestMessageJSONRoundTrip(t *testing.T) {
+	for _, fname := range []string{"msg.hl7", "msg2.hl7", "msg3.hl7", "msg4.hl7", "msg5.hl7", "msg6.hl7", "epic-oru-r01.hl7"} {
+		data, err := os.ReadFile("./testdata/" + fname)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		msg, err := ParseMessage(data)
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		out, err := json.Marshal(msg)
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		// values are the same, line breaks in values are encoded as \.br\
+		back := &Message{}
+		if assert.NoError(t, json.Unmarshal(out, back), fname) {
+			again, _ := json.Marshal(back)
+			assert.Equal(t, string(out), string(again), fname)
+		}
+	}
+}
+
+func TestMessageJSONToER7(t *testing.T) {
+	// subcomponents only, repetitions of them and escape sequences come back as they were
+	data := "MSH|^~\\&|LAB|PA|||20050615230600||ORU^R01|1|T|2.5\r" +
+		"ZZZ|1|&a|a&b^c|&a~b&|^&x\r" +
+		"ZZE|\\F\\\\S\\\\T\\\\R\\\\E\\|x\\.br\\y|\\H\\bold\\N\\|\\Zcustom\\&\\T\\\r"
+	msg, err := ParseMessage([]byte(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := json.Marshal(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	back := &Message{}
+	if assert.NoError(t, json.Unmarshal(out, back)) {
+		assert.Equal(t, data, string(back.Encode()))
+	}
+
+	for _, fname := range []string{"msg.hl7", "msg2.hl7", "msg3.hl7", "msg4.hl7", "msg5.hl7", "msg6.hl7", "epic-oru-r01.hl7"} {
+		data, err := os.ReadFile("./testdata/" + fname)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		msg, err := ParseMessage(data)
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		out, err := json.Marshal(msg)
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		back := &Message{}
+		if !assert.NoError(t, json.Unmarshal(out, back), fname) {
+			continue
+		}
+		// the JSON shape has no trailing line breaks and line breaks in values are
+		// escaped as \.br\ in ER7
+		want := strings.TrimRight(string(msg.Encode()), "\r\n")
+		want = strings.ReplaceAll(want, "\n", "\\.br\\")
+		assert.Equal(t, want+"\r", string(back.Encode()), fname)
+	}
+}
@@ -1,6 +1,7 @@
 package golevel7
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -8,18 +9,24 @@ import (
 /**
 Location syntax
 
-// loc uses the format segment.field.component.subcomponent
+// loc uses the format segment[occurrence].field[repetition].component.subcomponent
 // loc == "" returns the message
 // loc == "MSH" returns the MSH segment
 // loc == "MSH.2" returns the second field of the MSH segment
+// loc == "OBX[3].5" returns the fifth field of the third OBX segment
+// loc == "PID.3[2].1" returns the first component of the second repetition of PID.3
 // etc
+// occurrences and repetitions are 1 based, when left out the first one is
+// used by Get and all of them by GetAll
 
 **/
 
 // Location specifies a value or values in an Message
 type Location struct {
 	Segment  string
+	SegIdx   int // segment occurrence, 1 based, 0 means not specified
 	FieldSeq int
+	FieldRep int // field repetition, 1 based, 0 means not specified
 	Comp     int
 	SubComp  int
 }
@@ -30,11 +37,13 @@ func NewLocation(l string) *Location {
 	loc := Location{FieldSeq: -1, Comp: -1, SubComp: -1}
 	lenLA := len(la)
 	if lenLA > 0 {
-		loc.Segment = la[0]
+		loc.Segment, loc.SegIdx = splitIndex(la[0])
 	}
 	if lenLA > 1 {
-		if i, err := strconv.Atoi(la[1]); err == nil {
+		fld, rep := splitIndex(la[1])
+		if i, err := strconv.Atoi(fld); err == nil {
 			loc.FieldSeq = i
+			loc.FieldRep = rep
 		}
 	}
 	if lenLA > 2 {
@@ -51,11 +60,39 @@ func NewLocation(l string) *Location {
 	return &loc
 }
 
-// mshOffset used just for building messages. Since the field seperator is used
-// in the MSH seg 1 building messages gets confused about locations
-func mshOffset(l *Location) *Location {
-	if l.Segment == "MSH" && l.FieldSeq > 2 {
-		l.FieldSeq--
+// splitIndex splits a location part like OBX[3] into its name and index
+// the index is 0 if not present or invalid
+func splitIndex(part string) (string, int) {
+	open := strings.IndexByte(part, '[')
+	if open < 0 || !strings.HasSuffix(part, "]") {
+		return part, 0
 	}
-	return l
+	i, err := strconv.Atoi(part[open+1 : len(part)-1])
+	if err != nil || i < 0 {
+		return part[:open], 0
+	}
+	return part[:open], i
+}
+
+// String returns the location in location string syntax
+func (l *Location) String() string {
+	str := l.Segment
+	if l.SegIdx > 0 {
+		str += fmt.Sprintf("[%d]", l.SegIdx)
+	}
+	if l.FieldSeq < 0 {
+		return str
+	}
+	str += fmt.Sprintf(".%d", l.FieldSeq)
+	if l.FieldRep > 0 {
+		str += fmt.Sprintf("[%d]", l.FieldRep)
+	}
+	if l.Comp < 0 {
+		return str
+	}
+	str += fmt.Sprintf(".%d", l.Comp)
+	if l.SubComp < 0 {
+		return str
+	}
+	return str + fmt.Sprintf(".%d", l.SubComp)
 }
@@ -0,0 +1,225 @@
+package golevel7
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshaler is the interface implemented by types that can decode
+// themselves from an HL7 field, component or subcomponent
+// It is called by Unmarshal and ToStruct for non empty values
+type Unmarshaler interface {
+	UnmarshalHL7(e *Element) error
+}
+
+// Marshaler is the interface implemented by types that can encode
+// themselves into an HL7 field, component or subcomponent
+// It is called by Marshal
+type Marshaler interface {
+	MarshalHL7(e *Element) error
+}
+
+var (
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+)
+
+// Element is the HL7 value handed to Marshaler and Unmarshaler implementations
+type Element struct {
+	Raw        string      // value as encoded in the message
+	Source     ValueGetter // the *Field, *Component or *SubComponent read from, nil for Marshal
+	Delimeters *Delimeters // delimeters of the message
+	level      int
+}
+
+// newElement returns the Element for the value of obj
+func newElement(obj ValueGetter, seps *Delimeters) *Element {
+	e := &Element{Source: obj, Delimeters: seps}
+	switch v := obj.(type) {
+	case *Field:
+		e.Raw = string(v.Value)
+		e.level = fieldLevel
+	case *Component:
+		e.Raw = string(v.Value)
+		e.level = componentLevel
+	case *SubComponent:
+		e.Raw = string(v.Value)
+		e.level = subComponentLevel
+	case SubComponent:
+		e.Raw = string(v.Value)
+		e.level = subComponentLevel
+	default:
+		e.Raw, _ = obj.Get(&Location{FieldSeq: -1, Comp: -1, SubComp: -1})
+	}
+	return e
+}
+
+// String returns the value with its escape sequences decoded
+func (e *Element) String() string {
+	return Unescape(e.Raw, e.Delimeters)
+}
+
+// Parts returns the decoded components of a field or the decoded
+// subcomponents of a component. A subcomponent has a single part
+func (e *Element) Parts() []string {
+	sep, ok := e.partSep()
+	if !ok {
+		return []string{e.String()}
+	}
+	parts := strings.Split(e.Raw, string(sep))
+	for i := range parts {
+		parts[i] = Unescape(parts[i], e.Delimeters)
+	}
+	return parts
+}
+
+// Part returns the decoded part i (1 based), see Parts
+// it returns "" if the part does not exist
+func (e *Element) Part(i int) string {
+	parts := e.Parts()
+	if i < 1 || i > len(parts) {
+		return ""
+	}
+	return parts[i-1]
+}
+
+// SetString sets the value to v, escaping delimeters
+func (e *Element) SetString(v string) {
+	e.Raw = Escape(v, e.Delimeters)
+}
+
+// SetParts sets the components of a field or the subcomponents of a component
+// each part is escaped, trailing empty parts are dropped
+func (e *Element) SetParts(parts ...string) {
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	sep, ok := e.partSep()
+	if !ok {
+		e.SetString(strings.Join(parts, ""))
+		return
+	}
+	escaped := make([]string, len(parts))
+	for i := range parts {
+		escaped[i] = Escape(parts[i], e.Delimeters)
+	}
+	e.Raw = strings.Join(escaped, string(sep))
+}
+
+// partSep returns the delimeter separating the parts of the element
+func (e *Element) partSep() (rune, bool) {
+	switch e.level {
+	case fieldLevel:
+		return e.Delimeters.Component, true
+	case componentLevel:
+		return e.Delimeters.SubComponent, true
+	}
+	return 0, false
+}
+
+// objectAt returns the element of obj at Location l
+func objectAt(obj ValueGetter, l *Location) (ValueGetter, error) {
+	switch v := obj.(type) {
+	case *Message:
+		objs, err := v.getObjects(l)
+		if err != nil || len(objs) == 0 {
+			return nil, fmt.Errorf("%v not found", l)
+		}
+		return objs[0], nil
+	case *Segment:
+		objs, err := v.getObjects(l)
+		if err != nil || len(objs) == 0 {
+			return nil, fmt.Errorf("%v not found", l)
+		}
+		return objs[0], nil
+	case *Field:
+		return v.getObject(l)
+	case *Component:
+		return v.getObject(l)
+	}
+	return obj, nil
+}
+
+// lastIndex returns the number after the last . of an hl7 tag, -1 if there is none
+func lastIndex(tag string) int {
+	parts := strings.Split(tag, ".")
+	i, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// implementsUnmarshaler reports if t or a pointer to t implements Unmarshaler
+func implementsUnmarshaler(t reflect.Type) bool {
+	return t.Implements(unmarshalerType) || reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// implementsMarshaler reports if t or a pointer to t implements Marshaler
+func implementsMarshaler(t reflect.Type) bool {
+	return t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType)
+}
+
+// unmarshalElement decodes the value of obj into v using its Unmarshaler
+// empty values leave v untouched
+func unmarshalElement(v reflect.Value, obj ValueGetter, seps *Delimeters) error {
+	e := newElement(obj, seps)
+	if e.Raw == "" {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr && !v.Type().Implements(unmarshalerType) {
+		// pointer to a value type implementing Unmarshaler, decode into the value
+		ptr := reflect.New(v.Type().Elem())
+		if err := unmarshalElement(ptr.Elem(), obj, seps); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	if v.Kind() != reflect.Ptr {
+		v = v.Addr()
+	}
+	return v.Interface().(Unmarshaler).UnmarshalHL7(e)
+}
+
+// unmarshalElements decodes the values of objs into the slice v
+func unmarshalElements(v reflect.Value, objs []ValueGetter, seps *Delimeters) error {
+	slice := reflect.MakeSlice(v.Type(), len(objs), len(objs))
+	for i, obj := range objs {
+		if err := unmarshalElement(slice.Index(i), obj, seps); err != nil {
+			return err
+		}
+	}
+	v.Set(slice)
+	return nil
+}
+
+// marshalElement encodes v, which implements Marshaler, for Location l
+func marshalElement(v reflect.Value, l *Location, seps *Delimeters) (string, error) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return "", nil
+	}
+	if v.Kind() != reflect.Ptr || !v.Type().Implements(marshalerType) {
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if !v.CanAddr() {
+			ptr := reflect.New(v.Type())
+			ptr.Elem().Set(v)
+			v = ptr.Elem()
+		}
+		if !v.Type().Implements(marshalerType) {
+			v = v.Addr()
+		}
+	}
+	e := &Element{Delimeters: seps, level: valueLevel(l)}
+	if err := v.Interface().(Marshaler).MarshalHL7(e); err != nil {
+		return "", err
+	}
+	return e.Raw, nil
+}
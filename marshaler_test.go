@@ -0,0 +1,126 @@
+package golevel7
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type personName struct {
+	Family string
+	Given  string
+}
+
+func (n *personName) UnmarshalHL7(e *Element) error {
+	n.Family = e.Part(1)
+	n.Given = e.Part(2)
+	return nil
+}
+
+func (n personName) MarshalHL7(e *Element) error {
+	e.SetParts(n.Family, n.Given)
+	return nil
+}
+
+type upperCode string
+
+func (c *upperCode) UnmarshalHL7(e *Element) error {
+	if e.String() == "bad" {
+		return errors.New("bad code")
+	}
+	*c = upperCode(strings.ToUpper(e.String()))
+	return nil
+}
+
+func (c upperCode) MarshalHL7(e *Element) error {
+	e.SetString(strings.ToLower(string(c)))
+	return nil
+}
+
+func TestUnmarshaler(t *testing.T) {
+	data := "MSH|^~\\&|A|B|C|D|20070910144846||ADT^A08|1|P|2.3|\r" +
+		"PID|1||12001~12002||O\\S\\Brien^Ann~Smith^Bob||19670824|f\r" +
+		"OBX|1|CE|x^y"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := struct {
+		Name    personName   `hl7:"PID.5"`
+		NamePtr *personName  `hl7:"PID.5"`
+		Names   []personName `hl7:"PID.5"`
+		Sex     upperCode    `hl7:"PID.8"`
+		Missing *personName  `hl7:"PID.9"`
+	}{}
+	if err := msg.Unmarshal(&st); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, personName{Family: "O^Brien", Given: "Ann"}, st.Name)
+	if assert.NotNil(t, st.NamePtr) {
+		assert.Equal(t, st.Name, *st.NamePtr)
+	}
+	assert.Equal(t, []personName{{"O^Brien", "Ann"}, {"Smith", "Bob"}}, st.Names)
+	assert.Equal(t, upperCode("F"), st.Sex)
+	assert.Nil(t, st.Missing)
+
+	type pid struct {
+		Name personName `hl7:"PID.5"`
+		Sex  upperCode  `hl7:"PID.8"`
+	}
+	tree := struct {
+		Patient pid `hl7:"PID"`
+	}{}
+	if err := msg.ToStruct(&tree); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, personName{Family: "O^Brien", Given: "Ann"}, tree.Patient.Name)
+	assert.Equal(t, upperCode("F"), tree.Patient.Sex)
+
+	msg, err = ParseMessage([]byte("MSH|^~\\&|A\rPID|1|||||||bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = msg.Unmarshal(&st)
+	assert.EqualError(t, err, "bad code")
+}
+
+func TestMarshaler(t *testing.T) {
+	msg, err := StartMessage(MsgInfo{MessageType: "ADT^A08"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := struct {
+		Name   personName  `hl7:"PID.5"`
+		Mother *personName `hl7:"PID.6"`
+		Sex    upperCode   `hl7:"PID.8"`
+		SetID  int         `hl7:"PID.1"`
+	}{
+		Name:  personName{Family: "O^Brien", Given: "Ann"},
+		Sex:   "F",
+		SetID: 1,
+	}
+	if _, err := Marshal(msg, &st); err != nil {
+		t.Fatal(err)
+	}
+	val, _ := msg.FindRaw("PID.5")
+	assert.Equal(t, `O\S\Brien^Ann`, val)
+	val, _ = msg.Find("PID.8")
+	assert.Equal(t, "f", val)
+	val, _ = msg.Find("PID.1")
+	assert.Equal(t, "1", val)
+	val, _ = msg.Find("PID.6")
+	assert.Equal(t, "", val)
+
+	back := struct {
+		Name personName `hl7:"PID.5"`
+		Sex  upperCode  `hl7:"PID.8"`
+	}{}
+	if err := msg.Unmarshal(&back); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, st.Name, back.Name)
+	assert.Equal(t, st.Sex, back.Sex)
+}
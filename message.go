@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"reflect"
 	"strconv"
 	"strings"
@@ -18,28 +17,46 @@ type Message struct {
 	Segments   []Segment
 	Value      []rune
 	Delimeters Delimeters
+	term       string // segment terminators after the last segment
 }
 
 // NewMessage returns a new message with the v byte value
+// It returns nil if v can not be parsed, use ParseMessage to get the reason
 func NewMessage(v []byte) *Message {
+	m, err := ParseMessage(v)
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// ParseMessage returns a new message with the v byte value
+// If v can not be parsed the error returned is a *ParseError
+func ParseMessage(v []byte) (*Message, error) {
 	var utf8V []byte
 	if len(v) != 0 {
 		reader, err := charset.NewReader(bytes.NewReader(v), "text/plain")
 		if err != nil {
-			return nil
+			return nil, &ParseError{Segment: -1, FieldSeq: -1, Err: err}
 		}
 		utf8V, err = ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, &ParseError{Segment: -1, FieldSeq: -1, Err: err}
+		}
 	} else {
 		utf8V = v
 	}
 	newMessage := &Message{
-		Value:      []rune(string(utf8V)),
-		Delimeters: *NewDelimeters(),
+		Value: []rune(string(utf8V)),
+	}
+	if len(v) == 0 {
+		// nothing to detect, used when building messages
+		newMessage.Delimeters = *NewDelimeters()
 	}
 	if err := newMessage.parse(); err != nil {
-		log.Fatal(fmt.Sprintf("Parse Error: %+v", err))
+		return nil, err
 	}
-	return newMessage
+	return newMessage, nil
 }
 
 func (m *Message) String() string {
@@ -101,6 +118,7 @@ func (m *Message) AllSegments(s string) ([]*Segment, error) {
 // Find gets a value from a message using location syntax
 // finds the first occurence of the segment and first of repeating fields
 // if the loc is not valid an error is returned
+// escape sequences in the value are decoded, see FindRaw
 func (m *Message) Find(loc string) (string, error) {
 	return m.Get(NewLocation(loc))
 }
@@ -108,10 +126,21 @@ func (m *Message) Find(loc string) (string, error) {
 // FindAll gets all values from a message using location syntax
 // finds all occurrences of the segments and all repeating fields
 // if the loc is not valid an error is returned
+// escape sequences in the values are decoded, see FindAllRaw
 func (m *Message) FindAll(loc string) ([]string, error) {
 	return m.GetAll(NewLocation(loc))
 }
 
+// FindRaw is like Find but returns the value as encoded in the message
+func (m *Message) FindRaw(loc string) (string, error) {
+	return m.GetRaw(NewLocation(loc))
+}
+
+// FindAllRaw is like FindAll but returns the values as encoded in the message
+func (m *Message) FindAllRaw(loc string) ([]string, error) {
+	return m.GetAllRaw(NewLocation(loc))
+}
+
 func (m *Message) findObjects(loc string) ([]ValueGetter, error) {
 	return m.getObjects(NewLocation(loc))
 }
@@ -121,26 +150,78 @@ type ValueGetter interface {
 	GetAll(loc *Location) ([]string, error)
 }
 
+// segmentAt returns occurrence n (1 based) of the segment with name s
+// n == 0 returns the first occurrence
+func (m *Message) segmentAt(s string, n int) (*Segment, error) {
+	if n <= 1 {
+		return m.Segment(s)
+	}
+	segs, err := m.AllSegments(s)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(segs) {
+		return nil, fmt.Errorf("Segment %s[%d] not found", s, n)
+	}
+	return segs[n-1], nil
+}
+
+// segmentsAt returns the segments matched by the Location
+// all occurrences unless the location specifies one
+func (m *Message) segmentsAt(l *Location) ([]*Segment, error) {
+	if l.SegIdx > 0 {
+		seg, err := m.segmentAt(l.Segment, l.SegIdx)
+		if err != nil {
+			return []*Segment{}, err
+		}
+		return []*Segment{seg}, nil
+	}
+	return m.AllSegments(l.Segment)
+}
+
 // Get returns the first value specified by the Location
+// escape sequences are decoded for fields and below
 func (m *Message) Get(l *Location) (string, error) {
+	val, err := m.GetRaw(l)
+	if l.FieldSeq < 0 {
+		return val, err
+	}
+	return Unescape(val, &m.Delimeters), err
+}
+
+// GetAll returns all values specified by the Location
+// escape sequences are decoded for fields and below
+func (m *Message) GetAll(l *Location) ([]string, error) {
+	vals, err := m.GetAllRaw(l)
+	if l.FieldSeq < 0 {
+		return vals, err
+	}
+	for i := range vals {
+		vals[i] = Unescape(vals[i], &m.Delimeters)
+	}
+	return vals, err
+}
+
+// GetRaw returns the first value specified by the Location as encoded in the message
+func (m *Message) GetRaw(l *Location) (string, error) {
 	if l.Segment == "" {
 		return string(m.Value), nil
 	}
-	seg, err := m.Segment(l.Segment)
+	seg, err := m.segmentAt(l.Segment, l.SegIdx)
 	if err != nil {
 		return "", err
 	}
 	return seg.Get(l)
 }
 
-// GetAll returns all values specified by the Location
-func (m *Message) GetAll(l *Location) ([]string, error) {
+// GetAllRaw returns all values specified by the Location as encoded in the message
+func (m *Message) GetAllRaw(l *Location) ([]string, error) {
 	vals := []string{}
 	if l.Segment == "" {
 		vals = append(vals, string(m.Value))
 		return vals, nil
 	}
-	segs, err := m.AllSegments(l.Segment)
+	segs, err := m.segmentsAt(l)
 	if err != nil {
 		return vals, err
 	}
@@ -160,7 +241,7 @@ func (m *Message) getObjects(l *Location) ([]ValueGetter, error) {
 		vals = append(vals, m)
 		return vals, nil
 	}
-	segs, err := m.AllSegments(l.Segment)
+	segs, err := m.segmentsAt(l)
 	if err != nil {
 		return vals, err
 	}
@@ -175,42 +256,106 @@ func (m *Message) getObjects(l *Location) ([]ValueGetter, error) {
 }
 
 // Set will insert a value into a message at Location
+// If the segment occurrence does not exist the missing segments are appended
+// Delimeters in val are escaped, except the ones of the levels below the
+// Location which split val into components or subcomponents
 func (m *Message) Set(l *Location, val string) error {
+	if isDelimeterField(l) {
+		return m.checkDelimeterField(l, val)
+	}
+	return m.SetRaw(l, escape(val, &m.Delimeters, valueLevel(l)))
+}
+
+// SetRaw is like Set but inserts val as is, without escaping
+func (m *Message) SetRaw(l *Location, val string) error {
 	if l.Segment == "" {
 		return errors.New("Segment is required")
 	}
-	seg, err := m.Segment(l.Segment)
+	if isDelimeterField(l) {
+		return m.checkDelimeterField(l, val)
+	}
+	seg, err := m.segmentAt(l.Segment, l.SegIdx)
 	if err != nil {
-		s := Segment{}
-		s.forceField([]rune(l.Segment), 0)
-		s.Set(l, val, &m.Delimeters)
-		m.Segments = append(m.Segments, s)
-	} else {
-		seg.Set(l, val, &m.Delimeters)
+		seg = m.appendSegments(l.Segment, l.SegIdx)
+	}
+	if err := seg.Set(l, val, &m.Delimeters); err != nil {
+		return err
 	}
 	m.Value = m.encode()
 	return nil
 }
 
+// SetLast will insert a value into the last occurrence of the segment at Location
+// unless the Location specifies an occurrence
 func (m *Message) SetLast(l *Location, val string) error {
 	if l.Segment == "" {
 		return errors.New("Segment is required")
 	}
+	if isDelimeterField(l) {
+		return m.checkDelimeterField(l, val)
+	}
+	return m.setLastRaw(l, escape(val, &m.Delimeters, valueLevel(l)))
+}
+
+// setLastRaw is SetLast without escaping val
+func (m *Message) setLastRaw(l *Location, val string) error {
+	if isDelimeterField(l) {
+		return m.checkDelimeterField(l, val)
+	}
+	if l.SegIdx > 0 {
+		return m.SetRaw(l, val)
+	}
 	seg, err := m.LastSegment(l.Segment)
 	if err != nil {
-		s := Segment{}
-		s.forceField([]rune(l.Segment), 0)
-		s.Set(l, val, &m.Delimeters)
-		m.Segments = append(m.Segments, s)
-	} else {
-		seg.Set(l, val, &m.Delimeters)
+		seg = m.appendSegments(l.Segment, 1)
+	}
+	if err := seg.Set(l, val, &m.Delimeters); err != nil {
+		return err
 	}
 	m.Value = m.encode()
 	return nil
 }
 
+// isDelimeterField reports if l is MSH.1 or MSH.2 which hold the delimeters
+func isDelimeterField(l *Location) bool {
+	return l.Segment == "MSH" && (l.FieldSeq == 1 || l.FieldSeq == 2)
+}
+
+// checkDelimeterField checks val against the delimeters of the message for MSH.1 and MSH.2
+// the delimeters are set by Delimeters and can not be changed by setting these fields
+func (m *Message) checkDelimeterField(l *Location, val string) error {
+	want := string(m.Delimeters.Field)
+	if l.FieldSeq == 2 {
+		want = m.Delimeters.encodingChars()
+	}
+	if val != "" && val != want {
+		return fmt.Errorf("%v is %q as set by the message Delimeters", l, want)
+	}
+	if len(m.Segments) == 0 {
+		m.appendSegments("MSH", 1)
+		m.Value = m.encode()
+	}
+	return nil
+}
+
+// appendSegments appends segments named name until occurrence n exists
+// and returns the last one appended
+func (m *Message) appendSegments(name string, n int) *Segment {
+	segs, _ := m.AllSegments(name)
+	for i := len(segs); i < n || i == 0; i++ {
+		m.Segments = append(m.Segments, newSegment(name, &m.Delimeters))
+	}
+	return &m.Segments[len(m.Segments)-1]
+}
+
 func (m *Message) parse() error {
-	m.Value = []rune(strings.Trim(string(m.Value), "\n\r\x1c\x0b"))
+	// MLLP framing and blank lines around the message are not part of it
+	// the terminators of the last segment are kept to encode it as parsed
+	framed := strings.TrimLeft(string(m.Value), "\n\r\x1c\x0b")
+	v := strings.TrimRight(framed, "\n\r\x1c\x0b")
+	rest := framed[len(v):]
+	m.term = rest[:len(rest)-len(strings.TrimLeft(rest, "\n\r"))]
+	m.Value = []rune(v)
 	if m.Delimeters.DelimeterField == "" { // BUGFIX: only parse if needed
 		if err := m.parseSep(); err != nil {
 			return err
@@ -230,55 +375,51 @@ func (m *Message) parse() error {
 			//just for safety: cannot reproduce this on windows
 			safeii := map[bool]int{true: len(m.Value), false: ii}[ii > len(m.Value)]
 			v := m.Value[i:safeii]
-			if len(v) > 4 { // seg name + field sep
-				seg := Segment{Value: v}
-				seg.parse(&m.Delimeters)
-				m.Segments = append(m.Segments, seg)
+			if len(v) != 0 {
+				if err := m.parseSegment(v, i); err != nil {
+					return err
+				}
 			}
+			m.Value = append(m.Value, []rune(m.term)...)
 			return nil
 		case ch == segTerm:
-			seg := Segment{Value: m.Value[i : ii-1]}
-			seg.parse(&m.Delimeters)
-			m.Segments = append(m.Segments, seg)
+			if err := m.parseSegment(m.Value[i:ii-1], i); err != nil {
+				return err
+			}
 			i = ii
-		case ch == m.Delimeters.Escape:
-			ii++
-			r.ReadRune()
 		}
 	}
 }
 
+// parseSegment parses the segment value v found at rune offset off
+func (m *Message) parseSegment(v []rune, off int) error {
+	seg := Segment{Value: v}
+	if len(v) != 0 { // empty segments are kept as is
+		if err := seg.parse(&m.Delimeters); err != nil {
+			if pe, ok := err.(*ParseError); ok {
+				pe.Offset += off
+				pe.Segment = len(m.Segments)
+			}
+			return err
+		}
+	}
+	m.Segments = append(m.Segments, seg)
+	return nil
+}
+
 func (m *Message) parseSep() error {
 	if len(m.Value) < 8 {
-		return errors.New("Invalid message length less than 8 bytes")
-	}
-	if string(m.Value[:3]) != "MSH" {
-		return fmt.Errorf("Invalid message: Missing MSH segment -> %v", m.Value[:3])
-	}
-
-	r := bytes.NewReader([]byte(string(m.Value)))
-	for i := 0; i < 8; i++ {
-		ch, _, _ := r.ReadRune()
-		if ch == eof {
-			return fmt.Errorf("Invalid message: eof while parsing MSH")
-		}
-		switch i {
-		case 3:
-			m.Delimeters.Field = ch
-		case 4:
-			m.Delimeters.DelimeterField = string(ch)
-			m.Delimeters.Component = ch
-		case 5:
-			m.Delimeters.DelimeterField += string(ch)
-			m.Delimeters.Repetition = ch
-		case 6:
-			m.Delimeters.DelimeterField += string(ch)
-			m.Delimeters.Escape = ch
-		case 7:
-			m.Delimeters.DelimeterField += string(ch)
-			m.Delimeters.SubComponent = ch
-		}
+		return newParseError(len(m.Value), 0, "", -1, "Invalid message length less than 8 bytes")
 	}
+	d, err := parseDelimeters([]byte(string(m.Value[:min(9, len(m.Value))])))
+	if err != nil {
+		return err
+	}
+	if d.Truncate == 0 {
+		d.Truncate = m.Delimeters.Truncate
+	}
+	d.LFTermMsg = m.Delimeters.LFTermMsg
+	m.Delimeters = d
 	return nil
 }
 
@@ -287,31 +428,74 @@ func (m *Message) encode() []rune {
 	for _, s := range m.Segments {
 		buf = append(buf, []byte(string(s.Value)))
 	}
-	return []rune(string(bytes.Join(buf, []byte(string(segTerm)))))
+	return []rune(string(bytes.Join(buf, []byte(string(segTerm)))) + m.term)
+}
+
+// Encode returns the message as HL7 ER7
+// A parsed message is encoded byte for byte as parsed, without MLLP framing,
+// setting a value only changes the element at its location
+func (m *Message) Encode() []byte {
+	return []byte(string(m.encode()))
+}
+
+// Clone returns a deep copy of the message
+// The copy and the original share no memory, changing one never changes the other
+func (m *Message) Clone() *Message {
+	c := &Message{
+		Value:      cloneRunes(m.Value),
+		Delimeters: m.Delimeters,
+		term:       m.term,
+	}
+	if m.Segments != nil {
+		c.Segments = make([]Segment, len(m.Segments))
+		for i := range m.Segments {
+			c.Segments[i] = m.Segments[i].clone()
+		}
+	}
+	return c
+}
+
+// cloneRunes returns a copy of r which does not share its backing array
+func cloneRunes(r []rune) []rune {
+	if r == nil {
+		return nil
+	}
+	return append(make([]rune, 0, len(r)), r...)
 }
 
 // IsValid checks a message for validity based on a set of criteria
-// it returns valid and any failed validation rules
+// it returns valid and any failed validation rules, each rule once with
+// Err set to the violations found, see Validate for the details
+// rules with a warning or information severity are not failures, see Validate
+// to report them
 func (m *Message) IsValid(val []Validation) (bool, []Validation) {
 	failures := []Validation{}
 	valid := true
 	for _, v := range val {
-		values, err := m.FindAll(v.Location)
-		if err != nil || len(values) == 0 {
-			valid = false
-			failures = append(failures, v)
-		}
-		for _, value := range values {
-			if value == "" || (v.VCheck == SpecificValue && v.Value != value) {
-				valid = false
-				failures = append(failures, v)
-			}
+		report := &ValidationReport{Violations: m.validate(&v)}
+		if report.Valid() {
+			continue
 		}
+		valid = false
+		if v.Err == nil {
+			v.Err = report.Violations
+		}
+		failures = append(failures, v)
 	}
 
 	return valid, failures
 }
 
+// Validate checks a message against a set of criteria and reports every
+// value failing them with its segment occurrence and field repetition
+func (m *Message) Validate(val []Validation) *ValidationReport {
+	report := &ValidationReport{Violations: Violations{}}
+	for i := range val {
+		report.Violations = append(report.Violations, m.validate(&val[i])...)
+	}
+	return report
+}
+
 var stringArray []string
 
 func (m *Message) ToStruct(v interface{}) error {
@@ -350,14 +534,22 @@ func unmarshalMessageStruct(v reflect.Value, m *Message) error {
 			}
 
 			for _, segment := range segments {
-				// For simple string fields, just find and set
-				if field.Kind() == reflect.String {
+				if implementsUnmarshaler(field.Type()) {
+					if objs, err := segment.getObjects(NewLocation(hl7Tag)); err == nil && len(objs) != 0 {
+						if err := unmarshalElement(field, objs[0], &m.Delimeters); err != nil {
+							return err
+						}
+					}
+				} else if isScalar(field.Type()) {
+					// For simple fields, just find and set
 					if val, _ := segment.Find(hl7Tag); val != "" {
-						field.SetString(strings.TrimSpace(val))
+						if err := setValue(field, hl7Tag, Unescape(val, &m.Delimeters)); err != nil {
+							return err
+						}
 					}
 				} else if field.Kind() == reflect.Struct {
 					// Recurse for nested structs
-					err := unmarshalSegmentStruct(field.Addr(), segment)
+					err := unmarshalSegmentStruct(field.Addr(), segment, &m.Delimeters)
 					if err != nil {
 						return err
 					}
@@ -368,7 +560,7 @@ func unmarshalMessageStruct(v reflect.Value, m *Message) error {
 						// Assuming a way to iterate over or determine the correct segment(s) for this slice
 						// This part is highly dependent on your data structure and HL7 message format
 						newElementPtr := reflect.New(elementType)
-						err := unmarshalSegmentStruct(newElementPtr, segment)
+						err := unmarshalSegmentStruct(newElementPtr, segment, &m.Delimeters)
 						if err != nil {
 							break // or handle the error as needed
 						}
@@ -382,17 +574,25 @@ func unmarshalMessageStruct(v reflect.Value, m *Message) error {
 	return nil
 }
 
-func unmarshalSegmentStruct(addr reflect.Value, s *Segment) error {
+func unmarshalSegmentStruct(addr reflect.Value, s *Segment, seps *Delimeters) error {
 	for i := 0; i < addr.Elem().NumField(); i++ {
 		field := addr.Elem().Field(i)
 		fieldType := addr.Elem().Type().Field(i)
 		hl7Tag := fieldType.Tag.Get("hl7")
 
 		if hl7Tag != "" {
-			// For simple string fields, just find and set
-			if field.Kind() == reflect.String {
+			if implementsUnmarshaler(field.Type()) {
+				if objs, err := s.getObjects(NewLocation(hl7Tag)); err == nil && len(objs) != 0 {
+					if err := unmarshalElement(field, objs[0], seps); err != nil {
+						return err
+					}
+				}
+			} else if isScalar(field.Type()) {
+				// For simple fields, just find and set
 				if val, _ := s.Find(hl7Tag); val != "" {
-					field.SetString(strings.TrimSpace(val))
+					if err := setValue(field, hl7Tag, Unescape(val, seps)); err != nil {
+						return err
+					}
 				}
 			} else {
 				// get the last . part of the tag 
@@ -410,7 +610,7 @@ func unmarshalSegmentStruct(addr reflect.Value, s *Segment) error {
 				for _, f := range allFields {
 					if field.Kind() == reflect.Struct {
 						// Recurse for nested structs
-						err = unmarshalFieldStruct(field.Addr(), f)
+						err = unmarshalFieldStruct(field.Addr(), f, seps)
 						if err != nil {
 							return err
 						}
@@ -422,7 +622,7 @@ func unmarshalSegmentStruct(addr reflect.Value, s *Segment) error {
 							// Assuming a way to iterate over or determine the correct segment(s) for this slice
 							// This part is highly dependent on your data structure and HL7 message format
 							newElementPtr := reflect.New(elementType)
-							err := unmarshalFieldStruct(newElementPtr, f)
+							err := unmarshalFieldStruct(newElementPtr, f, seps)
 							if err != nil {
 								break // or handle the error as needed
 							}
@@ -437,18 +637,26 @@ func unmarshalSegmentStruct(addr reflect.Value, s *Segment) error {
 	return nil
 }
 
-func unmarshalFieldStruct(ptr reflect.Value, f *Field) error {
+func unmarshalFieldStruct(ptr reflect.Value, f *Field, seps *Delimeters) error {
 	for i := 0; i < ptr.Elem().NumField(); i++ {
 		component := ptr.Elem().Field(i)
 		componentType := ptr.Elem().Type().Field(i)
 		hl7Tag := componentType.Tag.Get("hl7")
 
 		if hl7Tag != "" {
-			// For simple string fields, just find and set
-			if component.Kind() == reflect.String {
+			if implementsUnmarshaler(component.Type()) {
+				if c, err := f.Component(lastIndex(hl7Tag)); err == nil {
+					if err := unmarshalElement(component, c, seps); err != nil {
+						return err
+					}
+				}
+			} else if isScalar(component.Type()) {
+				// For simple fields, just find and set
 				location := f.RelativeLocation(hl7Tag)
 				if val, _ := f.Get(location); val != "" {
-					component.SetString(strings.TrimSpace(val))
+					if err := setValue(component, hl7Tag, Unescape(val, seps)); err != nil {
+						return err
+					}
 				}
 			} else {
 				// get the last . part of the tag
@@ -466,7 +674,7 @@ func unmarshalFieldStruct(ptr reflect.Value, f *Field) error {
 
 				if component.Kind() == reflect.Struct {
 					// Recurse for nested structs
-					err = unmarshalComponentStruct(component.Addr(), c)
+					err = unmarshalComponentStruct(component.Addr(), c, seps)
 					if err != nil {
 						return err
 					}
@@ -478,7 +686,7 @@ func unmarshalFieldStruct(ptr reflect.Value, f *Field) error {
 						// Assuming a way to iterate over or determine the correct segment(s) for this slice
 						// This part is highly dependent on your data structure and HL7 message format
 						newElementPtr := reflect.New(elementType)
-						err := unmarshalComponentStruct(newElementPtr, c)
+						err := unmarshalComponentStruct(newElementPtr, c, seps)
 						if err != nil {
 							break // or handle the error as needed
 						}
@@ -492,18 +700,26 @@ func unmarshalFieldStruct(ptr reflect.Value, f *Field) error {
 	return nil
 }
 
-func unmarshalComponentStruct(addr reflect.Value, c *Component) error {
+func unmarshalComponentStruct(addr reflect.Value, c *Component, seps *Delimeters) error {
 	for i := 0; i < addr.Elem().NumField(); i++ {
 		subcomponent := addr.Elem().Field(i)
 		subcomponentType := addr.Elem().Type().Field(i)
 		hl7Tag := subcomponentType.Tag.Get("hl7")
 
 		if hl7Tag != "" {
-			// For simple string fields, just find and set
-			if subcomponent.Kind() == reflect.String {
+			if implementsUnmarshaler(subcomponent.Type()) {
+				if sc, err := c.SubComponent(lastIndex(hl7Tag)); err == nil {
+					if err := unmarshalElement(subcomponent, sc, seps); err != nil {
+						return err
+					}
+				}
+			} else if isScalar(subcomponent.Type()) {
+				// For simple fields, just find and set
 				location := c.RelativeLocation(hl7Tag)
 				if val, _ := c.Get(location); val != "" {
-					subcomponent.SetString(strings.TrimSpace(val))
+					if err := setValue(subcomponent, hl7Tag, Unescape(val, seps)); err != nil {
+						return err
+					}
 				}
 			} else {
 				// get the last . part of the tag
@@ -520,7 +736,7 @@ func unmarshalComponentStruct(addr reflect.Value, c *Component) error {
 
 				if subcomponent.Kind() == reflect.Struct {
 					// Recurse for nested structs
-					err = unmarshalSubComponentStruct(subcomponent.Addr(), sc)
+					err = unmarshalSubComponentStruct(subcomponent.Addr(), sc, seps)
 					if err != nil {
 						return err
 					}
@@ -532,7 +748,7 @@ func unmarshalComponentStruct(addr reflect.Value, c *Component) error {
 						// Assuming a way to iterate over or determine the correct segment(s) for this slice
 						// This part is highly dependent on your data structure and HL7 message format
 						newElementPtr := reflect.New(elementType)
-						err := unmarshalSubComponentStruct(newElementPtr, sc)
+						err := unmarshalSubComponentStruct(newElementPtr, sc, seps)
 						if err != nil {
 							break // or handle the error as needed
 						}
@@ -546,18 +762,24 @@ func unmarshalComponentStruct(addr reflect.Value, c *Component) error {
 	return nil
 }
 
-func unmarshalSubComponentStruct(ptr reflect.Value, sc *SubComponent) error {
+func unmarshalSubComponentStruct(ptr reflect.Value, sc *SubComponent, seps *Delimeters) error {
 	for i := 0; i < ptr.Elem().NumField(); i++ {
 		field := ptr.Elem().Field(i)
 		fieldType := ptr.Elem().Type().Field(i)
 		hl7Tag := fieldType.Tag.Get("hl7")
 
 		if hl7Tag != "" {
-			// For simple string fields, just find and set
-			if field.Kind() == reflect.String {
+			if implementsUnmarshaler(field.Type()) {
+				if err := unmarshalElement(field, sc, seps); err != nil {
+					return err
+				}
+			} else if isScalar(field.Type()) {
+				// For simple fields, just find and set
 				location := sc.RelativeLocation(hl7Tag)
 				if val, _ := sc.Get(location); val != "" {
-					field.SetString(strings.TrimSpace(val))
+					if err := setValue(field, hl7Tag, Unescape(val, seps)); err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -570,9 +792,20 @@ func unmarshalSubComponentStruct(ptr reflect.Value, sc *SubComponent) error {
 // Unmarshal will decode the entire message before trying to set values
 // it will set the first matching segment / first matching field
 // repeating segments and fields is not well suited to this
-// for the moment all unmarshal target fields must be strings
+// target fields can be strings, integers, floats, bools (Y/N), time.Time (TS / DTM),
+// pointers to these, slices of these or slices of structs
+// A struct or slice of structs tagged with a group name of the message structure,
+// `hl7:"ORDER_OBSERVATION"`, is filled from the segments of each instance of the group
+// see Groups
 func (m *Message) Unmarshal(it interface{}) error {
-	st := reflect.ValueOf(it).Elem()
+	return m.unmarshal(reflect.ValueOf(it).Elem(), nil)
+}
+
+// unmarshal fills st from the message, g is the group the message was made of
+// it is nil for a complete message which is parsed into groups when first needed
+// segments missing from a group leave slices empty
+func (m *Message) unmarshal(st reflect.Value, g *Group) error {
+	root := g
 	stt := st.Type()
 	for i := 0; i < st.NumField(); i++ {
 		fld := stt.Field(i)
@@ -586,27 +819,61 @@ func (m *Message) Unmarshal(it interface{}) error {
 			continue
 		}
 
-		if st.Field(i).Kind() == reflect.String {
-			if val, _ := m.Find(r); val != "" {
-				st.Field(i).SetString(strings.TrimSpace(val))
+		if isGroupTag(r) {
+			if root == nil {
+				var err error
+				if root, err = m.Groups(); err != nil {
+					return err
+				}
+			}
+			if err := m.unmarshalGroups(st.Field(i), r, root.AllGroups(r)); err != nil {
+				return err
 			}
 			continue
 		}
 
-		if st.Field(i).Kind() == reflect.Slice {
-			if fld.Type == reflect.TypeOf(stringArray) {
-				location := strings.Split(r, ",")[0]
-				vals, err := m.GetAll(NewLocation(location))
-				if err != nil {
+		if implementsUnmarshaler(fld.Type) {
+			objs, err := m.findObjects(strings.Split(r, ",")[0])
+			if err == nil && len(objs) != 0 {
+				if err := unmarshalElement(st.Field(i), objs[0], &m.Delimeters); err != nil {
 					return err
 				}
-				stringSlice := reflect.MakeSlice(reflect.TypeOf(stringArray), len(vals), len(vals))
-				for idx := range vals {
-					stringSlice.Index(idx).Set(reflect.ValueOf(strings.TrimSpace(vals[idx])))
+			}
+			continue
+		}
+
+		if fld.Type.Kind() == reflect.Slice && implementsUnmarshaler(fld.Type.Elem()) {
+			objs, err := m.findObjects(strings.Split(r, ",")[0])
+			if err == nil {
+				if err := unmarshalElements(st.Field(i), objs, &m.Delimeters); err != nil {
+					return err
 				}
-				st.Field(i).Set(stringSlice)
-				continue
 			}
+			continue
+		}
+
+		if isScalar(fld.Type) {
+			if val, _ := m.Find(r); val != "" {
+				if err := setValue(st.Field(i), r, val); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if isScalarSlice(fld.Type) {
+			location := strings.Split(r, ",")[0]
+			vals, err := m.GetAll(NewLocation(location))
+			if err != nil {
+				if g == nil {
+					return err
+				}
+				vals = []string{}
+			}
+			if err := setValues(st.Field(i), r, vals); err != nil {
+				return err
+			}
+			continue
 		}
 
 		if st.Field(i).Type().Kind() == reflect.Slice {
@@ -621,45 +888,63 @@ func (m *Message) Unmarshal(it interface{}) error {
 			// Limitations:
 			// - original struct cannot use pointers to the slice elements (eg []Foo and not []*Foo)
 			// - only supports one level of nesting
-			// - only supports string fields
 			//
 			slice := reflect.MakeSlice(st.Field(i).Type(), 0, 0)
-			valuePtr := reflect.New(st.Field(i).Type().Elem()).Elem()
 			if r != "" {
 				tagParts := strings.Split(r, ",")
 				objs, err := m.findObjects(tagParts[0])
-				if err != nil {
+				if err != nil && g == nil {
 					return err
 				}
 
 				for _, obj := range objs {
-					newSliceObj := reflect.ValueOf(valuePtr.Addr().Interface()).Elem()
+					newSliceObj := reflect.New(st.Field(i).Type().Elem()).Elem()
 					newSliceObjType := newSliceObj.Type()
 					for sliceFieldIdx := 0; sliceFieldIdx < newSliceObj.NumField(); sliceFieldIdx++ {
 						sliceField := newSliceObjType.Field(sliceFieldIdx)
 						sliceFieldTag := sliceField.Tag.Get("hl7")
 
 						location := strings.Split(sliceFieldTag, ",")[0]
+						if sliceFieldTag != "" && implementsUnmarshaler(sliceField.Type) {
+							if sub, err := objectAt(obj, NewLocation(location)); err == nil {
+								if err := unmarshalElement(newSliceObj.Field(sliceFieldIdx), sub, &m.Delimeters); err != nil {
+									return err
+								}
+							}
+							continue
+						}
+
 						if sliceField.Type.Kind() == reflect.String {
 							newVal, err := obj.Get(NewLocation(location))
 							if err != nil {
 								return err
 							}
-							newSliceObj.Field(sliceFieldIdx).SetString(strings.TrimSpace(newVal)) // TODO: support fields other than string
+							newVal = Unescape(newVal, &m.Delimeters)
+							newSliceObj.Field(sliceFieldIdx).SetString(strings.TrimSpace(newVal))
 							continue
 						}
 
-						if sliceField.Type.Kind() == reflect.Slice {
-							if reflect.SliceOf(sliceField.Type.Elem()) == reflect.TypeOf(stringArray) {
-								vals, err := obj.GetAll(NewLocation(location))
-								if err != nil {
-									return err
-								}
-								stringSlice := reflect.MakeSlice(reflect.TypeOf(stringArray), len(vals), len(vals))
-								for idx := range vals {
-									stringSlice.Index(idx).Set(reflect.ValueOf(strings.TrimSpace(vals[idx])))
-								}
-								newSliceObj.Field(sliceFieldIdx).Set(stringSlice)
+						if sliceFieldTag != "" && isScalar(sliceField.Type) {
+							newVal, err := obj.Get(NewLocation(location))
+							if err != nil {
+								return err
+							}
+							if err := setValue(newSliceObj.Field(sliceFieldIdx), sliceFieldTag, Unescape(newVal, &m.Delimeters)); err != nil {
+								return err
+							}
+							continue
+						}
+
+						if isScalarSlice(sliceField.Type) {
+							vals, err := obj.GetAll(NewLocation(location))
+							if err != nil {
+								return err
+							}
+							for idx := range vals {
+								vals[idx] = Unescape(vals[idx], &m.Delimeters)
+							}
+							if err := setValues(newSliceObj.Field(sliceFieldIdx), sliceFieldTag, vals); err != nil {
+								return err
 							}
 							continue
 						}
@@ -675,6 +960,33 @@ func (m *Message) Unmarshal(it interface{}) error {
 	return nil
 }
 
+// isGroupTag reports if the hl7 tag names a group rather than a location
+func isGroupTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, ".,[") && !isSegmentName([]rune(tag))
+}
+
+// unmarshalGroups fills v, a struct or a slice of structs, from the instances of group name
+// a struct is filled from the first instance
+func (m *Message) unmarshalGroups(v reflect.Value, name string, groups []*Group) error {
+	switch {
+	case v.Kind() == reflect.Struct:
+		if len(groups) == 0 {
+			return nil
+		}
+		return groups[0].Message(&m.Delimeters).unmarshal(v, groups[0])
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		slice := reflect.MakeSlice(v.Type(), len(groups), len(groups))
+		for i, g := range groups {
+			if err := g.Message(&m.Delimeters).unmarshal(slice.Index(i), g); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return fmt.Errorf("hl7: group %s can not be unmarshaled into %v", name, v.Type())
+}
+
 // Info returns the MsgInfo for the message
 func (m *Message) Info() (MsgInfo, error) {
 	mi := MsgInfo{}
@@ -704,34 +1016,37 @@ func (m *Message) FieldStringToComponents(val string) []Component {
 // Unmarshal will decode the entire message before trying to set values
 // it will set the first matching segment / first matching field
 // repeating segments and fields is not well suited to this
-// for the moment all unmarshal target fields must be strings
+// target fields can be strings, integers, floats, bools (Y/N), time.Time (TS / DTM),
+// pointers to these or slices of these
+// Escape sequences are decoded with the delimeters of the message, as Message.Unmarshal does
 func (s Segment) Unmarshal(it interface{}) error {
+	seps := s.delimeters()
 	st := reflect.ValueOf(it).Elem()
 	stt := st.Type()
 	for i := 0; i < st.NumField(); i++ {
 		fld := stt.Field(i)
 		r := fld.Tag.Get("hl7")
-		if r != "" {
+		if r == "" || !st.Field(i).CanSet() {
+			continue
+		}
+		switch {
+		case isScalar(fld.Type):
 			if val, _ := s.Find(r); val != "" {
-				if st.Field(i).CanSet() {
-					// TODO support fields other than string
-					fldT := st.Field(i).Type()
-					switch fldT.Kind() {
-					case reflect.String:
-						st.Field(i).SetString(strings.TrimSpace(val))
-					// detect if this is a slice or a pointer to a slice
-					case reflect.Slice:
-						obj := reflect.New(fldT.Elem())
-						st.Field(i).Set(obj)
-					case reflect.Ptr:
-						// instantiate a new slice and set the pointer to it
-						obj := reflect.New(fldT.Elem())
-						st.Field(i).Set(obj)
-					default:
-						// TODO: support other types
-					}
+				if err := setValue(st.Field(i), r, Unescape(val, seps)); err != nil {
+					return err
 				}
 			}
+		case isScalarSlice(fld.Type):
+			vals, err := s.GetAll(NewLocation(r))
+			if err != nil {
+				continue
+			}
+			for j := range vals {
+				vals[j] = Unescape(vals[j], seps)
+			}
+			if err := setValues(st.Field(i), r, vals); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -1,17 +1,42 @@
 package golevel7
 
 import (
-	"bufio"
+	"fmt"
 	"io"
 
 	"github.com/mhald/golevel7/commons"
 )
 
 type MessageScanner struct {
+	// SkipInvalid makes invalid messages non fatal, Scan records them as a *ScanError
+	// and continues with the next message, see Errors
+	SkipInvalid bool
+
 	r       io.Reader
-	b       *bufio.Scanner
+	b       *commons.Scanner
 	thisMsg *Message
+	offset  int64
+	line    int
+	count   int
 	err     error
+	errs    []*ScanError
+}
+
+// ScanError is a chunk of the input of a MessageScanner which is not a valid message
+type ScanError struct {
+	Index  int    // index of the chunk, counting messages and invalid chunks
+	Offset int64  // byte offset of the chunk in the input
+	Line   int    // line of the input where the chunk starts, 1 based
+	Raw    []byte // the bytes of the chunk as read
+	Err    error  // the *ParseError of the chunk
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("message %d at line %d (offset %d): %v", e.Index, e.Line, e.Offset, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
 }
 
 // NewMessageScanner returns a new scanner that returns
@@ -19,36 +44,74 @@ type MessageScanner struct {
 func NewMessageScanner(r io.Reader) *MessageScanner {
 	ms := &MessageScanner{
 		r: r,
-		b: commons.NewBufScanner(r),
+		b: commons.NewScanner(r),
 	}
 	return ms
 }
 
-func (ms *MessageScanner) Scan() (gotOne bool) {
-	if scan := ms.b.Scan(); scan {
-		if ms.err = ms.b.Err(); ms.err != nil || len(ms.b.Bytes()) < 5 {
-			if ms.b.Bytes() != nil && !(len(ms.b.Bytes()) < 5) {
-				gotOne = true
-			}
-		} else {
-			gotOne = true
+// Scan advances to the next message, it returns false when the input is
+// exhausted or a message fails to parse. In the latter case Err returns
+// a *ScanError wrapping the *ParseError for that message, unless SkipInvalid
+// is set in which case the error is recorded and Scan continues with the next message
+func (ms *MessageScanner) Scan() bool {
+	ms.thisMsg = nil
+	if ms.b == nil {
+		return false
+	}
+	for ms.b.Scan() {
+		index := ms.count
+		ms.count++
+		msg, err := ParseMessage(ms.b.Bytes())
+		if err == nil {
+			ms.thisMsg = msg
+			ms.offset = ms.b.Offset()
+			ms.line = ms.b.Line()
+			return true
 		}
-		if gotOne {
-			ms.thisMsg = NewMessage(ms.b.Bytes())
-		} else {
-			ms.thisMsg = nil
+		if perr, ok := err.(*ParseError); ok {
+			perr.MsgIndex = index
 		}
+		serr := &ScanError{
+			Index:  index,
+			Offset: ms.b.Offset(),
+			Line:   ms.b.Line(),
+			Raw:    append([]byte(nil), ms.b.Raw()...),
+			Err:    err,
+		}
+		if !ms.SkipInvalid {
+			ms.err = serr
+			ms.b = nil
+			return false
+		}
+		ms.errs = append(ms.errs, serr)
 	}
-	if !gotOne {
-		ms.b = nil
-	}
-	return gotOne
+	ms.err = ms.b.Err()
+	ms.b = nil
+	return false
 }
 
 func (ms *MessageScanner) Message() *Message {
 	return ms.thisMsg
 }
 
+// Offset returns the byte offset in the input of the current message
+func (ms *MessageScanner) Offset() int64 {
+	return ms.offset
+}
+
+// Line returns the line, 1 based, of the input where the current message starts
+func (ms *MessageScanner) Line() int {
+	return ms.line
+}
+
+// Errors returns the invalid messages skipped with SkipInvalid since the last call
+// call it after Scan to handle them as they are found
+func (ms *MessageScanner) Errors() []*ScanError {
+	errs := ms.errs
+	ms.errs = nil
+	return errs
+}
+
 func (ms *MessageScanner) Err() error {
 	return ms.err
 }
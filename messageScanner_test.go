@@ -0,0 +1,113 @@
+package golevel7
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageScannerDelimeters(t *testing.T) {
+	msgs := []string{
+		"MSH|^~\\&|A|B|||20240101||ADT^A01|1|P|2.5\rPID|1||12001",
+		"MSH|^~\\&#|A|B|||20240101||ADT^A01|2|P|2.7\rPID|1||12002",
+		"MSH!^~\\&!A!B!!!20240101!!ADT^A01!3!P!2.5\rPID!1!!12003",
+		"MSH|^~\\&|A|B|||20240101||ORU^R01|4|P|2.5\rPID|1||12004\rOBX|1|ST|X||MSH line",
+	}
+	feeds := map[string]string{
+		"cr":      strings.Join(msgs, "\r") + "\r",
+		"crlf":    strings.ReplaceAll(strings.Join(msgs, "\r")+"\r", "\r", "\r\n"),
+		"lf":      strings.ReplaceAll(strings.Join(msgs, "\r")+"\r", "\r", "\n"),
+		"blank":   "\r\n\r\n" + strings.ReplaceAll(strings.Join(msgs, "\r\n\r\n"), "\r", "\r\n") + "\r\n\r\n",
+		"mllp":    "\x0b" + strings.Join(msgs, "\r\x1c\r\x0b") + "\r\x1c\r",
+		"no term": strings.Join(msgs, "\r"),
+	}
+	for name, feed := range feeds {
+		for _, r := range []*MessageScanner{
+			NewMessageScanner(strings.NewReader(feed)),
+			NewMessageScanner(iotest.OneByteReader(strings.NewReader(feed))),
+		} {
+			got := []string{}
+			for r.Scan() {
+				got = append(got, string(r.Message().Value))
+			}
+			assert.NoError(t, r.Err(), name)
+			assert.Equal(t, msgs, got, name)
+		}
+	}
+
+	ms := NewMessageScanner(strings.NewReader(msgs[1] + "\r\n" + msgs[2]))
+	if assert.True(t, ms.Scan()) {
+		assert.Equal(t, '#', ms.Message().Delimeters.Truncate)
+		assert.Equal(t, "^~\\&#", ms.Message().Delimeters.DelimeterField)
+		v, _ := ms.Message().Find("MSH.2")
+		assert.Equal(t, "^~\\&#", v)
+		v, _ = ms.Message().Find("MSH.10")
+		assert.Equal(t, "2", v)
+	}
+	if assert.True(t, ms.Scan()) {
+		assert.Equal(t, '!', ms.Message().Delimeters.Field)
+		v, _ := ms.Message().Find("PID.3")
+		assert.Equal(t, "12003", v)
+	}
+	assert.False(t, ms.Scan())
+}
+
+func TestMessageScannerResync(t *testing.T) {
+	feed := "junk\r\n" + // line 1
+		"MSH|^~\\&|A|B|||20240101||ADT^A01|1|P|2.5\r\nPID|1||12001\r\n" + // line 2
+		"MSH|^~\\&|A|B|||20240101||ADT^A01|2|P|2.5\r\npid|1||bad\r\n\r\n" + // line 4
+		"MSH|^~\\&|A|B|||20240101||ADT^A01|3|P|2.5\r\nPID|1||12003\r\n" // line 7
+
+	type pos struct {
+		id     string
+		offset int64
+		line   int
+	}
+	for _, r := range []*MessageScanner{
+		NewMessageScanner(strings.NewReader(feed)),
+		NewMessageScanner(iotest.OneByteReader(strings.NewReader(feed))),
+	} {
+		r.SkipInvalid = true
+		got := []pos{}
+		errs := []*ScanError{}
+		for r.Scan() {
+			id, _ := r.Message().Find("MSH.10")
+			got = append(got, pos{id, r.Offset(), r.Line()})
+			errs = append(errs, r.Errors()...)
+		}
+		errs = append(errs, r.Errors()...)
+		assert.NoError(t, r.Err())
+		assert.Equal(t, []pos{{"1", 6, 2}, {"3", 118, 7}}, got)
+		if assert.Equal(t, 2, len(errs)) {
+			assert.Equal(t, 0, errs[0].Index)
+			assert.Equal(t, int64(0), errs[0].Offset)
+			assert.Equal(t, 1, errs[0].Line)
+			assert.Equal(t, "junk\r\n", string(errs[0].Raw))
+
+			assert.Equal(t, 2, errs[1].Index)
+			assert.Equal(t, int64(62), errs[1].Offset)
+			assert.Equal(t, 4, errs[1].Line)
+			assert.Equal(t, "MSH|^~\\&|A|B|||20240101||ADT^A01|2|P|2.5\r\npid|1||bad\r\n\r\n", string(errs[1].Raw))
+			var perr *ParseError
+			if assert.True(t, errors.As(errs[1], &perr)) {
+				assert.Equal(t, 2, perr.MsgIndex)
+				assert.Equal(t, "pid", perr.SegmentName)
+			}
+		}
+	}
+
+	// without SkipInvalid the first invalid message stops the scanner
+	ms := NewMessageScanner(strings.NewReader(feed[6:]))
+	assert.True(t, ms.Scan())
+	assert.False(t, ms.Scan())
+	var serr *ScanError
+	if assert.True(t, errors.As(ms.Err(), &serr)) {
+		assert.Equal(t, 1, serr.Index)
+		assert.Equal(t, 3, serr.Line)
+	}
+	assert.Nil(t, ms.Message())
+	assert.False(t, ms.Scan())
+}
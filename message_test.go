@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -351,3 +352,180 @@ func TestStandardPatientIdParsing(t *testing.T) {
 	assert.Equal(t, "1", patient.Patient.IDs[0].Id)
 	assert.Equal(t, "2", patient.Patient.IDs[1].Id)
 }
+
+func TestParseMessageErrors(t *testing.T) {
+	data, err := readFile("./testdata/msg.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, len(msg.Segments))
+
+	tests := []struct {
+		data        string
+		offset      int
+		segment     int
+		segmentName string
+		fieldSeq    int
+	}{
+		{"PID|||12001", 0, 0, "PID", 0},
+		{"MSH|^~\\", 7, 0, "", -1},
+		{"MSH1^~\\&|A|B", 3, 0, "MSH", 1},
+		{"MSH|^~|&|A|B", 6, 0, "MSH", 2},
+		{"MSH|^~\\&|A|B\rPID|||12001\rpv1|||O", 25, 2, "pv1", 0},
+		{"MSH|^~\\&|A|B\rPID^||12001", 16, 1, "PID", 0},
+	}
+	for _, tt := range tests {
+		msg, err := ParseMessage([]byte(tt.data))
+		if err == nil {
+			t.Errorf("Expected error for %q", tt.data)
+			continue
+		}
+		assert.Nil(t, msg)
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Expected *ParseError got %T", err)
+			continue
+		}
+		assert.Equal(t, tt.offset, perr.Offset, tt.data)
+		assert.Equal(t, tt.segment, perr.Segment, tt.data)
+		assert.Equal(t, tt.segmentName, perr.SegmentName, tt.data)
+		assert.Equal(t, tt.fieldSeq, perr.FieldSeq, tt.data)
+		assert.Nil(t, NewMessage([]byte(tt.data)))
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	files := []string{"msg.hl7", "msg2.hl7", "msg3.hl7", "msg4.hl7", "msg5.hl7", "msg6.hl7", "epic-oru-r01.hl7"}
+	for _, f := range files {
+		data, err := ioutil.ReadFile("./testdata/" + f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := ParseMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(data), string(msg.Encode()), f)
+	}
+
+	tests := []string{
+		"MSH|^~\\&|A|B",
+		"MSH|^~\\&|A|B\r",
+		"MSH|^~\\&|A|B\r\n",
+		"MSH|^~\\&|A|B|||\rPID|1||||||\r",
+		"MSH|^~\\&|A|B\rPID|1||a~b~~|~|Jones^John^^&x&|\r",
+		"MSH|^~\\&|A|B\rPID|1||12001\r\rNTE\rZZ1|",
+		"MSH|^~\\&|A|B\rPID|||Jo\\T\\nes^M\\S\\ller||Müller^Jürgen",
+		"MSH#@~!$#A#B\rPID###a~b@c$d",
+	}
+	for _, data := range tests {
+		msg, err := ParseMessage([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, data, string(msg.Encode()))
+		assert.Equal(t, data, string(msg.Value))
+	}
+
+	// MLLP framing is not part of the message
+	msg, err := ParseMessage([]byte("\x0bMSH|^~\\&|A|B\rPID|1\r\x1c\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "MSH|^~\\&|A|B\rPID|1\r", string(msg.Encode()))
+}
+
+func TestSetRoundTrip(t *testing.T) {
+	data := "MSH|^~\\&|A|B|||20060307||ORM^O01|1|P|2.3|||\r" +
+		"PID|1||a~b~~||Jones^John^^&x|||\r" +
+		"NTE|1||\r" +
+		"NTE|2\r"
+	tests := []struct {
+		loc  string
+		val  string
+		want string
+	}{
+		{"MSH.3", "C", "MSH|^~\\&|C|B|||20060307||ORM^O01|1|P|2.3|||\r"},
+		{"MSH.14", "X", "MSH|^~\\&|A|B|||20060307||ORM^O01|1|P|2.3||X|\r"},
+		{"PID.3[2]", "Q", "PID|1||a~Q~~||Jones^John^^&x|||\r"},
+		{"PID.3[4]", "Q", "PID|1||a~b~~Q||Jones^John^^&x|||\r"},
+		{"PID.5.3.2", "Z", "PID|1||a~b~~||Jones^John^^&x&Z|||\r"},
+		{"PID.8", "M", "PID|1||a~b~~||Jones^John^^&x|||M\r"},
+		{"PID.10", "C", "PID|1||a~b~~||Jones^John^^&x|||||C\r"},
+		{"NTE[2].3", "x|y", "NTE|2||x\\F\\y\r"},
+	}
+	for _, tt := range tests {
+		msg, err := ParseMessage([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := msg.Set(NewLocation(tt.loc), tt.val); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.SplitAfter(string(msg.Encode()), "\r")
+		want := strings.SplitAfter(data, "\r")
+		changed := 0
+		for i := range want {
+			if got[i] != want[i] {
+				assert.Equal(t, tt.want, got[i], tt.loc)
+				changed++
+			}
+		}
+		assert.Equal(t, 1, changed, tt.loc)
+		assert.Equal(t, string(msg.Value), string(msg.Encode()), tt.loc)
+	}
+}
+
+func TestClone(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/msg.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := msg.Clone()
+	assert.Equal(t, msg, c)
+	assert.Equal(t, string(data), string(c.Encode()))
+
+	// editing the clone does not change the original
+	assert.NoError(t, c.Set(NewLocation("PID.5.1"), "Jim"))
+	assert.NoError(t, c.AddRepetition(NewLocation("PID.3"), "12002"))
+	c.DeleteSegments(NewLocation("PV1"))
+	assert.Equal(t, string(data), string(msg.Encode()))
+
+	// nor does overwriting the values the clone shares with nothing
+	c = msg.Clone()
+	overwrite := func(r []rune) {
+		for i := range r {
+			r[i] = 'X'
+		}
+	}
+	overwrite(c.Value)
+	for _, s := range c.Segments {
+		overwrite(s.Value)
+		for _, f := range s.Fields {
+			overwrite(f.Value)
+			for _, cmp := range f.Components {
+				overwrite(cmp.Value)
+				for _, sc := range cmp.SubComponents {
+					overwrite(sc.Value)
+				}
+			}
+		}
+	}
+	assert.Equal(t, string(data), string(msg.Encode()))
+	assert.Equal(t, string(data), string(msg.Value))
+	val, _ := msg.Find("PID.5.1")
+	assert.Equal(t, "Jones", val)
+
+	// and the original can be changed without changing the clone
+	c = msg.Clone()
+	assert.NoError(t, msg.Set(NewLocation("MSH.3"), "Other"))
+	assert.Equal(t, string(data), string(c.Encode()))
+}
@@ -85,3 +85,128 @@ func TestRepFields(t *testing.T) {
 		t.Errorf("Expected 2 got %d\n", len(vals))
 	}
 }
+
+func TestFindOccurrence(t *testing.T) {
+	data, err := readFile("./testdata/msg3.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := msg.Find("OBX[3].3.2")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "HDL" {
+		t.Errorf("Expected HDL got %s\n", val)
+	}
+
+	vals, err := msg.FindAll("OBX[2].1")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vals) != 1 || vals[0] != "2" {
+		t.Errorf("Expected [2] got %v\n", vals)
+	}
+
+	if _, err := msg.Find("OBX[5].1"); err == nil {
+		t.Error("Expected error for missing segment occurrence")
+	}
+}
+
+func TestFindRepetition(t *testing.T) {
+	data, err := readFile("./testdata/msg.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := msg.Find("PID.11[2].1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "520 51st Street" {
+		t.Errorf("Expected 520 51st Street got %s\n", val)
+	}
+	val, err = msg.Find("PID.11.1")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "123 West St." {
+		t.Errorf("Expected 123 West St. got %s\n", val)
+	}
+	vals, err := msg.FindAll("PID.11[1].3")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vals) != 1 || vals[0] != "Denver" {
+		t.Errorf("Expected [Denver] got %v\n", vals)
+	}
+}
+
+func TestSetRepetition(t *testing.T) {
+	data, err := readFile("./testdata/msg.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := msg.Set(NewLocation("PID.11[3]"), "1 Main St.^^Boulder^CO"); err != nil {
+		t.Fatal(err)
+	}
+	vals, err := msg.FindAll("PID.11.3")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vals) != 3 || vals[2] != "Boulder" {
+		t.Errorf("Expected 3 repetitions got %v\n", vals)
+	}
+	val, err := msg.Find("PID.12")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "" {
+		t.Errorf("Expected empty PID.12 got %s\n", val)
+	}
+
+	// the encoded message must keep the repetitions
+	reparsed, err := ParseMessage([]byte(string(msg.Value)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err = reparsed.Find("PID.11[3].3")
+	if err != nil {
+		t.Error(err)
+	}
+	if val != "Boulder" {
+		t.Errorf("Expected Boulder got %s\n", val)
+	}
+
+	if err := msg.Set(NewLocation("OBR[2].1"), "2"); err != nil {
+		t.Fatal(err)
+	}
+	vals, err = msg.FindAll("OBR.1")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(vals) != 2 || vals[1] != "2" {
+		t.Errorf("Expected [1 2] got %v\n", vals)
+	}
+}
+
+func TestLocationString(t *testing.T) {
+	for _, loc := range []string{"", "PID", "OBX[3].5", "PID.3[2].1", "PID.3[2].1.2", "MSH.9.1"} {
+		if s := NewLocation(loc).String(); s != loc {
+			t.Errorf("Expected %s got %s\n", loc, s)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package golevel7
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mhald/golevel7/commons"
+)
+
+// MLLP framing characters
+//
+//	\x0b MESSAGE \x1c\x0d
+const (
+	mllpStart = '\x0b'
+	mllpEnd   = '\x1c'
+)
+
+var mllpSep = []byte{mllpEnd, segTerm}
+
+// ErrServerClosed is returned by MLLPServer Serve and ListenAndServe after Close
+var ErrServerClosed = errors.New("mllp: Server closed")
+
+// MLLPHandler handles a message received by an MLLPServer
+// It returns the acknowledgement to send back, nil sends nothing
+type MLLPHandler func(msg *Message) *Message
+
+// MLLPServer accepts MLLP connections and passes every message
+// received to Handler, replying with the acknowledgement it returns
+type MLLPServer struct {
+	Addr        string        // TCP address to listen on
+	Handler     MLLPHandler   // handler to invoke, nil acknowledges every message with AA as asked by MSH-16
+	ReadTimeout time.Duration // maximum idle time on a connection, 0 means no timeout
+	ErrorLog    *log.Logger   // logger for connection and parse errors, nil uses the log package
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewMLLPServer returns a new MLLPServer listening on addr
+func NewMLLPServer(addr string, h MLLPHandler) *MLLPServer {
+	return &MLLPServer{Addr: addr, Handler: h}
+}
+
+// ListenAndServe listens on s.Addr and then calls Serve
+func (s *MLLPServer) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l, handling each one in its own goroutine
+// It always returns a non-nil error, ErrServerClosed after Close
+func (s *MLLPServer) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.trackConn(conn, true) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.trackConn(conn, false)
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Close closes all listeners and active connections and waits for the
+// connection handlers to return
+func (s *MLLPServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *MLLPServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	sc := newMLLPScanner(conn)
+	for {
+		if s.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil && !s.isClosed() {
+				s.logf("mllp: read from %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		bufs := Split(sc.Bytes())
+		if len(bufs) == 0 {
+			continue
+		}
+		ack := s.handle(bufs[0])
+		if ack == nil {
+			continue
+		}
+		if err := WriteMLLP(conn, []byte(string(ack.Value))); err != nil {
+			s.logf("mllp: write to %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handle returns the acknowledgement of the message in buf
+// a message which does not parse is acknowledged with the MSH values found by PeekHeader
+func (s *MLLPServer) handle(buf []byte) *Message {
+	msg, err := ParseMessage(buf)
+	if err != nil {
+		s.logf("mllp: %v", err)
+		mi, _, _ := PeekHeader(buf)
+		return Acknowledge(mi, err)
+	}
+	if s.Handler == nil {
+		return AcknowledgeMessage(msg, nil)
+	}
+	return s.Handler(msg)
+}
+
+func (s *MLLPServer) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	if add {
+		if s.closed {
+			return false
+		}
+		s.listeners[l] = struct{}{}
+	} else {
+		delete(s.listeners, l)
+	}
+	return true
+}
+
+func (s *MLLPServer) trackConn(c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	if add {
+		if s.closed {
+			return false
+		}
+		s.conns[c] = struct{}{}
+	} else {
+		delete(s.conns, c)
+	}
+	return true
+}
+
+func (s *MLLPServer) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *MLLPServer) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// MLLPClient sends messages over an MLLP connection and waits for their
+// acknowledgement
+type MLLPClient struct {
+	Timeout time.Duration // maximum time to wait for an ACK, 0 means no timeout
+
+	conn net.Conn
+	sc   *bufio.Scanner
+	mu   sync.Mutex
+	err  error // failure of the connection, returned by later calls of Send
+}
+
+// DialMLLP connects to the MLLP server at addr
+// timeout is used both for the dial and as the ACK timeout
+func DialMLLP(addr string, timeout time.Duration) (*MLLPClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewMLLPClient(conn, timeout), nil
+}
+
+// NewMLLPClient returns a client using the already established connection conn
+func NewMLLPClient(conn net.Conn, timeout time.Duration) *MLLPClient {
+	return &MLLPClient{
+		Timeout: timeout,
+		conn:    conn,
+		sc:      newMLLPScanner(conn),
+	}
+}
+
+// Send writes msg to the connection and waits for the ACK whose MSA-2
+// matches the MSH-10 of msg. Acknowledgements for other control ids are
+// discarded
+// A failure to write msg or read its ACK, like a timeout, closes the connection
+// and later calls return it, dial again to send other messages
+func (c *MLLPClient) Send(msg *Message) (*Message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, fmt.Errorf("mllp: connection closed after %w", c.err)
+	}
+	controlID, err := msg.Find("MSH.10")
+	if err != nil {
+		return nil, err
+	}
+	ack, err := c.roundTrip(msg, controlID)
+	if err != nil && !errors.Is(err, errInvalidAck) {
+		c.err = err
+		c.conn.Close()
+	}
+	return ack, err
+}
+
+// errInvalidAck is wrapped in the errors of Send for acknowledgements which do not parse
+var errInvalidAck = errors.New("mllp: invalid ACK")
+
+// roundTrip writes msg and reads frames until the ACK of controlID
+func (c *MLLPClient) roundTrip(msg *Message, controlID string) (*Message, error) {
+	if c.Timeout > 0 {
+		deadline := time.Now().Add(c.Timeout)
+		c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	if err := WriteMLLP(c.conn, []byte(string(msg.Value))); err != nil {
+		return nil, err
+	}
+	for {
+		if !c.sc.Scan() {
+			if err := c.sc.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.ErrUnexpectedEOF
+		}
+		// a frame can hold the ACKs of other messages
+		var perr error
+		for _, buf := range frameMessages(c.sc.Bytes()) {
+			ack, err := ParseMessage(buf)
+			if err != nil {
+				if perr == nil {
+					perr = fmt.Errorf("%w: %v", errInvalidAck, err)
+				}
+				continue
+			}
+			if id, _ := ack.Find("MSA.2"); id == controlID {
+				return ack, nil
+			}
+		}
+		if perr != nil {
+			return nil, perr
+		}
+	}
+}
+
+// frameMessages returns the messages of an MLLP frame, one after the other in a block
+// or in blocks of their own
+func frameMessages(frame []byte) [][]byte {
+	msgs := [][]byte{}
+	for _, buf := range Split(frame) {
+		sc := bufio.NewScanner(bytes.NewReader(buf))
+		sc.Buffer(make([]byte, 0, bufCap), scanBufferSize)
+		sc.Split(commons.ScanMessages)
+		for sc.Scan() {
+			msgs = append(msgs, append([]byte(nil), sc.Bytes()...))
+		}
+	}
+	return msgs
+}
+
+// Close closes the underlying connection
+func (c *MLLPClient) Close() error {
+	return c.conn.Close()
+}
+
+// WriteMLLP writes the message bytes b to w wrapped in MLLP framing
+func WriteMLLP(w io.Writer, b []byte) error {
+	buf := make([]byte, 0, len(b)+3)
+	buf = append(buf, mllpStart)
+	buf = append(buf, b...)
+	buf = append(buf, mllpSep...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func newMLLPScanner(r io.Reader) *bufio.Scanner {
+	sc := bufio.NewScanner(r)
+	buf := make([]byte, 0, bufCap)
+	sc.Buffer(buf, scanBufferSize)
+	sc.Split(splitMLLP)
+	return sc
+}
+
+// scanBufferSize is the largest MLLP frame accepted
+const scanBufferSize = 10 * 1024 * 1024
+
+// splitMLLP is a bufio.SplitFunc returning one MLLP frame at a time
+// bytes found before the start of a frame are dropped
+func splitMLLP(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.Index(data, mllpSep); i >= 0 {
+		frame := data[:i+len(mllpSep)]
+		if start := bytes.IndexByte(frame, mllpStart); start >= 0 {
+			frame = frame[start:]
+		}
+		return i + len(mllpSep), frame, nil
+	}
+	if atEOF && len(bytes.TrimSpace(data)) != 0 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,221 @@
+package golevel7
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startMLLPServer(t *testing.T, h MLLPHandler) (*MLLPServer, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewMLLPServer("", h)
+	srv.ErrorLog = log.New(ioutil.Discard, "", 0)
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return srv, l.Addr().String()
+}
+
+func TestMLLPSendAndAck(t *testing.T) {
+	received := make(chan string, 1)
+	_, addr := startMLLPServer(t, func(msg *Message) *Message {
+		name, _ := msg.Find("PID.5.1")
+		received <- name
+		mi, _ := msg.Info()
+		return Acknowledge(mi, nil)
+	})
+
+	data, err := readFile("./testdata/msg.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := DialMLLP(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 2; i++ {
+		ack, err := c.Send(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "Jones", <-received)
+		code, _ := ack.Find("MSA.1")
+		assert.Equal(t, "AA", code)
+		id, _ := ack.Find("MSA.2")
+		assert.Equal(t, "MSGID20060307110114", id)
+	}
+}
+
+func TestMLLPParseError(t *testing.T) {
+	_, addr := startMLLPServer(t, func(msg *Message) *Message {
+		t.Error("handler should not be called for an invalid message")
+		return nil
+	})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := WriteMLLP(conn, []byte("XXX|^~\\&|A|B")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	sc := newMLLPScanner(conn)
+	if !sc.Scan() {
+		t.Fatal(sc.Err())
+	}
+	ack, err := ParseMessage(Split(sc.Bytes())[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := ack.Find("MSA.1")
+	assert.Equal(t, "AE", code)
+
+	// the header of a message with a malformed segment is acknowledged
+	if err := WriteMLLP(conn, []byte("MSH|^~\\&|APP|FAC|RAPP|RFAC|20230101||ADT^A01|ID42|P|2.5\rPID|1\r1X|a\r")); err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Scan() {
+		t.Fatal(sc.Err())
+	}
+	ack, err = ParseMessage(Split(sc.Bytes())[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for loc, want := range map[string]string{
+		"MSA.1": "AE", "MSA.2": "ID42", "MSH.3": "RAPP", "MSH.4": "RFAC",
+		"MSH.5": "APP", "MSH.6": "FAC", "MSH.11": "P", "MSH.12": "2.5",
+	} {
+		got, _ := ack.Find(loc)
+		assert.Equal(t, want, got, loc)
+	}
+}
+
+func TestMLLPAckTimeout(t *testing.T) {
+	release := make(chan struct{})
+	_, addr := startMLLPServer(t, func(msg *Message) *Message {
+		<-release
+		return nil
+	})
+	defer close(release)
+
+	c, err := DialMLLP(addr, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	msg, err := StartMessage(MsgInfo{MessageType: "ADT^A01", ControlID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Send(msg)
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("Expected timeout got %v", err)
+	}
+
+	// the connection is closed after a failure
+	start := time.Now()
+	_, err = c.Send(msg)
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("Expected timeout got %v", err)
+	}
+	assert.Contains(t, err.Error(), "connection closed")
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestMLLPAcksInOneFrame(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := newMLLPScanner(conn)
+		for sc.Scan() {
+			msg, err := ParseMessage(Split(sc.Bytes())[0])
+			if err != nil {
+				return
+			}
+			mi, _ := msg.Info()
+			stale := mi
+			stale.ControlID = "STALE"
+			// the ACK follows the one of another message in the same frame
+			frame := append(Acknowledge(stale, nil).Encode(), '\r')
+			frame = append(frame, Acknowledge(mi, nil).Encode()...)
+			WriteMLLP(conn, frame)
+		}
+	}()
+
+	c, err := DialMLLP(l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, id := range []string{"1", "2"} {
+		msg, err := StartMessage(MsgInfo{MessageType: "ADT^A01", ControlID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ack, err := c.Send(msg)
+		if !assert.NoError(t, err) {
+			return
+		}
+		got, _ := ack.Find("MSA.2")
+		assert.Equal(t, id, got)
+	}
+}
+
+func TestMLLPIgnoresOtherAcks(t *testing.T) {
+	_, addr := startMLLPServer(t, func(msg *Message) *Message {
+		mi, _ := msg.Info()
+		stale := mi
+		stale.ControlID = "STALE"
+		return Acknowledge(stale, nil)
+	})
+	c, err := DialMLLP(addr, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	msg, err := StartMessage(MsgInfo{MessageType: "ADT^A01", ControlID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Send(msg); err == nil {
+		t.Fatal("Expected error for an ACK with another control id")
+	}
+}
+
+func TestSplitMLLP(t *testing.T) {
+	data := []byte("\n\x0bMSH|1\x1c\x0d\x0bMSH|2\x1c\x0d")
+	adv, tok, err := splitMLLP(data, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, adv)
+	assert.Equal(t, "\x0bMSH|1\x1c\x0d", string(tok))
+	adv, tok, err = splitMLLP(data[adv:], true)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, adv)
+	assert.Equal(t, "\x0bMSH|2\x1c\x0d", string(tok))
+	_, _, err = splitMLLP([]byte("\x0bMSH|3"), true)
+	assert.NotNil(t, err)
+}
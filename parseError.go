@@ -0,0 +1,59 @@
+package golevel7
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes where parsing of a message failed
+type ParseError struct {
+	MsgIndex    int    // index of the message in a stream, 0 for a single message
+	Offset      int    // rune offset into the message value where parsing broke
+	Segment     int    // index of the segment in the message, -1 if not known
+	SegmentName string // name of the segment, "" if not known
+	FieldSeq    int    // field sequence number, -1 if not known
+	Err         error  // underlying error
+}
+
+func (e *ParseError) Error() string {
+	loc := []string{fmt.Sprintf("offset %d", e.Offset)}
+	if e.Segment >= 0 {
+		loc = append(loc, fmt.Sprintf("segment %d", e.Segment))
+	}
+	if e.SegmentName != "" {
+		name := e.SegmentName
+		if e.FieldSeq >= 0 {
+			name = fmt.Sprintf("%s.%d", name, e.FieldSeq)
+		}
+		loc = append(loc, name)
+	}
+	return fmt.Sprintf("Parse Error: %v (%s)", e.Err, strings.Join(loc, ", "))
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors is a list of parse errors for a stream of messages
+type ParseErrors []*ParseError
+
+func (pe ParseErrors) Error() string {
+	switch len(pe) {
+	case 0:
+		return "no parse errors"
+	case 1:
+		return fmt.Sprintf("message %d: %v", pe[0].MsgIndex, pe[0])
+	}
+	return fmt.Sprintf("message %d: %v (and %d more errors)", pe[0].MsgIndex, pe[0], len(pe)-1)
+}
+
+func newParseError(offset, seg int, segName string, fieldSeq int, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Offset:      offset,
+		Segment:     seg,
+		SegmentName: segName,
+		FieldSeq:    fieldSeq,
+		Err:         fmt.Errorf(format, args...),
+	}
+}
@@ -0,0 +1,406 @@
+package golevel7
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Usage of a segment, field or component in a conformance profile
+type Usage string
+
+// Usage values
+const (
+	UsageRequired        Usage = "R"  // must be present
+	UsageRequiredOrEmpty Usage = "RE" // must be sent when known, may be empty
+	UsageOptional        Usage = "O"  // may be present
+	UsageNotSupported    Usage = "X"  // must not be present
+)
+
+// Profile is a conformance profile for a message type and version
+// Profiles are loaded from YAML or JSON, see ParseProfile
+//
+//	messageType: ORU^R01
+//	version: "2.5"
+//	segments:
+//	  - name: PID
+//	    usage: R
+//	    max: 1
+//	    fields:
+//	      - seq: 3
+//	        usage: R
+//	        dataType: CX
+//	      - seq: 8
+//	        usage: RE
+//	        maxLength: 1
+//	        table: "0001"
+//	rules:
+//	  - {location: PID.3.1, check: MatchesRegex, value: "[0-9]+"}
+//
+// Rules are Validations checked with the segments, a []Validation of the Validation helpers
+// can be checked as a profile with Rules set to it
+type Profile struct {
+	MessageType string              `json:"messageType" yaml:"messageType"` // MSH.9 message type and trigger event, ORU^R01
+	Version     string              `json:"version" yaml:"version"`         // MSH.12 version id
+	Description string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Segments    []*SegmentProfile   `json:"segments" yaml:"segments"`
+	Tables      map[string][]string `json:"tables,omitempty" yaml:"tables,omitempty"` // code tables of the profile, override the registered ones
+	Rules       []Validation        `json:"rules,omitempty" yaml:"rules,omitempty"`   // other checks, see Message.Validate
+}
+
+// SegmentProfile describes the usage and content of a segment
+// Min and Max are the number of occurrences, Max 0 is unbounded
+type SegmentProfile struct {
+	Name   string          `json:"name" yaml:"name"`
+	Usage  Usage           `json:"usage" yaml:"usage"`
+	Min    int             `json:"min,omitempty" yaml:"min,omitempty"`
+	Max    int             `json:"max,omitempty" yaml:"max,omitempty"`
+	Fields []*FieldProfile `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// FieldProfile describes a field, Min and Max are the number of repetitions, Max 0 is unbounded
+// MaxLength, DataType, Table and Value apply to each repetition
+type FieldProfile struct {
+	Seq        int                 `json:"seq" yaml:"seq"`
+	Name       string              `json:"name,omitempty" yaml:"name,omitempty"`
+	Usage      Usage               `json:"usage" yaml:"usage"`
+	Min        int                 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max        int                 `json:"max,omitempty" yaml:"max,omitempty"`
+	MaxLength  int                 `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	DataType   string              `json:"dataType,omitempty" yaml:"dataType,omitempty"`
+	Table      string              `json:"table,omitempty" yaml:"table,omitempty"` // code table of the value, the first component for coded types
+	Value      string              `json:"value,omitempty" yaml:"value,omitempty"` // fixed value
+	Components []*ComponentProfile `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+// ComponentProfile describes a component of a field
+type ComponentProfile struct {
+	Seq       int    `json:"seq" yaml:"seq"`
+	Name      string `json:"name,omitempty" yaml:"name,omitempty"`
+	Usage     Usage  `json:"usage" yaml:"usage"`
+	MaxLength int    `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	DataType  string `json:"dataType,omitempty" yaml:"dataType,omitempty"`
+	Table     string `json:"table,omitempty" yaml:"table,omitempty"`
+	Value     string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// ParseProfile parses a YAML or JSON conformance profile
+func ParseProfile(data []byte) (*Profile, error) {
+	p := &Profile{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("Invalid profile: %v", err)
+	}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReadProfile reads a YAML or JSON conformance profile from r
+func ReadProfile(r io.Reader) (*Profile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProfile(data)
+}
+
+// LoadProfile reads a YAML or JSON conformance profile from the file name
+func LoadProfile(name string) (*Profile, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParseProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return p, nil
+}
+
+// check validates the profile definition itself
+func (p *Profile) check() error {
+	if p.MessageType == "" {
+		return fmt.Errorf("Invalid profile: messageType is required")
+	}
+	validUsage := func(u Usage) bool {
+		switch u {
+		case "", UsageRequired, UsageRequiredOrEmpty, UsageOptional, UsageNotSupported:
+			return true
+		}
+		return false
+	}
+	for _, s := range p.Segments {
+		if !isSegmentName([]rune(s.Name)) {
+			return fmt.Errorf("Invalid profile: segment name %q", s.Name)
+		}
+		if !validUsage(s.Usage) {
+			return fmt.Errorf("Invalid profile: %s usage %q", s.Name, s.Usage)
+		}
+		for _, f := range s.Fields {
+			if f.Seq < 1 || !validUsage(f.Usage) {
+				return fmt.Errorf("Invalid profile: %s.%d field seq or usage %q", s.Name, f.Seq, f.Usage)
+			}
+			for _, c := range f.Components {
+				if c.Seq < 1 || !validUsage(c.Usage) {
+					return fmt.Errorf("Invalid profile: %s.%d.%d component seq or usage %q", s.Name, f.Seq, c.Seq, c.Usage)
+				}
+			}
+		}
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// table returns the values of the code table id, the profile tables first
+func (p *Profile) table(id string) ([]string, bool) {
+	for tid, vals := range p.Tables {
+		if tableID(tid) == tableID(id) {
+			return vals, true
+		}
+	}
+	return LookupTable(id)
+}
+
+// Validate checks m against the profile and reports every violation found
+// A message type (MSH.9) or version (MSH.12) other than the ones of the profile is a violation
+func (p *Profile) Validate(m *Message) *ValidationReport {
+	vs := p.validateHeader(m)
+	for _, sp := range p.Segments {
+		segs, _ := m.AllSegments(sp.Name)
+		loc := &Location{Segment: sp.Name, FieldSeq: -1, Comp: -1, SubComp: -1}
+		rule := sp.Name + ":"
+		min := sp.Min
+		if sp.Usage == UsageRequired && min < 1 {
+			min = 1
+		}
+		switch {
+		case sp.Usage == UsageNotSupported && len(segs) > 0:
+			vs = append(vs, newViolation(loc, "", ErrCodeSegmentSequence, rule+"usage", "segment %s is not supported", sp.Name))
+		case len(segs) < min:
+			vs = append(vs, newViolation(loc, "", ErrCodeSegmentSequence, rule+"min", "segment %s occurs %d times, at least %d required", sp.Name, len(segs), min))
+		case sp.Max > 0 && len(segs) > sp.Max:
+			vs = append(vs, newViolation(loc, "", ErrCodeSegmentSequence, rule+"max", "segment %s occurs %d times, at most %d allowed", sp.Name, len(segs), sp.Max))
+		}
+		for i, seg := range segs {
+			for _, fp := range sp.Fields {
+				vs = append(vs, p.validateField(m, seg, i+1, fp)...)
+			}
+		}
+	}
+	vs = append(vs, m.Validate(p.Rules).Violations...)
+	return &ValidationReport{Violations: vs}
+}
+
+// validateHeader checks the message type and version of m are the ones of the profile
+func (p *Profile) validateHeader(m *Message) Violations {
+	vs := Violations{}
+	want := strings.Split(p.MessageType, "^")
+	for i, code := range []ErrorCode{ErrCodeUnsupportedMsgType, ErrCodeUnsupportedEvent} {
+		if i >= len(want) {
+			break
+		}
+		if got, _ := m.Find(fmt.Sprintf("MSH.9.%d", i+1)); got != want[i] {
+			msgType, _ := m.Find("MSH.9")
+			loc := &Location{Segment: "MSH", SegIdx: 1, FieldSeq: 9, Comp: -1, SubComp: -1}
+			vs = append(vs, newViolation(loc, msgType, code, "MSH.9:messageType", "expected message type %s", p.MessageType))
+			break
+		}
+	}
+	if version, _ := m.Find("MSH.12.1"); p.Version != "" && version != p.Version {
+		loc := &Location{Segment: "MSH", SegIdx: 1, FieldSeq: 12, Comp: -1, SubComp: -1}
+		vs = append(vs, newViolation(loc, version, ErrCodeUnsupportedVersion, "MSH.12:version", "expected version %s", p.Version))
+	}
+	return vs
+}
+
+// validateField checks the repetitions of field fp of occurrence n of segment seg
+func (p *Profile) validateField(m *Message, seg *Segment, n int, fp *FieldProfile) Violations {
+	vs := Violations{}
+	name := seg.Name()
+	loc := &Location{Segment: name, SegIdx: n, FieldSeq: fp.Seq, Comp: -1, SubComp: -1}
+	rule := fmt.Sprintf("%s.%d:", name, fp.Seq)
+
+	flds, _ := seg.AllFields(fp.Seq)
+	count := len(flds)
+	for count > 0 && len(flds[count-1].Value) == 0 {
+		// trailing empty repetitions are not sent
+		count--
+	}
+	min := fp.Min
+	if fp.Usage == UsageRequired && min < 1 {
+		min = 1
+	}
+	switch {
+	case fp.Usage == UsageNotSupported && count > 0:
+		vs = append(vs, newViolation(loc, "", ErrCodeDataType, rule+"usage", "field %s.%d is not supported", name, fp.Seq))
+	case count < min:
+		code := ErrCodeRequiredFieldMissing
+		msg := fmt.Sprintf("field %s.%d is required", name, fp.Seq)
+		if count > 0 {
+			msg = fmt.Sprintf("field %s.%d repeats %d times, at least %d required", name, fp.Seq, count, min)
+		}
+		vs = append(vs, newViolation(loc, "", code, rule+"min", "%s", msg))
+	case fp.Max > 0 && count > fp.Max:
+		vs = append(vs, newViolation(loc, "", ErrCodeDataType, rule+"max", "field %s.%d repeats %d times, at most %d allowed", name, fp.Seq, count, fp.Max))
+	}
+
+	for r := 0; r < count; r++ {
+		fld := flds[r]
+		rloc := *loc
+		rloc.FieldRep = r + 1
+		val := Unescape(string(fld.Value), &m.Delimeters)
+		first := val
+		if len(fld.Components) > 0 {
+			first = Unescape(string(fld.Components[0].Value), &m.Delimeters)
+		}
+		checkVal := val
+		if len(fp.Components) != 0 || strings.ToUpper(fp.DataType) == "TS" {
+			checkVal = first
+		}
+		vs = append(vs, p.validateValue(&rloc, rule, val, checkVal, first, fp.MaxLength, fp.DataType, fp.Table, fp.Value)...)
+
+		for _, cp := range fp.Components {
+			cloc := rloc
+			cloc.Comp = cp.Seq
+			crule := fmt.Sprintf("%s.%d.%d:", name, fp.Seq, cp.Seq)
+			cval := ""
+			if cp.Seq <= len(fld.Components) {
+				cval = Unescape(string(fld.Components[cp.Seq-1].Value), &m.Delimeters)
+			}
+			switch {
+			case cp.Usage == UsageRequired && cval == "":
+				vs = append(vs, newViolation(&cloc, "", ErrCodeRequiredFieldMissing, crule+"usage", "component %s.%d.%d is required", name, fp.Seq, cp.Seq))
+			case cp.Usage == UsageNotSupported && cval != "":
+				vs = append(vs, newViolation(&cloc, cval, ErrCodeDataType, crule+"usage", "component %s.%d.%d is not supported", name, fp.Seq, cp.Seq))
+			}
+			vs = append(vs, p.validateValue(&cloc, crule, cval, cval, cval, cp.MaxLength, cp.DataType, cp.Table, cp.Value)...)
+		}
+	}
+	return vs
+}
+
+// validateValue checks the length, data type, table and fixed value of val
+// the data type is checked on checkVal and the table on code
+func (p *Profile) validateValue(loc *Location, rule, val, checkVal, code string, maxLength int, dataType, table, fixed string) Violations {
+	vs := Violations{}
+	if val == "" {
+		return vs
+	}
+	if maxLength > 0 && utf8.RuneCountInString(val) > maxLength {
+		vs = append(vs, newViolation(loc, val, ErrCodeValueTooLong, rule+"maxLength", "value is %d characters long, at most %d allowed", utf8.RuneCountInString(val), maxLength))
+	}
+	if dataType != "" {
+		if err := CheckDataType(dataType, checkVal); err != nil {
+			vs = append(vs, newViolation(loc, val, ErrCodeDataType, rule+"dataType", "%v for data type %s", err, dataType))
+		}
+	}
+	if table != "" {
+		if vals, ok := p.table(table); !ok {
+			vs = append(vs, newViolation(loc, val, ErrCodeTableValueNotFound, rule+"table", "unknown table %s", table))
+		} else if !inTable(vals, code) {
+			vs = append(vs, newViolation(loc, val, ErrCodeTableValueNotFound, rule+"table", "%q is not in table %s", code, table))
+		}
+	}
+	if fixed != "" && val != fixed {
+		vs = append(vs, newViolation(loc, val, ErrCodeTableValueNotFound, rule+"value", "expected %q", fixed))
+	}
+	return vs
+}
+
+// newViolation returns an error Violation
+func newViolation(loc *Location, val string, code ErrorCode, rule, format string, args ...interface{}) *Violation {
+	l := *loc
+	return &Violation{
+		Location: &l,
+		Value:    val,
+		Code:     code,
+		Severity: SeverityError,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+//go:embed profiles/*.yaml
+var builtinProfiles embed.FS
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]*Profile{}
+)
+
+func init() {
+	entries, _ := builtinProfiles.ReadDir("profiles")
+	for _, e := range entries {
+		RegisterProfile(builtinProfile(e.Name()))
+	}
+}
+
+// builtinProfile parses the built in profile file name
+func builtinProfile(name string) *Profile {
+	data, _ := builtinProfiles.ReadFile("profiles/" + name)
+	p, err := ParseProfile(data)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", name, err))
+	}
+	return p
+}
+
+// ormDietaryOrder24 returns the built in ORM^O01 2.4 profile the Validation helpers
+// are made from, a profile registered in its place does not change them
+var ormDietaryOrder24 = sync.OnceValue(func() *Profile {
+	return builtinProfile("orm_o01_2.4.yaml")
+})
+
+// profileKey returns the registry key of a message type and version
+func profileKey(msgType, version string) string {
+	parts := strings.Split(msgType, "^")
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, "^") + "|" + version
+}
+
+// RegisterProfile makes p available to LookupProfile and ValidateMessage
+// It replaces a profile registered for the same message type and version
+func RegisterProfile(p *Profile) {
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[profileKey(p.MessageType, p.Version)] = p
+}
+
+// LookupProfile returns the profile registered for the message type (MSH.9) and version (MSH.12)
+// a profile registered without a version is used for every version
+func LookupProfile(msgType, version string) (*Profile, error) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	if p, ok := profiles[profileKey(msgType, version)]; ok {
+		return p, nil
+	}
+	if p, ok := profiles[profileKey(msgType, "")]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("No profile for message type %q version %q", msgType, version)
+}
+
+// ValidateMessage checks m against the profile registered for its message type and version
+func ValidateMessage(m *Message) (*ValidationReport, error) {
+	code, _ := m.Find("MSH.9.1")
+	event, _ := m.Find("MSH.9.2")
+	version, _ := m.Find("MSH.12.1")
+	p, err := LookupProfile(code+"^"+event, version)
+	if err != nil {
+		return nil, err
+	}
+	return p.Validate(m), nil
+}
@@ -0,0 +1,257 @@
+package golevel7
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const oruProfile = `
+messageType: ORU^R01
+version: "2.5"
+tables:
+  "9999": [GLU, WBC]
+segments:
+  - name: MSH
+    usage: R
+    max: 1
+  - name: PID
+    usage: R
+    max: 1
+    fields:
+      - {seq: 3, usage: R, min: 1, max: 2}
+      - {seq: 5, usage: R, components: [{seq: 1, usage: R, maxLength: 5}, {seq: 2, usage: RE}]}
+      - {seq: 7, usage: RE, dataType: TS}
+      - {seq: 8, usage: RE, table: "0001"}
+      - {seq: 19, usage: X}
+  - name: OBX
+    usage: R
+    fields:
+      - {seq: 1, usage: R, dataType: SI}
+      - {seq: 3, usage: R, table: "9999"}
+      - {seq: 5, usage: RE, dataType: NM, maxLength: 4}
+  - name: NK1
+    usage: X
+  - name: NTE
+    usage: O
+    max: 1
+`
+
+func TestProfileValidate(t *testing.T) {
+	p, err := ParseProfile([]byte(oruProfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "MSH|^~\\&|LAB|PA|EPIC|IHS|20050615230600||ORU^R01|1|P|2.5\r" +
+		"PID|1||1~2~3||Jonesington^John||1967082|Z|||||||||||123-45-6789\r" +
+		"NK1|1|Jones^Jane\r" +
+		"OBX|1|NM|GLU||182|mg/dl\r" +
+		"OBX|A|NM|HGB^Hemoglobin||12.55\r" +
+		"NTE|1\r" +
+		"NTE|2"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := p.Validate(msg)
+	assert.False(t, report.Valid())
+	vs := report.Violations
+	got := map[string]*Violation{}
+	for _, v := range vs {
+		got[v.Location.String()+" "+v.Rule] = v
+	}
+	want := map[string]ErrorCode{
+		"PID[1].3 PID.3:max":              ErrCodeDataType,
+		"PID[1].5[1].1 PID.5.1:maxLength": ErrCodeValueTooLong,
+		"PID[1].7[1] PID.7:dataType":      ErrCodeDataType,
+		"PID[1].8[1] PID.8:table":         ErrCodeTableValueNotFound,
+		"PID[1].19 PID.19:usage":          ErrCodeDataType,
+		"NK1 NK1:usage":                   ErrCodeSegmentSequence,
+		"OBX[2].1[1] OBX.1:dataType":      ErrCodeDataType,
+		"OBX[2].3[1] OBX.3:table":         ErrCodeTableValueNotFound,
+		"OBX[2].5[1] OBX.5:maxLength":     ErrCodeValueTooLong,
+		"NTE NTE:max":                     ErrCodeSegmentSequence,
+	}
+	for k, code := range want {
+		if v, ok := got[k]; assert.True(t, ok, k) {
+			assert.Equal(t, code, v.Code, k)
+			assert.Equal(t, SeverityError, v.Severity, k)
+		}
+	}
+	assert.Equal(t, len(want), len(vs), vs.Error())
+	assert.Equal(t, "Z", got["PID[1].8[1] PID.8:table"].Value)
+	assert.Equal(t, "HGB^Hemoglobin", got["OBX[2].3[1] OBX.3:table"].Value)
+
+	errs := report.HL7Errors()
+	assert.Equal(t, len(vs), len(errs))
+	ack := AcknowledgeMessage(msg, report.Err())
+	segs, _ := ack.AllSegments("ERR")
+	assert.Equal(t, len(vs), len(segs))
+
+	// required segments and fields
+	msg, err = ParseMessage([]byte("MSH|^~\\&|LAB|PA|EPIC|IHS|20050615230600||ORU^R01|1|P|2.5\rPID|1||||^John"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs = p.Validate(msg).Violations
+	rules := []string{}
+	for _, v := range vs {
+		rules = append(rules, v.Rule)
+	}
+	assert.Equal(t, []string{"PID.3:min", "PID.5.1:usage", "OBX:min"}, rules)
+	assert.Equal(t, ErrCodeRequiredFieldMissing, vs[0].Code)
+}
+
+func TestProfileJSON(t *testing.T) {
+	p, err := ParseProfile([]byte(`{"messageType": "ADT^A08", "segments": [{"name": "EVN", "usage": "R"}, {"name": "PID", "usage": "R", "fields": [{"seq": 8, "usage": "R", "table": "HL70001"}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterProfile(p)
+	msg, err := ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20070910144846||ADT^A08|1|P|2.3\rPID|1||12001||Jones^John||19670824|F"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := ValidateMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Equal(t, 1, len(report.Violations)) {
+		assert.Equal(t, "EVN:min", report.Violations[0].Rule)
+	}
+
+	for _, bad := range []string{`segments: []`, `{"messageType": "A", "segments": [{"name": "pid"}]}`, `{"messageType": "A", "segments": [{"name": "PID", "usage": "Q"}]}`} {
+		_, err := ParseProfile([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+	_, err = ParseProfile([]byte(`{"messageType": "A", "segments": [{"name": "PID", "usage": "Q"}]}`))
+	assert.EqualError(t, err, `Invalid profile: PID usage "Q"`)
+}
+
+func TestBuiltinProfile(t *testing.T) {
+	p, err := LookupProfile("ORM^O01", "2.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "MSH|^~\\&|A|B|C|D|20070910144846||ORM^O01|1|P|2.4\r" +
+		"PID|1||12001||Jones^John||19670824|M\r" +
+		"PV1|1|I\r" +
+		"ORC|NW\r" +
+		"ODS|D|B|^Regular"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := p.Validate(msg)
+	assert.True(t, report.Valid(), report.Error())
+	assert.Nil(t, report.Err())
+
+	msg, err = ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20070910144846||ORM^O02|1|X|2.4\rPID|1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []string{}
+	for _, v := range p.Validate(msg).Violations {
+		rules = append(rules, v.Rule)
+	}
+	assert.Equal(t, []string{"MSH.9:messageType", "MSH.9.2:value", "MSH.11:table", "PID.3:min", "PID.5:min", "PV1:min", "ORC:min"}, rules)
+
+	// message type and version of the profile
+	for data, want := range map[string][]string{
+		"ADT^A01|1|P|2.4": {"MSH.9:messageType 200 ADT^A01"},
+		"ORM^O01|1|P|2.5": {"MSH.12:version 203 2.5"},
+		"ORM|1|P|2.4":     {"MSH.9:messageType 201 ORM"},
+	} {
+		msg, err := ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20070910144846||" + data + "\rPID|1||12001||Jones^John\rPV1|1\rORC|NW"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, v := range p.Validate(msg).Violations {
+			if v.Rule == "MSH.9:messageType" || v.Rule == "MSH.12:version" {
+				got = append(got, fmt.Sprintf("%s %d %s", v.Rule, v.Code, v.Value))
+			}
+		}
+		assert.Equal(t, want, got, data)
+	}
+}
+
+func TestProfileRules(t *testing.T) {
+	p, err := ParseProfile([]byte(`
+messageType: ADT^A01
+rules:
+  - {location: PID.3.1, check: MatchesRegex, value: "[0-9]+"}
+  - {location: PID.8, check: InTable, value: "0001", severity: W}
+  - location: PV1.19
+    check: HasValue
+    id: visit
+    when: {location: PV1.2, check: SpecificValue, value: I}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20070910144846||ADT^A01|1|P|2.4\rPID|1||A1||Jones||19670824|Z\rPV1|1|I"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []string{}
+	for _, v := range p.Validate(msg).Violations {
+		rules = append(rules, v.Rule+" "+string(v.Severity))
+	}
+	assert.Equal(t, []string{"PID.3.1:MatchesRegex E", "PID.8:InTable W", "visit E"}, rules)
+
+	// the Validation helpers as a profile
+	p = &Profile{MessageType: "ORM^O01", Version: "2.4", Rules: NewValidORMDietaryOrder24()}
+	msg, err = ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20070910144846||ORM^O01|1|P|2.4\rPID|1||12001\rPV1|1\rORC|NW"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules = []string{}
+	for _, v := range p.Validate(msg).Violations {
+		rules = append(rules, v.Rule)
+	}
+	assert.Equal(t, []string{"PID.5:HasValue"}, rules)
+
+	for _, bad := range []string{
+		"messageType: A\nrules: [{location: PID.3, check: IsValid}]",
+		"messageType: A\nrules: [{check: HasValue}]",
+		"messageType: A\nrules: [{location: PID.3, check: Predicate}]",
+		"messageType: A\nrules: [{location: PID.3, check: MatchesRegex, value: \"[\"}]",
+		"messageType: A\nrules: [{location: PID.3, check: HasValue, when: {check: HasValue}}]",
+	} {
+		_, err := ParseProfile([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCheckDataType(t *testing.T) {
+	valid := map[string][]string{
+		"NM":  {"1", "-1.5", "+.5", "10."},
+		"SI":  {"1", "0042"},
+		"DT":  {"2006", "200603", "20060307"},
+		"TM":  {"11", "1101", "110114.25", "1101-0500"},
+		"DTM": {"20060307110114.1234-0500"},
+		"TS":  {"200603071101"},
+		"ID":  {"ORM"},
+		"ST":  {"any text"},
+	}
+	for dt, vals := range valid {
+		for _, v := range vals {
+			assert.NoError(t, CheckDataType(dt, v), dt+" "+v)
+		}
+	}
+	invalid := map[string][]string{
+		"NM":  {"1,5", "abc", "1.2.3"},
+		"SI":  {"-1", "1.0"},
+		"DT":  {"20061301", "2006030"},
+		"TM":  {"25", "11015"},
+		"DTM": {"2006-03-07"},
+		"IS":  {"A B"},
+	}
+	for dt, vals := range invalid {
+		for _, v := range vals {
+			assert.Error(t, CheckDataType(dt, v), dt+" "+v)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package golevel7
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// RawMessage is an HL7 message parsed once from bytes into offsets
+// Values are only converted to strings when they are read, a RawMessage
+// is meant for reading values from a high volume of messages, use Message
+// to edit or unmarshal them
+//
+// The RawMessage references the bytes it is parsed from, they must not be changed
+// while it is used. The bytes are expected to be UTF-8 with ASCII delimeters,
+// ParseMessage handles other character sets
+type RawMessage struct {
+	Delimeters Delimeters
+	data       []byte
+	segs       []rawSegment
+	fields     []int // start and end offsets of the fields of all segments
+}
+
+// rawSegment holds the offsets of a segment in RawMessage.data
+// and the range of its fields in RawMessage.fields
+type rawSegment struct {
+	start, end int
+	field      int // index of the start of the first field in fields
+	nfields    int
+}
+
+// ParseRaw parses data into a RawMessage
+// errors are a *ParseError like for ParseMessage
+func ParseRaw(data []byte) (*RawMessage, error) {
+	m := &RawMessage{}
+	if err := m.Parse(data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Parse parses data into m reusing the memory of the message previously parsed
+// parsing into the same RawMessage again does not allocate
+func (m *RawMessage) Parse(data []byte) error {
+	return m.parse(data, false)
+}
+
+// parse parses data into m, only its first segment if header is set
+func (m *RawMessage) parse(data []byte, header bool) error {
+	m.segs = m.segs[:0]
+	m.fields = m.fields[:0]
+	// like ParseMessage MLLP framing and blank lines around the message are dropped
+	// and the terminators of the last segment kept
+	start := 0
+	for start < len(data) && isFraming(data[start]) {
+		start++
+	}
+	data = data[start:]
+	end := len(data)
+	for end > 0 && isFraming(data[end-1]) {
+		end--
+	}
+	term := end
+	for term < len(data) && (data[term] == '\r' || data[term] == '\n') {
+		term++
+	}
+	m.data = data[:term]
+	d, err := parseDelimeters(m.data)
+	if err != nil {
+		return err
+	}
+	for _, ch := range []rune{d.Field, d.Component, d.Repetition, d.Escape, d.SubComponent, d.Truncate} {
+		if ch >= 0x80 {
+			return newParseError(0, 0, "MSH", 2, "Invalid delimeter %q, only ASCII delimeters are supported", ch)
+		}
+	}
+	m.Delimeters = d
+	if header {
+		// the header ends with the first line
+		if i := bytes.IndexAny(m.data[:end], "\r\n"); i >= 0 {
+			end = i
+		}
+		return m.parseSegment(0, end, 0)
+	}
+	// size the indexes once, fields are counted by their separators
+	nsegs := bytes.Count(m.data[:end], []byte{byte(segTerm)}) + 1
+	if cap(m.segs) < nsegs {
+		m.segs = make([]rawSegment, 0, nsegs)
+	}
+	if n := 2 * (bytes.Count(m.data[:end], []byte{byte(d.Field)}) + nsegs); cap(m.fields) < n {
+		m.fields = make([]int, 0, n)
+	}
+	start = 0
+	for n := 0; start <= end; n++ {
+		segEnd := bytes.IndexByte(m.data[start:end], byte(segTerm))
+		if segEnd < 0 {
+			segEnd = end
+		} else {
+			segEnd += start
+		}
+		if segEnd > start { // empty segments are skipped but numbered like in Message
+			if err := m.parseSegment(start, segEnd, n); err != nil {
+				return err
+			}
+		}
+		start = segEnd + 1
+	}
+	return nil
+}
+
+// isFraming reports if b is MLLP framing or a line terminator around the message
+func isFraming(b byte) bool {
+	return b == '\n' || b == '\r' || b == '\x1c' || b == '\x0b'
+}
+
+// parseSegment indexes the fields of the segment from start to end, segment n of the message
+// the segment number and rune offset of errors are the ones of ParseMessage
+func (m *RawMessage) parseSegment(start, end, n int) error {
+	v := m.data[start:end]
+	if len(v) < 3 || !isRawSegmentName(v[:3]) {
+		name := string(v)
+		if len(v) > 3 {
+			name = string(v[:3])
+		}
+		return newParseError(utf8.RuneCount(m.data[:start]), n, name, 0, "Invalid segment name %q", name)
+	}
+	fs := byte(m.Delimeters.Field)
+	if len(v) > 3 && v[3] != fs {
+		return newParseError(utf8.RuneCount(m.data[:start+3]), n, string(v[:3]), 0, "Invalid segment: expected field separator after %q", string(v[:3]))
+	}
+	seg := rawSegment{start: start, end: end, field: len(m.fields)}
+	m.fields = append(m.fields, start, start+3)
+	i := start + 4
+	if string(v[:3]) == "MSH" {
+		// MSH.1 is the field separator itself
+		m.fields = append(m.fields, start+3, start+4)
+	}
+	for i <= end {
+		next := bytes.IndexByte(m.data[i:end], fs)
+		if next < 0 {
+			next = end
+		} else {
+			next += i
+		}
+		m.fields = append(m.fields, i, next)
+		i = next + 1
+	}
+	seg.nfields = (len(m.fields) - seg.field) / 2
+	m.segs = append(m.segs, seg)
+	return nil
+}
+
+// isRawSegmentName is isSegmentName for bytes
+func isRawSegmentName(name []byte) bool {
+	for _, ch := range name {
+		if !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Bytes returns the message as parsed, without MLLP framing
+func (m *RawMessage) Bytes() []byte {
+	return m.data
+}
+
+// NumSegments returns the number of segments of the message
+// empty segments are not counted, unlike in Message.Segments
+func (m *RawMessage) NumSegments() int {
+	return len(m.segs)
+}
+
+// Message parses the RawMessage into a Message
+func (m *RawMessage) Message() (*Message, error) {
+	return ParseMessage(m.data)
+}
+
+// Find gets a value from a message using location syntax
+// see Message.Find
+func (m *RawMessage) Find(loc string) (string, error) {
+	return m.Get(NewLocation(loc))
+}
+
+// FindAll gets all values from a message using location syntax
+// see Message.FindAll
+func (m *RawMessage) FindAll(loc string) ([]string, error) {
+	return m.GetAll(NewLocation(loc))
+}
+
+// Get returns the first value specified by the Location like Message.Get
+// escape sequences are decoded for fields and below
+func (m *RawMessage) Get(l *Location) (string, error) {
+	v, err := m.GetBytes(l)
+	if l.FieldSeq < 0 || bytes.IndexByte(v, byte(m.Delimeters.Escape)) < 0 {
+		return string(v), err
+	}
+	return Unescape(string(v), &m.Delimeters), err
+}
+
+// GetRaw returns the first value specified by the Location as encoded in the message
+func (m *RawMessage) GetRaw(l *Location) (string, error) {
+	v, err := m.GetBytes(l)
+	return string(v), err
+}
+
+// GetBytes is like GetRaw but returns the bytes of the value in the message
+// the bytes must not be changed, GetBytes does not allocate
+func (m *RawMessage) GetBytes(l *Location) ([]byte, error) {
+	if l.Segment == "" {
+		return m.data, nil
+	}
+	n := 0
+	for i := range m.segs {
+		if m.segmentName(i) != l.Segment {
+			continue
+		}
+		n++
+		if l.SegIdx <= 1 || l.SegIdx == n {
+			v, _ := m.value(i, l, l.FieldRep)
+			return v, nil
+		}
+	}
+	if l.SegIdx > 1 {
+		return nil, fmt.Errorf("Segment %s[%d] not found", l.Segment, l.SegIdx)
+	}
+	return nil, fmt.Errorf("Segment not found")
+}
+
+// GetAll returns all values specified by the Location like Message.GetAll
+// escape sequences are decoded for fields and below
+func (m *RawMessage) GetAll(l *Location) ([]string, error) {
+	vals, err := m.GetAllRaw(l)
+	if l.FieldSeq < 0 {
+		return vals, err
+	}
+	for i := range vals {
+		vals[i] = Unescape(vals[i], &m.Delimeters)
+	}
+	return vals, err
+}
+
+// GetAllRaw returns all values specified by the Location as encoded in the message
+// all occurrences of the segment and all repetitions of the field unless the location
+// specifies them
+func (m *RawMessage) GetAllRaw(l *Location) ([]string, error) {
+	vals := []string{}
+	if l.Segment == "" {
+		return append(vals, string(m.data)), nil
+	}
+	n := 0
+	found := false
+	for i := range m.segs {
+		if m.segmentName(i) != l.Segment {
+			continue
+		}
+		n++
+		if l.SegIdx > 0 && l.SegIdx != n {
+			continue
+		}
+		found = true
+		if l.FieldSeq < 0 {
+			vals = append(vals, string(m.segment(i)))
+			continue
+		}
+		if l.FieldSeq >= m.segs[i].nfields {
+			return vals, fmt.Errorf("Field %d not found", l.FieldSeq)
+		}
+		if l.FieldRep > 0 {
+			v, ok := m.value(i, l, l.FieldRep)
+			if !ok {
+				return vals, fmt.Errorf("Field %d[%d] not found", l.FieldSeq, l.FieldRep)
+			}
+			vals = append(vals, string(v))
+			continue
+		}
+		for rep := 1; ; rep++ {
+			v, ok := m.value(i, l, rep)
+			if !ok {
+				break
+			}
+			vals = append(vals, string(v))
+		}
+	}
+	if !found {
+		return vals, fmt.Errorf("Segment not found")
+	}
+	return vals, nil
+}
+
+// segment returns the bytes of segment i
+func (m *RawMessage) segment(i int) []byte {
+	return m.data[m.segs[i].start:m.segs[i].end]
+}
+
+// segmentName returns the name of segment i
+func (m *RawMessage) segmentName(i int) string {
+	f := m.segs[i].field
+	return string(m.data[m.fields[f]:m.fields[f+1]])
+}
+
+// value returns the value at l in repetition rep of the field of segment i
+// ok is false if the field or the repetition does not exist
+func (m *RawMessage) value(i int, l *Location, rep int) (v []byte, ok bool) {
+	seg := m.segs[i]
+	if l.FieldSeq < 0 {
+		return m.segment(i), true
+	}
+	if l.FieldSeq >= seg.nfields {
+		return nil, false
+	}
+	f := seg.field + 2*l.FieldSeq
+	v = m.data[m.fields[f]:m.fields[f+1]]
+	if l.FieldSeq <= 2 && m.segmentName(i) == "MSH" {
+		// the delimeters are not split
+		if rep > 1 {
+			return nil, false
+		}
+		if l.Comp > 1 || l.SubComp > 1 || l.Comp == 0 || l.SubComp == 0 {
+			return nil, true
+		}
+		return v, true
+	}
+	if rep < 1 {
+		rep = 1
+	}
+	v, ok = nthPart(v, byte(m.Delimeters.Repetition), rep)
+	if !ok || l.Comp < 0 {
+		return v, ok
+	}
+	c, found := nthPart(v, byte(m.Delimeters.Component), l.Comp)
+	if !found || l.SubComp < 0 {
+		return c, true
+	}
+	sc, _ := nthPart(c, byte(m.Delimeters.SubComponent), l.SubComp)
+	return sc, true
+}
+
+// nthPart returns part n (1 based) of v split by sep
+func nthPart(v []byte, sep byte, n int) ([]byte, bool) {
+	if n < 1 {
+		return nil, false
+	}
+	for ; n > 1; n-- {
+		i := bytes.IndexByte(v, sep)
+		if i < 0 {
+			return nil, false
+		}
+		v = v[i+1:]
+	}
+	if i := bytes.IndexByte(v, sep); i >= 0 {
+		v = v[:i]
+	}
+	return v, true
+}
+
+// PeekHeader returns the MsgInfo and Delimeters of the message in data
+// only the MSH segment is parsed, the MsgInfo values are the ones of Message.Info
+// The MSH segment ends with the first carriage return or line feed
+func PeekHeader(data []byte) (MsgInfo, Delimeters, error) {
+	mi := MsgInfo{}
+	m := RawMessage{}
+	if err := m.parse(data, true); err != nil {
+		return mi, m.Delimeters, err
+	}
+	// the fields of MsgInfo are all MSH strings
+	st := reflect.ValueOf(&mi).Elem()
+	for i := 0; i < st.NumField(); i++ {
+		v, _ := m.Find(st.Type().Field(i).Tag.Get("hl7"))
+		st.Field(i).SetString(v)
+	}
+	return mi, m.Delimeters, nil
+}
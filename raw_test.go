@@ -0,0 +1,207 @@
+package golevel7
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawMessage(t *testing.T) {
+	locs := []string{
+		"", "MSH", "MSH.1", "MSH.2", "MSH.2.1", "MSH.2.2", "MSH.3", "MSH.9", "MSH.9.1", "MSH.9.2", "MSH.12",
+		"PID", "PID.3", "PID.3[2]", "PID.3.1", "PID.3[2].4", "PID.5.1", "PID.5.2", "PID.5.0", "PID.5.9",
+		"PID.11", "PID.11.3", "PID.11[2].1", "PID.11[3]", "PID.40", "PID.3.1.1", "PID.3.1.2", "PID.3.0",
+		"OBX[2].5", "OBX[9].5", "OBX.3.2", "NTE", "NTE.3", "ZZZ.1", "PV1.3.1.1",
+	}
+	files := []string{"msg.hl7", "msg2.hl7", "msg3.hl7", "msg4.hl7", "msg5.hl7", "msg6.hl7", "epic-oru-r01.hl7"}
+	for _, f := range files {
+		data, err := ioutil.ReadFile("./testdata/" + f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := ParseMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := ParseRaw(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, loc := range locs {
+			want, werr := msg.Find(loc)
+			got, err := raw.Find(loc)
+			if loc == "" {
+				// the raw message keeps its last segment terminator
+				want = string(msg.Encode())
+			}
+			assert.Equal(t, want, got, f+" "+loc)
+			assert.Equal(t, werr != nil, err != nil, f+" "+loc)
+
+			wants, werr := msg.FindAll(loc)
+			gots, err := raw.FindAll(loc)
+			if loc != "" {
+				assert.Equal(t, wants, gots, f+" "+loc)
+			}
+			assert.Equal(t, werr != nil, err != nil, f+" "+loc)
+		}
+	}
+
+	raw, err := ParseRaw([]byte("\x0bMSH|^~\\&|A|B\rPID|1||1~2||Jo\\T\\nes^J&K\r\x1c\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, raw.NumSegments())
+	assert.Equal(t, "MSH|^~\\&|A|B\rPID|1||1~2||Jo\\T\\nes^J&K\r", string(raw.Bytes()))
+	val, _ := raw.Find("PID.5.1")
+	assert.Equal(t, "Jo&nes", val)
+	val, _ = raw.GetRaw(NewLocation("PID.5.1"))
+	assert.Equal(t, "Jo\\T\\nes", val)
+	val, _ = raw.Find("PID.5.2.2")
+	assert.Equal(t, "K", val)
+	msg, err := raw.Message()
+	if assert.NoError(t, err) {
+		val, _ = msg.Find("PID.3[2]")
+		assert.Equal(t, "2", val)
+	}
+
+	for _, bad := range []string{"PID|1", "MSH|^~\\&|A\rpid|1", "MSH|^~\\&|A\rPID^1", "MSH|^~\\"} {
+		_, err := ParseRaw([]byte(bad))
+		_, ok := err.(*ParseError)
+		assert.True(t, ok, bad)
+	}
+
+	// errors are located like the ones of ParseMessage, empty segments and runes included
+	for _, bad := range []string{
+		"MSH|^~\\&|Éé\r\rPID|1\r1X|a\r",
+		"MSH|^~\\&|Éé\r\r\rPID^1",
+	} {
+		_, err := ParseRaw([]byte(bad))
+		var rerr *ParseError
+		if !assert.ErrorAs(t, err, &rerr, bad) {
+			continue
+		}
+		_, err = ParseMessage([]byte(bad))
+		var merr *ParseError
+		if assert.ErrorAs(t, err, &merr, bad) {
+			assert.Equal(t, merr.Segment, rerr.Segment, bad)
+			assert.Equal(t, merr.Offset, rerr.Offset, bad)
+		}
+	}
+}
+
+func TestRawMessageParseAllocs(t *testing.T) {
+	data, err := ioutil.ReadFile("./testdata/epic-oru-r01.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := &RawMessage{}
+	l := NewLocation("OBX[2].5")
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := raw.Parse(data); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := raw.GetBytes(l); err != nil {
+			t.Fatal(err)
+		}
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func benchmarkData(b *testing.B) []byte {
+	data, err := ioutil.ReadFile("./testdata/epic-oru-r01.hl7")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+var benchLocs = []*Location{NewLocation("MSH.9"), NewLocation("PV1.3.1"), NewLocation("OBR.4.2"), NewLocation("OBX[2].5")}
+
+func BenchmarkParseMessage(b *testing.B) {
+	data := benchmarkData(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg, err := ParseMessage(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, l := range benchLocs {
+			msg.Get(l)
+		}
+	}
+}
+
+func BenchmarkParseRaw(b *testing.B) {
+	data := benchmarkData(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		raw, err := ParseRaw(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, l := range benchLocs {
+			raw.Get(l)
+		}
+	}
+}
+
+func BenchmarkParseRawReuse(b *testing.B) {
+	data := benchmarkData(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	raw := &RawMessage{}
+	for i := 0; i < b.N; i++ {
+		if err := raw.Parse(data); err != nil {
+			b.Fatal(err)
+		}
+		for _, l := range benchLocs {
+			raw.GetBytes(l)
+		}
+	}
+}
+
+func TestPeekHeader(t *testing.T) {
+	files := []string{"msg.hl7", "msg2.hl7", "msg5.hl7", "msg6.hl7", "epic-oru-r01.hl7"}
+	for _, f := range files {
+		data, err := ioutil.ReadFile("./testdata/" + f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := ParseMessage(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := msg.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mi, seps, err := PeekHeader(data)
+		if assert.NoError(t, err, f) {
+			assert.Equal(t, want, mi, f)
+			assert.Equal(t, msg.Delimeters, seps, f)
+		}
+	}
+
+	mi, seps, err := PeekHeader([]byte("\x0bMSH!@*$%!A!B$E$C!!!!!ADT@A01!1!P!2.5\nPID!1!!bad segment"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "B$C", mi.SendingFacility)
+		assert.Equal(t, "ADT@A01", mi.MessageType)
+		assert.Equal(t, "2.5", mi.VersionID)
+		assert.Equal(t, '@', seps.Component)
+	}
+	_, _, err = PeekHeader([]byte("PID|1"))
+	assert.Error(t, err)
+}
+
+func BenchmarkPeekHeader(b *testing.B) {
+	data := benchmarkData(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := PeekHeader(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package golevel7
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Violation is a value of a message which does not conform to a profile or a validation
+type Violation struct {
+	Location *Location // segment occurrence, field repetition and component of the value
+	Value    string    // the offending value, decoded
+	Code     ErrorCode // HL7 error code, table 0357
+	Severity Severity
+	Rule     string // rule which was violated, PID.3:usage
+	Message  string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%v: %s", v.Location, v.Message)
+}
+
+// HL7Error returns the HL7Error to report v in an acknowledgement
+func (v *Violation) HL7Error() *HL7Error {
+	return &HL7Error{Location: v.Location, Code: v.Code, Severity: v.Severity, Message: v.Message}
+}
+
+// jsonViolation is the JSON shape of a Violation
+type jsonViolation struct {
+	Location string    `json:"location"`
+	Value    string    `json:"value,omitempty"`
+	Code     ErrorCode `json:"code"`
+	Severity Severity  `json:"severity"`
+	Rule     string    `json:"rule"`
+	Message  string    `json:"message"`
+}
+
+// MarshalJSON encodes v with its location in location syntax
+func (v *Violation) MarshalJSON() ([]byte, error) {
+	jv := jsonViolation{Value: v.Value, Code: v.Code, Severity: v.Severity, Rule: v.Rule, Message: v.Message}
+	if v.Location != nil {
+		jv.Location = v.Location.String()
+	}
+	return json.Marshal(jv)
+}
+
+// UnmarshalJSON decodes a Violation encoded by MarshalJSON
+func (v *Violation) UnmarshalJSON(data []byte) error {
+	jv := jsonViolation{}
+	if err := json.Unmarshal(data, &jv); err != nil {
+		return err
+	}
+	*v = Violation{Value: jv.Value, Code: jv.Code, Severity: jv.Severity, Rule: jv.Rule, Message: jv.Message}
+	if jv.Location != "" {
+		v.Location = NewLocation(jv.Location)
+	}
+	return nil
+}
+
+// Violations is a list of violations
+type Violations []*Violation
+
+func (vs Violations) Error() string {
+	strs := make([]string, len(vs))
+	for i := range vs {
+		strs[i] = vs[i].Error()
+	}
+	return strings.Join(strs, "; ")
+}
+
+// ValidationReport lists the violations found validating a message
+// with Message.Validate or a Profile
+type ValidationReport struct {
+	Violations Violations `json:"violations"`
+}
+
+// Valid reports if no violation has the error severity
+// warnings and information do not make a message invalid
+func (r *ValidationReport) Valid() bool {
+	for _, v := range r.Violations {
+		if v.Severity == SeverityError || v.Severity == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Err returns the report as an error, nil if it has no violations
+// The error can be passed to AcknowledgeMessage to report the violations in ERR segments
+func (r *ValidationReport) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+	return r
+}
+
+func (r *ValidationReport) Error() string {
+	return r.Violations.Error()
+}
+
+// HL7Errors returns the HL7Errors to report the violations in ERR segments
+func (r *ValidationReport) HL7Errors() HL7Errors {
+	errs := HL7Errors{}
+	for _, v := range r.Violations {
+		errs = append(errs, v.HL7Error())
+	}
+	return errs
+}
+
+// MarshalJSON encodes the report with its validity
+//
+//	{"valid": false, "violations": [{"location": "PID[1].3[2]", "value": "A2",
+//	  "code": 102, "severity": "E", "rule": "PID.3:MatchesRegex", "message": "..."}]}
+func (r *ValidationReport) MarshalJSON() ([]byte, error) {
+	vs := r.Violations
+	if vs == nil {
+		vs = Violations{}
+	}
+	return json.Marshal(struct {
+		Valid      bool       `json:"valid"`
+		Violations Violations `json:"violations"`
+	}{r.Valid(), vs})
+}
+
+// add appends the violations of other to the report
+func (r *ValidationReport) add(other *ValidationReport) {
+	r.Violations = append(r.Violations, other.Violations...)
+}
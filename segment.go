@@ -11,24 +11,50 @@ type Segment struct {
 	Fields []Field
 	Value  []rune
 	maxSeq int
+	seps   Delimeters // delimeters of the message, used by Unmarshal to decode values
 }
 
 func (s *Segment) String() string {
-	var str string
-	for i, f := range s.Fields {
-		value := string(f.Value)
-		if i == 0 {
-			str += fmt.Sprintf("Segment: %v\n", f.String())
-		} else {
-			if value != "" {
-				str += fmt.Sprintf("\t%d: %s\n", f.SeqNum, f.String())
-			}
-			// str += f.String()
-		}
+	if len(s.Fields) == 0 {
+		return ""
+	}
+	str := fmt.Sprintf("Segment: %v\n", s.Fields[0].String())
+	for _, f := range s.NamedFields() {
+		str += fmt.Sprintf("\t%d: \t%v: %v\n", f.Field.SeqNum, f.Name, string(f.Field.Value))
 	}
 	return str
 }
 
+// NamedField is a non empty field of a segment with its location and name
+type NamedField struct {
+	Location string // PID.3, PID.3[2] for the second repetition
+	Name     string // name of the field in commons.FieldNames, "" when unknown
+	Field    *Field
+}
+
+// NamedFields returns the non empty fields of the segment in order, String prints them
+func (s *Segment) NamedFields() []NamedField {
+	name := s.Name()
+	fields := []NamedField{}
+	rep := map[int]int{}
+	for i := range s.Fields {
+		f := &s.Fields[i]
+		if f.SeqNum == 0 {
+			continue
+		}
+		rep[f.SeqNum]++
+		if len(f.Value) == 0 {
+			continue
+		}
+		loc := fmt.Sprintf("%s.%d", name, f.SeqNum)
+		if rep[f.SeqNum] > 1 {
+			loc += fmt.Sprintf("[%d]", rep[f.SeqNum])
+		}
+		fields = append(fields, NamedField{Location: loc, Name: fieldName(name, f.SeqNum), Field: f})
+	}
+	return fields
+}
+
 func (s *Segment) isMSH() bool {
 	var toCheck []rune
 	if len(s.Value) >= 3 {
@@ -50,8 +76,15 @@ func (s *Segment) isMSH() bool {
 }
 
 func (s *Segment) parse(seps *Delimeters) error {
+	s.seps = *seps
 	if len(s.Value) < 3 {
-		return fmt.Errorf("Invalid segment. Length %v", len(s.Value))
+		return newParseError(0, -1, string(s.Value), 0, "Invalid segment. Length %v", len(s.Value))
+	}
+	if !isSegmentName(s.Value[0:3]) {
+		return newParseError(0, -1, string(s.Value[0:3]), 0, "Invalid segment name %q", string(s.Value[0:3]))
+	}
+	if len(s.Value) > 3 && s.Value[3] != seps.Field && !(s.Value[3] == endMsg && seps.LFTermMsg) {
+		return newParseError(3, -1, string(s.Value[0:3]), 0, "Invalid segment: expected field separator after %q", string(s.Value[0:3]))
 	}
 	isMSH := s.isMSH()
 
@@ -70,6 +103,7 @@ func (s *Segment) parse(seps *Delimeters) error {
 				fld.parse(seps)
 				s.Fields = append(s.Fields, fld)
 			}
+			s.maxSeq = seq
 			return nil
 		case isMSH && seq == 2 && ch == seps.Repetition:
 			// ignore repeat separator in separator definition
@@ -96,13 +130,45 @@ func (s *Segment) parse(seps *Delimeters) error {
 			fld.parse(seps)
 			s.Fields = append(s.Fields, fld)
 			i = ii
-		case ch == seps.Escape:
-			ii++
-			r.ReadRune()
 		}
 	}
 }
 
+// newSegment returns an empty segment named name
+// an MSH segment gets the field separator (MSH.1) and encoding characters (MSH.2) of seps
+// numbered as when parsed
+func newSegment(name string, seps *Delimeters) Segment {
+	s := Segment{seps: *seps}
+	s.forceField([]rune(name), 0)
+	if name == "MSH" {
+		s.forceField([]rune(string(seps.Field)), 1)
+		s.forceField([]rune(seps.encodingChars()), 2)
+	}
+	s.Value = s.encode(seps)
+	return s
+}
+
+// delimeters returns the delimeters of the message of the segment, the default ones for a
+// segment which was not parsed or built with delimeters
+func (s *Segment) delimeters() *Delimeters {
+	if s.seps.Field == 0 {
+		return NewDelimeters()
+	}
+	return &s.seps
+}
+
+// clone returns a deep copy of the segment
+func (s *Segment) clone() Segment {
+	c := Segment{Value: cloneRunes(s.Value), maxSeq: s.maxSeq, seps: s.seps}
+	if s.Fields != nil {
+		c.Fields = make([]Field, len(s.Fields))
+		for i := range s.Fields {
+			c.Fields[i] = s.Fields[i].clone()
+		}
+	}
+	return c
+}
+
 // forceField will force the creation of a field / component / subcomponent
 // This is used for separator defines in the MSH segemnt
 // ...and the name forceField is cool ;)
@@ -118,16 +184,55 @@ func (s *Segment) forceField(val []rune, seq int) {
 }
 
 func (s *Segment) encode(seps *Delimeters) []rune {
-	buf := []string{}
-	for _, f := range s.Fields {
-		buf = append(buf, string(f.Value))
+	isMSH := s.isMSH()
+	buf := []rune{}
+	for i, f := range s.Fields {
+		switch {
+		case i == 0:
+		case f.SeqNum == s.Fields[i-1].SeqNum:
+			buf = append(buf, seps.Repetition)
+		case isMSH && f.SeqNum <= 2:
+			// MSH.1 is the field separator and MSH.2 directly follows it
+		default:
+			buf = append(buf, seps.Field)
+		}
+		buf = append(buf, f.Value...)
+	}
+	return buf
+}
+
+// rawFields returns the encoded fields after the segment name and the sequence number
+// of the first one, for MSH the first one is MSH.2 as MSH.1 is the field separator
+func (s *Segment) rawFields(seps *Delimeters) ([]string, int) {
+	if len(s.Value) <= 3 {
+		return []string{}, 1
 	}
+	first := 1
 	if s.isMSH() {
-		firstFields := strings.Join(buf[0:3], "")
-		otherFields := strings.Join(buf[3:], string(seps.Field))
-		return []rune(strings.Join([]string{firstFields, otherFields}, string(seps.Field)))
-	} else {
-		return []rune(strings.Join(buf, string(seps.Field)))
+		first = 2
+	}
+	return strings.Split(string(s.Value[4:]), string(seps.Field)), first
+}
+
+// writeSegment writes a segment in ER7 to b from its encoded field repetitions by sequence number
+// the MSH delimeters are the ones of seps
+func writeSegment(b *strings.Builder, name string, fields map[int][]string, seps *Delimeters) {
+	last := 0
+	for seq := range fields {
+		if seq > last {
+			last = seq
+		}
+	}
+	b.WriteString(name)
+	first := 1
+	if name == "MSH" {
+		b.WriteRune(seps.Field)
+		b.WriteString(seps.encodingChars())
+		first = 3
+	}
+	for seq := first; seq <= last; seq++ {
+		b.WriteRune(seps.Field)
+		b.WriteString(strings.Join(fields[seq], string(seps.Repetition)))
 	}
 }
 
@@ -155,12 +260,38 @@ func (s *Segment) AllFields(i int) ([]*Field, error) {
 	return flds, nil
 }
 
+// Repetition returns repetition n (1 based) of the field with sequence number i
+// n == 0 returns the first repetition
+func (s *Segment) Repetition(i, n int) *Field {
+	if n <= 1 {
+		return s.Field(i)
+	}
+	flds, err := s.AllFields(i)
+	if err != nil || n > len(flds) {
+		return nil
+	}
+	return flds[n-1]
+}
+
+// fieldsAt returns the fields matched by the Location
+// all repetitions unless the location specifies one
+func (s *Segment) fieldsAt(l *Location) ([]*Field, error) {
+	if l.FieldRep > 0 {
+		fld := s.Repetition(l.FieldSeq, l.FieldRep)
+		if fld == nil {
+			return []*Field{}, fmt.Errorf("Field %d[%d] not found", l.FieldSeq, l.FieldRep)
+		}
+		return []*Field{fld}, nil
+	}
+	return s.AllFields(l.FieldSeq)
+}
+
 // Get returns the first value specified by the Location
 func (s *Segment) Get(l *Location) (string, error) {
 	if l.FieldSeq == -1 {
 		return string(s.Value), nil
 	}
-	fld := s.Field(l.FieldSeq)
+	fld := s.Repetition(l.FieldSeq, l.FieldRep)
 	if fld == nil {
 		return "", nil
 	}
@@ -174,7 +305,7 @@ func (s *Segment) GetAll(l *Location) ([]string, error) {
 		vals = append(vals, string(s.Value))
 		return vals, nil
 	}
-	flds, err := s.AllFields(l.FieldSeq)
+	flds, err := s.fieldsAt(l)
 	if err != nil {
 		return vals, err
 	}
@@ -194,7 +325,7 @@ func (s *Segment) getObjects(l *Location) ([]ValueGetter, error) {
 		vals = append(vals, s)
 		return vals, nil
 	}
-	flds, err := s.AllFields(l.FieldSeq)
+	flds, err := s.fieldsAt(l)
 	if err != nil {
 		return vals, err
 	}
@@ -213,14 +344,15 @@ func (s *Segment) Set(l *Location, val string, seps *Delimeters) error {
 	if l.FieldSeq == -1 {
 		return errors.New("Field is required")
 	}
+	s.seps = *seps
 	if s.maxSeq < l.FieldSeq {
 		for i := s.maxSeq + 1; i <= l.FieldSeq; i++ {
 			s.forceField([]rune(""), i)
 		}
 	}
-	fld := s.Field(l.FieldSeq)
+	fld := s.Repetition(l.FieldSeq, l.FieldRep)
 	if fld == nil {
-		return nil
+		fld = s.addRepetitions(l.FieldSeq, l.FieldRep)
 	}
 	err := fld.Set(l, val, seps)
 	if err != nil {
@@ -230,6 +362,26 @@ func (s *Segment) Set(l *Location, val string, seps *Delimeters) error {
 	return nil
 }
 
+// addRepetitions adds empty repetitions of field i until repetition n exists
+// and returns the last one added
+func (s *Segment) addRepetitions(i, n int) *Field {
+	flds, _ := s.AllFields(i)
+	last := len(s.Fields) - 1
+	for idx, fld := range s.Fields {
+		if fld.SeqNum == i {
+			last = idx
+		}
+	}
+	for rep := len(flds); rep < n; rep++ {
+		last++
+		fld := Field{SeqNum: i, SegName: s.Name()}
+		s.Fields = append(s.Fields, Field{})
+		copy(s.Fields[last+1:], s.Fields[last:])
+		s.Fields[last] = fld
+	}
+	return &s.Fields[last]
+}
+
 func (s *Segment) GetNumFields() int {
 	numFields := 0
 	for _, f := range s.Fields {
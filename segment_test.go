@@ -30,3 +30,40 @@ func TestSegSet(t *testing.T) {
 		t.Errorf("Expected TEST got %s\n", str)
 	}
 }
+
+func TestSegNamedFields(t *testing.T) {
+	seg := &Segment{Value: []rune(`PID|1||12001~555||Jones^John`)}
+	seg.parse(NewDelimeters())
+	fields := seg.NamedFields()
+	if len(fields) != 4 {
+		t.Fatalf("Expected 4 fields got %d\n", len(fields))
+	}
+	for i, want := range []NamedField{
+		{Location: "PID.1", Name: "Set ID"},
+		{Location: "PID.3", Name: "Patient Identifier List"},
+		{Location: "PID.3[2]", Name: "Patient Identifier List"},
+		{Location: "PID.5", Name: "Patient Name"},
+	} {
+		if fields[i].Location != want.Location || fields[i].Name != want.Name {
+			t.Errorf("Expected %s %s got %s %s\n", want.Location, want.Name, fields[i].Location, fields[i].Name)
+		}
+	}
+	if v := string(fields[2].Field.Value); v != "555" {
+		t.Errorf("Expected 555 got %s\n", v)
+	}
+	want := "Segment: \tPID Record\n" +
+		"\t1: \tSet ID: 1\n" +
+		"\t3: \tPatient Identifier List: 12001\n" +
+		"\t3: \tPatient Identifier List: 555\n" +
+		"\t5: \tPatient Name: Jones^John\n"
+	if s := seg.String(); s != want {
+		t.Errorf("Expected %q got %q\n", want, s)
+	}
+
+	// fields of unknown segments have no name
+	seg = &Segment{Value: []rune(`ZZZ|a`)}
+	seg.parse(NewDelimeters())
+	if fields := seg.NamedFields(); len(fields) != 1 || fields[0].Name != "" {
+		t.Errorf("Expected one field without a name got %v\n", fields)
+	}
+}
@@ -0,0 +1,211 @@
+package golevel7
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	structuresMu sync.RWMutex
+	structures   = map[string]*Structure{}
+
+	// message types sharing the structure of another one
+	structureAliases = map[string]string{
+		"ADT_A04": "ADT_A01",
+		"ADT_A08": "ADT_A01",
+		"ADT_A13": "ADT_A01",
+	}
+)
+
+func init() {
+	RegisterStructure(NewORUR01())
+	RegisterStructure(NewORMO01())
+	RegisterStructure(NewADTA01())
+}
+
+// RegisterStructure makes the Structure s available to LookupStructure under s.Name
+// it replaces a Structure registered with the same name
+func RegisterStructure(s *Structure) {
+	structuresMu.Lock()
+	defer structuresMu.Unlock()
+	structures[s.Name] = s
+}
+
+// LookupStructure returns the Structure for a message type (MSH.9) like ORU^R01
+// or ORU^R01^ORU_R01. The message structure component is used when present
+func LookupStructure(msgType string) (*Structure, error) {
+	name := structureName(msgType)
+	structuresMu.RLock()
+	defer structuresMu.RUnlock()
+	if s, ok := structures[name]; ok {
+		return s, nil
+	}
+	if s, ok := structures[structureAliases[name]]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("No structure for message type %q", msgType)
+}
+
+// structureName returns the message structure name of the message type msgType
+func structureName(msgType string) string {
+	parts := strings.Split(msgType, "^")
+	switch {
+	case len(parts) > 2 && parts[2] != "":
+		return parts[2]
+	case len(parts) > 1:
+		return parts[0] + "_" + parts[1]
+	}
+	return parts[0]
+}
+
+// seg returns a required, non repeating segment
+func seg(name string) *Structure {
+	return &Structure{Name: name, Required: true}
+}
+
+// group returns a required, non repeating group
+func group(name string, children ...*Structure) *Structure {
+	return &Structure{Name: name, Required: true, Children: children}
+}
+
+// opt makes s optional
+func opt(s *Structure) *Structure {
+	s.Required = false
+	return s
+}
+
+// rep makes s repeating
+func rep(s *Structure) *Structure {
+	s.Repeating = true
+	return s
+}
+
+// optRep makes s optional and repeating
+func optRep(s *Structure) *Structure {
+	return rep(opt(s))
+}
+
+// NewORUR01 is the structure of the ORU^R01 unsolicited observation message for version 2.5
+func NewORUR01() *Structure {
+	return group("ORU_R01",
+		seg("MSH"),
+		optRep(seg("SFT")),
+		rep(group("PATIENT_RESULT",
+			opt(group("PATIENT",
+				seg("PID"),
+				opt(seg("PD1")),
+				optRep(seg("NTE")),
+				optRep(seg("NK1")),
+				opt(group("VISIT",
+					seg("PV1"),
+					opt(seg("PV2")),
+				)),
+			)),
+			rep(group("ORDER_OBSERVATION",
+				opt(seg("ORC")),
+				seg("OBR"),
+				optRep(seg("NTE")),
+				optRep(group("TIMING_QTY",
+					seg("TQ1"),
+					optRep(seg("TQ2")),
+				)),
+				opt(seg("CTD")),
+				optRep(group("OBSERVATION",
+					seg("OBX"),
+					optRep(seg("NTE")),
+				)),
+				optRep(seg("FT1")),
+				optRep(seg("CTI")),
+				optRep(group("SPECIMEN",
+					seg("SPM"),
+					optRep(seg("OBX")),
+				)),
+			)),
+		)),
+		opt(seg("DSC")),
+	)
+}
+
+// NewORMO01 is the structure of the ORM^O01 order message for version 2.4
+// the choice of order detail segments is treated as a sequence of optional segments
+func NewORMO01() *Structure {
+	return group("ORM_O01",
+		seg("MSH"),
+		optRep(seg("NTE")),
+		opt(group("PATIENT",
+			seg("PID"),
+			opt(seg("PD1")),
+			optRep(seg("NTE")),
+			opt(group("PATIENT_VISIT",
+				seg("PV1"),
+				opt(seg("PV2")),
+			)),
+			optRep(group("INSURANCE",
+				seg("IN1"),
+				opt(seg("IN2")),
+				opt(seg("IN3")),
+			)),
+			opt(seg("GT1")),
+			optRep(seg("AL1")),
+		)),
+		rep(group("ORDER",
+			seg("ORC"),
+			opt(group("ORDER_DETAIL",
+				opt(seg("OBR")),
+				opt(seg("RQD")),
+				opt(seg("RQ1")),
+				opt(seg("RXO")),
+				opt(seg("ODS")),
+				opt(seg("ODT")),
+				optRep(seg("NTE")),
+				opt(seg("CTD")),
+				optRep(seg("DG1")),
+				optRep(group("OBSERVATION",
+					seg("OBX"),
+					optRep(seg("NTE")),
+				)),
+			)),
+			optRep(seg("FT1")),
+			optRep(seg("CTI")),
+			opt(seg("BLG")),
+		)),
+	)
+}
+
+// NewADTA01 is the structure of the ADT^A01 admit message for version 2.5
+// it is also used by ADT^A04, ADT^A08 and ADT^A13
+func NewADTA01() *Structure {
+	return group("ADT_A01",
+		seg("MSH"),
+		optRep(seg("SFT")),
+		seg("EVN"),
+		seg("PID"),
+		opt(seg("PD1")),
+		optRep(seg("ROL")),
+		optRep(seg("NK1")),
+		seg("PV1"),
+		opt(seg("PV2")),
+		optRep(seg("ROL")),
+		optRep(seg("DB1")),
+		optRep(seg("OBX")),
+		optRep(seg("AL1")),
+		optRep(seg("DG1")),
+		opt(seg("DRG")),
+		optRep(group("PROCEDURE",
+			seg("PR1"),
+			optRep(seg("ROL")),
+		)),
+		optRep(seg("GT1")),
+		optRep(group("INSURANCE",
+			seg("IN1"),
+			opt(seg("IN2")),
+			optRep(seg("IN3")),
+			optRep(seg("ROL")),
+		)),
+		opt(seg("ACC")),
+		opt(seg("UB1")),
+		opt(seg("UB2")),
+		opt(seg("PDA")),
+	)
+}
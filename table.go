@@ -0,0 +1,54 @@
+package golevel7
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	tablesMu sync.RWMutex
+	tables   = map[string][]string{
+		"0001": {"A", "F", "M", "N", "O", "U"},                                                                     // administrative sex
+		"0008": {"AA", "AE", "AR", "CA", "CE", "CR"},                                                               // acknowledgment code
+		"0085": {"C", "D", "F", "I", "N", "O", "P", "R", "S", "U", "W", "X"},                                       // observation result status
+		"0103": {"D", "P", "T"},                                                                                    // processing id
+		"0104": {"2.0", "2.0D", "2.1", "2.2", "2.3", "2.3.1", "2.4", "2.5", "2.5.1", "2.6", "2.7", "2.7.1", "2.8"}, // version id
+		"0155": {"AL", "ER", "NE", "SU"},                                                                           // accept / application acknowledgment conditions
+		"0516": {"E", "I", "W"},                                                                                    // error severity
+	}
+)
+
+// tableID normalizes a table id, HL70001 and 1 are table 0001
+func tableID(id string) string {
+	id = strings.TrimPrefix(strings.ToUpper(id), "HL7")
+	for len(id) < 4 && id != "" && id[0] >= '0' && id[0] <= '9' {
+		id = "0" + id
+	}
+	return id
+}
+
+// RegisterTable sets the values of the code table id
+// It replaces the values of a table registered with the same id
+func RegisterTable(id string, values ...string) {
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+	tables[tableID(id)] = values
+}
+
+// LookupTable returns the values of the code table id
+func LookupTable(id string) ([]string, bool) {
+	tablesMu.RLock()
+	defer tablesMu.RUnlock()
+	vals, ok := tables[tableID(id)]
+	return vals, ok
+}
+
+// inTable reports if v is one of vals
+func inTable(vals []string, v string) bool {
+	for _, tv := range vals {
+		if tv == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,27 +1,319 @@
 package golevel7
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
 // VCheck is the type validity check to be done
 type VCheck int
 
 // VCheck values
+// HasValue and SpecificValue fail when the location has no value, the other
+// checks only apply to non empty values except Predicate which is always called
 const (
-	HasValue = iota
-	SpecificValue
+	HasValue      = iota
+	SpecificValue // equal to Value
+	MatchesRegex  // the whole value matches the regular expression in Value, see Validation.Check
+	MinLength     // at least Length characters
+	MaxLength     // at most Length characters
+	DataType      // conforms to the HL7 data type in Value, see CheckDataType
+	InTable       // one of the values of the code table in Value, see RegisterTable
+	Predicate     // Func returns nil
 )
 
 // Validation contains information to validate a message value
+// When makes the validation conditional, it is only checked if the When validation
+// passes. PV1.19 required if PV1.2 is I:
+//
+//	Validation{Location: "PV1.19", VCheck: HasValue,
+//		When: &Validation{Location: "PV1.2", VCheck: SpecificValue, Value: "I"}}
+//
+// Validations are the rules of a Profile, in YAML or JSON the check is its name
+//
+//	{location: PID.3.1, check: MatchesRegex, value: "[0-9]+"}
 type Validation struct {
-	Location string // Query syntax
-	VCheck   VCheck // What to check
-	Value    string // Matching value for SpecificValue
-	Err      error  // error to use
+	Location string                               `json:"location" yaml:"location"`                     // Query syntax
+	VCheck   VCheck                               `json:"check" yaml:"check"`                           // What to check
+	Value    string                               `json:"value,omitempty" yaml:"value,omitempty"`       // Matching value for SpecificValue, expression, data type or table
+	Length   int                                  `json:"length,omitempty" yaml:"length,omitempty"`     // length for MinLength and MaxLength
+	When     *Validation                          `json:"when,omitempty" yaml:"when,omitempty"`         // condition for the validation to apply
+	Func     func(m *Message, value string) error `json:"-" yaml:"-"`                                   // predicate for Predicate
+	Err      error                                `json:"-" yaml:"-"`                                   // error to use
+	ID       string                               `json:"id,omitempty" yaml:"id,omitempty"`             // rule id reported, defaults to Location:VCheck
+	Severity Severity                             `json:"severity,omitempty" yaml:"severity,omitempty"` // severity reported, defaults to SeverityError
+}
+
+var vcheckNames = map[VCheck]string{
+	HasValue:      "HasValue",
+	SpecificValue: "SpecificValue",
+	MatchesRegex:  "MatchesRegex",
+	MinLength:     "MinLength",
+	MaxLength:     "MaxLength",
+	DataType:      "DataType",
+	InTable:       "InTable",
+	Predicate:     "Predicate",
+}
+
+func (c VCheck) String() string {
+	if name, ok := vcheckNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("VCheck(%d)", int(c))
+}
+
+// MarshalText returns the name of the check
+func (c VCheck) MarshalText() ([]byte, error) {
+	if _, ok := vcheckNames[c]; !ok {
+		return nil, fmt.Errorf("Invalid check %d", int(c))
+	}
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText sets the check from its name, HasValue
+func (c *VCheck) UnmarshalText(text []byte) error {
+	for check, name := range vcheckNames {
+		if name == string(text) {
+			*c = check
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid check %q", text)
+}
+
+// ruleID returns the rule id reported for v
+func (v *Validation) ruleID() string {
+	if v.ID != "" {
+		return v.ID
+	}
+	return v.Location + ":" + v.VCheck.String()
+}
+
+// Check reports an invalid rule: an unknown check, no location, a Predicate without Func
+// or an invalid regular expression. The rules of a profile are checked when it is parsed
+// An invalid regular expression is a bug of the rule, validating a message with it panics
+// like regexp.MustCompile
+func (v *Validation) Check() error {
+	if _, ok := vcheckNames[v.VCheck]; !ok || v.Location == "" {
+		return fmt.Errorf("Invalid rule %s", v.ruleID())
+	}
+	if v.VCheck == Predicate && v.Func == nil {
+		return fmt.Errorf("Invalid rule %s: no predicate", v.ruleID())
+	}
+	if v.VCheck == MatchesRegex {
+		if _, err := compileRegex(v.Value); err != nil {
+			return fmt.Errorf("Invalid rule %s: %v", v.ruleID(), err)
+		}
+	}
+	if v.When != nil {
+		return v.When.Check()
+	}
+	return nil
+}
+
+// regexps caches the compiled expressions of MatchesRegex by pattern
+var regexps sync.Map
+
+// compileRegex returns the expression matching whole values for pattern, compiled once
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(pattern, re)
+	return re, nil
+}
+
+// errorCode returns the table 0357 code reported when v fails
+// missing values are required field errors, values not matching SpecificValue
+// or InTable table value errors, too long values length errors and others data type errors
+func (v *Validation) errorCode() ErrorCode {
+	switch v.VCheck {
+	case HasValue:
+		return ErrCodeRequiredFieldMissing
+	case SpecificValue, InTable:
+		return ErrCodeTableValueNotFound
+	case MaxLength:
+		return ErrCodeValueTooLong
+	}
+	return ErrCodeDataType
+}
+
+// locatedValue is a decoded value and its location
+type locatedValue struct {
+	loc   *Location
+	value string
+}
+
+// locate returns the values at l with the segment occurrence and field repetition
+// of each one set in its location
+func (m *Message) locate(l *Location) []locatedValue {
+	vals := []locatedValue{}
+	if l.Segment == "" {
+		return vals
+	}
+	segs, err := m.segmentsAt(l)
+	if err != nil {
+		return vals
+	}
+	for i, seg := range segs {
+		sl := *l
+		sl.SegIdx = i + 1
+		if l.SegIdx > 0 {
+			sl.SegIdx = l.SegIdx
+		}
+		if l.FieldSeq < 0 {
+			vals = append(vals, locatedValue{&sl, string(seg.Value)})
+			continue
+		}
+		flds, err := seg.fieldsAt(l)
+		if err != nil {
+			continue
+		}
+		for r, f := range flds {
+			fl := sl
+			fl.FieldRep = r + 1
+			if l.FieldRep > 0 {
+				fl.FieldRep = l.FieldRep
+			}
+			v, _ := f.Get(l)
+			vals = append(vals, locatedValue{&fl, Unescape(v, &m.Delimeters)})
+		}
+	}
+	return vals
+}
+
+// validate checks v against m and returns a violation for each failing value
+func (m *Message) validate(v *Validation) Violations {
+	vs := Violations{}
+	if v.When != nil && !m.Validate([]Validation{*v.When}).Valid() {
+		return vs
+	}
+	l := NewLocation(v.Location)
+	vals := m.locate(l)
+	if len(vals) == 0 {
+		if v.requiresValue() {
+			return append(vs, v.violation(l, "", errors.New("value is required")))
+		}
+		vals = append(vals, locatedValue{l, ""})
+	}
+	for _, lv := range vals {
+		if err := v.checkValue(m, lv.value); err != nil {
+			vs = append(vs, v.violation(lv.loc, lv.value, err))
+		}
+	}
+	return vs
+}
+
+// violation returns the Violation of v by value at l, err is the reason
+func (v *Validation) violation(l *Location, value string, err error) *Violation {
+	vl := &Violation{
+		Location: l,
+		Value:    value,
+		Code:     v.errorCode(),
+		Severity: v.Severity,
+		Rule:     v.ruleID(),
+		Message:  err.Error(),
+	}
+	if vl.Severity == "" {
+		vl.Severity = SeverityError
+	}
+	if v.Err != nil {
+		vl.Message = v.Err.Error()
+	}
+	return vl
 }
 
-// NewValidORMDietaryOrder24 is an example of validating a ORM^001 message
+// requiresValue reports if the check fails for missing values
+func (v *Validation) requiresValue() bool {
+	return v.VCheck == HasValue || v.VCheck == SpecificValue
+}
+
+// checkValue checks value found at the location of v in m
+func (v *Validation) checkValue(m *Message, value string) error {
+	if value == "" && !v.requiresValue() && v.VCheck != Predicate {
+		return nil
+	}
+	switch v.VCheck {
+	case HasValue:
+		if value == "" {
+			return errors.New("value is required")
+		}
+	case SpecificValue:
+		if value != v.Value {
+			return fmt.Errorf("expected %q", v.Value)
+		}
+	case MatchesRegex:
+		re, err := compileRegex(v.Value)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid rule %s: %v", v.ruleID(), err))
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("does not match %s", v.Value)
+		}
+	case MinLength:
+		if utf8.RuneCountInString(value) < v.Length {
+			return fmt.Errorf("shorter than %d characters", v.Length)
+		}
+	case MaxLength:
+		if utf8.RuneCountInString(value) > v.Length {
+			return fmt.Errorf("longer than %d characters", v.Length)
+		}
+	case DataType:
+		return CheckDataType(v.Value, value)
+	case InTable:
+		vals, ok := LookupTable(v.Value)
+		if !ok {
+			return fmt.Errorf("unknown table %s", v.Value)
+		}
+		if !inTable(vals, value) {
+			return fmt.Errorf("%q is not in table %s", value, v.Value)
+		}
+	case Predicate:
+		if v.Func == nil {
+			return errors.New("no predicate")
+		}
+		return v.Func(m, value)
+	default:
+		return fmt.Errorf("unknown check %d", v.VCheck)
+	}
+	return nil
+}
+
+// ValidationErrors returns the HL7Errors for validations failed by IsValid
+// to report them in the ERR segments of an acknowledgement, one per rule
+// Message.Validate reports every failing value, see ValidationReport.HL7Errors
+func ValidationErrors(failures []Validation) HL7Errors {
+	errs := HL7Errors{}
+	for _, v := range failures {
+		e := &HL7Error{Location: NewLocation(v.Location), Code: v.errorCode(), Severity: v.Severity}
+		if v.Err != nil {
+			e.Message = v.Err.Error()
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// NewValidORMDietaryOrder24 is an example of validating a ORM^O01 message
+// It returns the message type and the Validations of the MSH, PID, PV1 and ORC segments
+// of the built in ORM^O01 2.4 conformance profile, see profileValidations. The profile
+// also checks field lengths, data types and table values
 func NewValidORMDietaryOrder24() []Validation {
+	msgType := strings.Split(ormDietaryOrder24().MessageType, "^")
 	v := []Validation{
-		Validation{Location: "MSH.9.0", VCheck: SpecificValue, Value: "ORM"},
-		Validation{Location: "MSH.9.1", VCheck: SpecificValue, Value: "001"},
+		{Location: "MSH.9.1", VCheck: SpecificValue, Value: msgType[0]},
+		{Location: "MSH.9.2", VCheck: SpecificValue, Value: msgType[1]},
 	}
 	v = append(v, NewValidMSH24()...)
 	v = append(v, NewValidPID24()...)
@@ -33,46 +325,42 @@ func NewValidORMDietaryOrder24() []Validation {
 
 // NewValidMSH24 is the validation for the MSH segment for version 2.4
 func NewValidMSH24() []Validation {
-	return []Validation{
-		Validation{Location: "MSH.0", VCheck: SpecificValue, Value: "MSH"},
-		Validation{Location: "MSH.1", VCheck: HasValue},
-		Validation{Location: "MSH.2", VCheck: HasValue},
-		Validation{Location: "MSH.9", VCheck: HasValue},
-		Validation{Location: "MSH.10", VCheck: HasValue},
-		Validation{Location: "MSH.11", VCheck: HasValue},
-		Validation{Location: "MSH.12", VCheck: HasValue},
-	}
+	return profileValidations(ormDietaryOrder24(), "MSH")
 }
 
 // NewValidPID24 is the validation for the PID segment for version 2.4
 func NewValidPID24() []Validation {
-	return []Validation{
-		Validation{Location: "PID.0", VCheck: SpecificValue, Value: "PID"},
-		Validation{Location: "PID.3", VCheck: HasValue},
-		Validation{Location: "PID.5", VCheck: HasValue},
-	}
+	return profileValidations(ormDietaryOrder24(), "PID")
 }
 
 // NewValidPV124 is the validation for the PV1 segment for version 2.4
 func NewValidPV124() []Validation {
-	return []Validation{
-		Validation{Location: "PV1.0", VCheck: SpecificValue, Value: "PV1"},
-	}
+	return profileValidations(ormDietaryOrder24(), "PV1")
 }
 
 // NewValidORC24 is the validation for the ORC segment for version 2.4
 func NewValidORC24() []Validation {
-	return []Validation{
-		Validation{Location: "ORC.0", VCheck: SpecificValue, Value: "ORC"},
-		Validation{Location: "ORC.1", VCheck: HasValue},
-	}
+	return profileValidations(ormDietaryOrder24(), "ORC")
 }
 
 // NewValidODS24 is the validation for the ODS segment for version 2.4
 func NewValidODS24() []Validation {
-	return []Validation{
-		Validation{Location: "ODS.0", VCheck: SpecificValue, Value: "ODS"},
-		Validation{Location: "ODS.1", VCheck: HasValue},
-		Validation{Location: "ODS.2", VCheck: HasValue},
+	return profileValidations(ormDietaryOrder24(), "ODS")
+}
+
+// profileValidations returns the Validations of segment name in p: the segment name
+// and a value for each required field
+func profileValidations(p *Profile, name string) []Validation {
+	v := []Validation{{Location: name + ".0", VCheck: SpecificValue, Value: name}}
+	for _, sp := range p.Segments {
+		if sp.Name != name {
+			continue
+		}
+		for _, fp := range sp.Fields {
+			if fp.Usage == UsageRequired {
+				v = append(v, Validation{Location: fmt.Sprintf("%s.%d", name, fp.Seq), VCheck: HasValue})
+			}
+		}
 	}
+	return v
 }
@@ -1,8 +1,12 @@
 package golevel7
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestValid(t *testing.T) {
@@ -34,3 +38,171 @@ func TestValid(t *testing.T) {
 		}
 	}
 }
+
+func TestValidationChecks(t *testing.T) {
+	data := "MSH|^~\\&|LAB|PA|EPIC|IHS|20050615230600||ORU^R01|1|P|2.5\r" +
+		"PID|1||12001~A2||Jones^John||19670824|F\r" +
+		"PV1|1|I|2ICU\r" +
+		"OBX|1|NM|GLU||182.5"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evenLength := func(m *Message, v string) error {
+		if len(v)%2 != 0 {
+			return errors.New("odd length")
+		}
+		return nil
+	}
+	tests := []struct {
+		v     Validation
+		valid bool
+	}{
+		{Validation{Location: "PID.3", VCheck: MatchesRegex, Value: `[0-9A-Z]+`}, true},
+		{Validation{Location: "PID.3", VCheck: MatchesRegex, Value: `[0-9]+`}, false},
+		{Validation{Location: "PID.5.1", VCheck: MinLength, Length: 5}, true},
+		{Validation{Location: "PID.5.1", VCheck: MinLength, Length: 6}, false},
+		{Validation{Location: "PID.5.1", VCheck: MaxLength, Length: 5}, true},
+		{Validation{Location: "PID.5.1", VCheck: MaxLength, Length: 4}, false},
+		{Validation{Location: "PID.7", VCheck: DataType, Value: "DT"}, true},
+		{Validation{Location: "PID.7", VCheck: DataType, Value: "TS"}, true},
+		{Validation{Location: "OBX.5", VCheck: DataType, Value: "NM"}, true},
+		{Validation{Location: "OBX.3", VCheck: DataType, Value: "NM"}, false},
+		{Validation{Location: "PID.1", VCheck: DataType, Value: "SI"}, true},
+		{Validation{Location: "MSH.9", VCheck: DataType, Value: "ID"}, true},
+		{Validation{Location: "PID.8", VCheck: InTable, Value: "0001"}, true},
+		{Validation{Location: "PV1.2", VCheck: InTable, Value: "0001"}, false},
+		{Validation{Location: "PV1.2", VCheck: InTable, Value: "ZZZZ"}, false},
+		{Validation{Location: "PID.9", VCheck: InTable, Value: "0001"}, true},
+		{Validation{Location: "PV1.19", VCheck: HasValue,
+			When: &Validation{Location: "PV1.2", VCheck: SpecificValue, Value: "I"}}, false},
+		{Validation{Location: "PV1.19", VCheck: HasValue,
+			When: &Validation{Location: "PV1.2", VCheck: SpecificValue, Value: "O"}}, true},
+		{Validation{Location: "PV1.3", VCheck: Predicate, Func: evenLength}, true},
+		{Validation{Location: "PID.5.1", VCheck: Predicate, Func: evenLength}, false},
+		{Validation{Location: "PID.5.1", VCheck: Predicate}, false},
+	}
+	for i, test := range tests {
+		valid, failures := msg.IsValid([]Validation{test.v})
+		if valid != test.valid {
+			t.Errorf("%d %s: expected valid %v got %v", i, test.v.Location, test.valid, valid)
+		}
+		if !valid && len(failures) == 0 {
+			t.Errorf("%d %s: expected failures", i, test.v.Location)
+		}
+	}
+
+	// an invalid expression is an error of the rule, not of the message
+	bad := Validation{Location: "PID.3", VCheck: MatchesRegex, Value: `[`}
+	assert.EqualError(t, bad.Check(), "Invalid rule PID.3:MatchesRegex: error parsing regexp: missing closing ]: `[`")
+	assert.PanicsWithValue(t, "Invalid rule PID.3:MatchesRegex: error parsing regexp: missing closing ]: `[`", func() {
+		msg.IsValid([]Validation{bad})
+	})
+	assert.NoError(t, tests[0].v.Check())
+}
+
+func TestValidationReport(t *testing.T) {
+	data := "MSH|^~\\&|LAB|PA|EPIC|IHS|20050615230600||ORU^R01|1|P|2.5\r" +
+		"PID|1||12001~A2||Jones^John||19670824|F\r" +
+		"OBX|1|NM|GLU||182.5\r" +
+		"OBX|2|NM|HGB||high"
+	msg, err := ParseMessage([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := msg.Validate([]Validation{
+		{Location: "PID.3", VCheck: MatchesRegex, Value: `[0-9]+`},
+		{Location: "OBX.5", VCheck: DataType, Value: "NM", ID: "obx-value"},
+		{Location: "PID.8", VCheck: SpecificValue, Value: "M", Severity: SeverityWarning},
+		{Location: "PV1.2", VCheck: HasValue},
+	})
+	if assert.Equal(t, 4, len(report.Violations), report.Error()) {
+		v := report.Violations[0]
+		assert.Equal(t, "PID[1].3[2]", v.Location.String())
+		assert.Equal(t, "A2", v.Value)
+		assert.Equal(t, "PID.3:MatchesRegex", v.Rule)
+		assert.Equal(t, SeverityError, v.Severity)
+
+		v = report.Violations[1]
+		assert.Equal(t, "OBX[2].5[1]", v.Location.String())
+		assert.Equal(t, "high", v.Value)
+		assert.Equal(t, "obx-value", v.Rule)
+
+		assert.Equal(t, SeverityWarning, report.Violations[2].Severity)
+		assert.Equal(t, ErrCodeTableValueNotFound, report.Violations[2].Code)
+		assert.Equal(t, ErrCodeRequiredFieldMissing, report.Violations[3].Code)
+	}
+	assert.False(t, report.Valid())
+
+	// warnings do not make a message invalid
+	warn := msg.Validate([]Validation{{Location: "PID.8", VCheck: SpecificValue, Value: "M", Severity: SeverityWarning}})
+	assert.True(t, warn.Valid())
+	valid, failures := msg.IsValid([]Validation{{Location: "PID.8", VCheck: SpecificValue, Value: "M", Severity: SeverityWarning}})
+	assert.True(t, valid)
+	assert.Empty(t, failures)
+	// only the error is a failure
+	valid, failures = msg.IsValid([]Validation{
+		{Location: "PID.8", VCheck: SpecificValue, Value: "M", Severity: SeverityWarning},
+		{Location: "PID.8", VCheck: SpecificValue, Value: "M", Severity: SeverityInfo},
+		{Location: "PID.8", VCheck: SpecificValue, Value: "M"},
+	})
+	assert.False(t, valid)
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, Severity(""), failures[0].Severity)
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Valid      bool       `json:"valid"`
+		Violations Violations `json:"violations"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, got.Valid)
+	assert.Equal(t, report.Violations, got.Violations)
+
+	ack := AcknowledgeMessage(msg, report.Err())
+	segs, _ := ack.AllSegments("ERR")
+	assert.Equal(t, 4, len(segs))
+	code, _ := ack.Find("MSA.1")
+	assert.Equal(t, AckError, code)
+	loc, _ := ack.Find("ERR[1].2")
+	assert.Equal(t, "PID^1^3^2", loc)
+}
+
+func TestValidationHelpers(t *testing.T) {
+	locs := func(val []Validation) []string {
+		l := []string{}
+		for _, v := range val {
+			l = append(l, v.Location)
+		}
+		return l
+	}
+	assert.Equal(t, []string{"MSH.0", "MSH.1", "MSH.2", "MSH.9", "MSH.10", "MSH.11", "MSH.12"}, locs(NewValidMSH24()))
+	assert.Equal(t, []string{"PID.0", "PID.3", "PID.5"}, locs(NewValidPID24()))
+	assert.Equal(t, []string{"PV1.0"}, locs(NewValidPV124()))
+	assert.Equal(t, []string{"ORC.0", "ORC.1"}, locs(NewValidORC24()))
+	assert.Equal(t, []string{"ODS.0", "ODS.1", "ODS.2"}, locs(NewValidODS24()))
+
+	msg, err := ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20070910144846||ORM^O01|1|P|2.4\rPID|1||12001||Jones^John\rPV1|1\rORC|NW"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, failures := msg.IsValid(NewValidORMDietaryOrder24())
+	assert.True(t, valid, failures)
+	msg, err = ParseMessage([]byte("MSH|^~\\&|A|B|C|D|20070910144846||ORM^O02|1|P|2.4\rPID|1||12001||Jones^John\rPV1|1\rORC|NW"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, failures = msg.IsValid(NewValidORMDietaryOrder24())
+	assert.False(t, valid)
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, "MSH.9.2", failures[0].Location)
+	}
+}
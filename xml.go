@@ -0,0 +1,500 @@
+package golevel7
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mhald/golevel7/commons"
+)
+
+// XMLNamespace is the namespace of the HL7 v2.xml encoding
+const XMLNamespace = "urn:hl7-org:v2xml"
+
+// primitiveTypes are the data types without components
+// a field of a primitive type is the text of its element
+var primitiveTypes = map[string]bool{
+	"ST": true, "TX": true, "FT": true, "NM": true, "SI": true, "ID": true,
+	"IS": true, "DT": true, "DTM": true, "TM": true, "GTS": true,
+}
+
+// EncodeXML returns the message in the HL7 v2.xml encoding with an XML header, indented
+// see MarshalXML
+func (m *Message) EncodeXML() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	e := xml.NewEncoder(&b)
+	if err := m.writeXML(e, "  "); err != nil {
+		return nil, err
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// ParseXML parses a message in the HL7 v2.xml encoding, see UnmarshalXML
+func ParseXML(data []byte) (*Message, error) {
+	m := &Message{}
+	if err := xml.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MarshalXML encodes the message in the HL7 v2.xml encoding, it implements xml.Marshaler
+//
+//	<ORU_R01 xmlns="urn:hl7-org:v2xml">
+//	  <MSH><MSH.1>|</MSH.1><MSH.2>^~\&amp;</MSH.2>...</MSH>
+//	  <ORU_R01.PATIENT_RESULT>
+//	    <ORU_R01.PATIENT>
+//	      <PID><PID.1>1</PID.1><PID.5><XPN.1>Jones</XPN.1><XPN.2>John</XPN.2></PID.5></PID>
+//
+// The root element is the message structure of MSH.9 and segments are in the groups of its
+// Structure when one is registered, see LookupStructure. Fields are named after the segment and
+// sequence number and repeat as elements. Components and subcomponents are named after the data
+// type of the field in commons.FieldTypes, XPN.1, or the field when the type is not known, ZPI.2.1
+// Escape sequences of delimeters are decoded, others like \.br\ are escape elements
+// Empty fields and components are left out unless they are the last of their parent, which keeps
+// the trailing delimeters of the message
+//
+// Indenting the output with the xml.Encoder changes values with escape elements, use EncodeXML
+func (m *Message) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return m.writeXML(e, "")
+}
+
+// UnmarshalXML decodes a message in the HL7 v2.xml encoding, it implements xml.Unmarshaler
+// The message is built in ER7 with the delimeters of MSH.1 and MSH.2 and parsed, a message
+// encoded by MarshalXML decodes to the same ER7 segments. Group elements are only used for
+// the order of the segments. The XML has no segment terminators, the decoded message ends
+// with a single carriage return whatever the terminators after the last encoded segment
+func (m *Message) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	root, err := readXMLNode(d, start)
+	if err != nil {
+		return err
+	}
+	segs := root.segments(nil)
+	if len(segs) == 0 || segs[0].name != "MSH" {
+		return fmt.Errorf("Invalid message: Missing MSH segment in %s", root.name)
+	}
+	msh1, msh2 := "", ""
+	for _, c := range segs[0].children {
+		switch c.name {
+		case "MSH.1":
+			msh1 = c.text(nil)
+		case "MSH.2":
+			msh2 = c.text(nil)
+		}
+	}
+	seps, err := parseDelimeters([]byte("MSH" + msh1 + msh2 + msh1))
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, s := range segs {
+		if err := s.writeSegment(&b, &seps); err != nil {
+			return err
+		}
+		b.WriteRune(segTerm)
+	}
+	msg := &Message{Value: []rune(b.String())}
+	if err := msg.parse(); err != nil {
+		return err
+	}
+	*m = *msg
+	return nil
+}
+
+// writeXML writes the message to e, indent is the indentation of each level of elements
+func (m *Message) writeXML(e *xml.Encoder, indent string) error {
+	msgType, _ := m.FindRaw("MSH.9")
+	root := structureName(msgType)
+	g, err := m.Groups()
+	if err == nil {
+		root = g.Name
+	}
+	if !isXMLName(root) {
+		return fmt.Errorf("Invalid message structure %q for the XML root element", root)
+	}
+	w := &xmlWriter{e: e, indent: indent, seps: &m.Delimeters}
+	w.token(xml.StartElement{
+		Name: xml.Name{Local: root},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: XMLNamespace}},
+	})
+	w.depth++
+	if g != nil {
+		w.group(g, root)
+	} else {
+		for i := range m.Segments {
+			w.segment(&m.Segments[i])
+		}
+	}
+	w.end(root, true)
+	return w.err
+}
+
+// isXMLName reports if name can be used as the root element
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if !(ch >= 'A' && ch <= 'Z') && !(ch >= 'a' && ch <= 'z') && !(ch >= '0' && ch <= '9') && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// xmlWriter writes the elements of a message to an xml.Encoder
+// values are never indented, only the elements holding other elements
+type xmlWriter struct {
+	e      *xml.Encoder
+	indent string
+	depth  int
+	seps   *Delimeters
+	err    error
+}
+
+func (w *xmlWriter) token(t xml.Token) {
+	if w.err == nil {
+		w.err = w.e.EncodeToken(t)
+	}
+}
+
+func (w *xmlWriter) newline() {
+	if w.indent != "" {
+		w.token(xml.CharData("\n" + strings.Repeat(w.indent, w.depth)))
+	}
+}
+
+// start starts an element on a new line
+func (w *xmlWriter) start(name string) {
+	w.newline()
+	w.token(xml.StartElement{Name: xml.Name{Local: name}})
+	w.depth++
+}
+
+// end ends an element, on a new line if it holds other elements
+func (w *xmlWriter) end(name string, nested bool) {
+	w.depth--
+	if nested {
+		w.newline()
+	}
+	w.token(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+// leaf writes an element holding the value v
+func (w *xmlWriter) leaf(name, v string) {
+	w.start(name)
+	w.text(v)
+	w.end(name, false)
+}
+
+// text writes the value v decoding the escape sequences of delimeters
+// other escape sequences are written as escape elements
+func (w *xmlWriter) text(v string) {
+	esc := w.seps.Escape
+	var b strings.Builder
+	flush := func() {
+		if b.Len() != 0 {
+			w.token(xml.CharData(b.String()))
+			b.Reset()
+		}
+	}
+	for esc != 0 {
+		i := strings.IndexRune(v, esc)
+		if i < 0 {
+			break
+		}
+		b.WriteString(v[:i])
+		rest := v[i+utf8.RuneLen(esc):]
+		j := strings.IndexRune(rest, esc)
+		if j < 0 {
+			// not terminated, kept as is
+			v = v[i:]
+			break
+		}
+		v = rest[j+utf8.RuneLen(esc):]
+		switch seq := rest[:j]; seq {
+		case "F":
+			b.WriteRune(w.seps.Field)
+		case "S":
+			b.WriteRune(w.seps.Component)
+		case "T":
+			b.WriteRune(w.seps.SubComponent)
+		case "R":
+			b.WriteRune(w.seps.Repetition)
+		case "E":
+			b.WriteRune(esc)
+		default:
+			flush()
+			w.token(xml.StartElement{Name: xml.Name{Local: "escape"}, Attr: []xml.Attr{{Name: xml.Name{Local: "V"}, Value: seq}}})
+			w.token(xml.EndElement{Name: xml.Name{Local: "escape"}})
+		}
+	}
+	b.WriteString(v)
+	flush()
+}
+
+// group writes the segments and child groups of g, prefix is the message structure
+func (w *xmlWriter) group(g *Group, prefix string) {
+	written := -1
+	for _, s := range g.Segments {
+		if i := g.groupOf(s); i >= 0 {
+			if i != written {
+				name := prefix + "." + g.Groups[i].Name
+				w.start(name)
+				w.group(g.Groups[i], prefix)
+				w.end(name, true)
+				written = i
+			}
+			continue
+		}
+		w.segment(s)
+	}
+}
+
+// segment writes the segment s and its fields
+func (w *xmlWriter) segment(s *Segment) {
+	name := s.Name()
+	w.start(name)
+	fields, first := s.rawFields(w.seps)
+	if first == 2 {
+		// MSH.1 and MSH.2 are the delimeters as is
+		w.start("MSH.1")
+		w.token(xml.CharData(string(w.seps.Field)))
+		w.end("MSH.1", false)
+		w.start("MSH.2")
+		w.token(xml.CharData(fields[0]))
+		w.end("MSH.2", false)
+		fields = fields[1:]
+		first = 3
+	}
+	types := commons.FieldTypes[name]
+	for i, f := range fields {
+		seq := first + i
+		if f == "" && i < len(fields)-1 {
+			continue
+		}
+		typ := ""
+		if seq < len(types) {
+			typ = types[seq]
+		}
+		elem := name + "." + strconv.Itoa(seq)
+		for _, rep := range strings.Split(f, string(w.seps.Repetition)) {
+			w.field(elem, typ, rep)
+		}
+	}
+	w.end(name, len(fields) != 0 || first == 3)
+}
+
+// field writes a repetition of a field of data type typ
+func (w *xmlWriter) field(elem, typ, v string) {
+	comps := strings.Split(v, string(w.seps.Component))
+	simple := typ == "" || primitiveTypes[typ]
+	if v == "" || (len(comps) == 1 && simple && !strings.ContainsRune(v, w.seps.SubComponent)) {
+		w.leaf(elem, v)
+		return
+	}
+	prefix := elem
+	if !simple {
+		prefix = typ
+	}
+	w.start(elem)
+	for i, c := range comps {
+		if c == "" && i < len(comps)-1 {
+			continue
+		}
+		name := prefix + "." + strconv.Itoa(i+1)
+		subs := strings.Split(c, string(w.seps.SubComponent))
+		if len(subs) == 1 {
+			w.leaf(name, c)
+			continue
+		}
+		w.start(name)
+		for j, sc := range subs {
+			if sc == "" && j < len(subs)-1 {
+				continue
+			}
+			w.leaf(name+"."+strconv.Itoa(j+1), sc)
+		}
+		w.end(name, true)
+	}
+	w.end(elem, true)
+}
+
+// xmlNode is an element of a message in the v2.xml encoding
+type xmlNode struct {
+	name     string
+	children []*xmlNode
+	parts    []xmlText // text and escape elements of a value
+}
+
+// xmlText is text or the sequence of an escape element
+type xmlText struct {
+	text   string
+	escape bool
+}
+
+// readXMLNode reads the element started by start
+func readXMLNode(d *xml.Decoder, start xml.StartElement) (*xmlNode, error) {
+	n := &xmlNode{name: start.Name.Local}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "escape" {
+				seq := ""
+				for _, a := range t.Attr {
+					if a.Name.Local == "V" {
+						seq = a.Value
+					}
+				}
+				n.parts = append(n.parts, xmlText{text: seq, escape: true})
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			c, err := readXMLNode(d, t)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, c)
+		case xml.CharData:
+			n.parts = append(n.parts, xmlText{text: string(t)})
+		case xml.EndElement:
+			return n, nil
+		}
+	}
+}
+
+// segments appends the segment elements in n and its groups to segs
+func (n *xmlNode) segments(segs []*xmlNode) []*xmlNode {
+	for _, c := range n.children {
+		if isSegmentName([]rune(c.name)) {
+			segs = append(segs, c)
+		} else {
+			segs = c.segments(segs)
+		}
+	}
+	return segs
+}
+
+// text returns the value of an element without children escaped with seps
+// nil seps returns it as is
+func (n *xmlNode) text(seps *Delimeters) string {
+	var b strings.Builder
+	for _, p := range n.parts {
+		switch {
+		case seps == nil:
+			b.WriteString(p.text)
+		case p.escape:
+			b.WriteRune(seps.Escape)
+			b.WriteString(p.text)
+			b.WriteRune(seps.Escape)
+		default:
+			b.WriteString(escapeDelimeters(p.text, seps))
+		}
+	}
+	return b.String()
+}
+
+// escapeDelimeters escapes the delimeters in v, unlike Escape line breaks are kept
+func escapeDelimeters(v string, seps *Delimeters) string {
+	var b strings.Builder
+	for _, ch := range v {
+		seq := ""
+		switch ch {
+		case seps.Escape:
+			seq = "E"
+		case seps.Field:
+			seq = "F"
+		case seps.Repetition:
+			seq = "R"
+		case seps.Component:
+			seq = "S"
+		case seps.SubComponent:
+			seq = "T"
+		default:
+			b.WriteRune(ch)
+			continue
+		}
+		b.WriteRune(seps.Escape)
+		b.WriteString(seq)
+		b.WriteRune(seps.Escape)
+	}
+	return b.String()
+}
+
+// xmlSeq returns the number at the end of an element name, 5 for PID.5 or XPN.5
+func xmlSeq(name string) (int, bool) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// writeSegment writes the segment element n in ER7 to b
+func (n *xmlNode) writeSegment(b *strings.Builder, seps *Delimeters) error {
+	fields := map[int][]string{}
+	for _, c := range n.children {
+		seq, ok := xmlSeq(c.name)
+		if !ok || c.name[:strings.LastIndexByte(c.name, '.')] != n.name {
+			return fmt.Errorf("Invalid element %s in segment %s", c.name, n.name)
+		}
+		if n.name == "MSH" && seq <= 2 {
+			continue
+		}
+		v, err := c.value(seps, fieldLevel)
+		if err != nil {
+			return err
+		}
+		fields[seq] = append(fields[seq], v)
+	}
+	writeSegment(b, n.name, fields, seps)
+	return nil
+}
+
+// value returns the ER7 value of the field, component or subcomponent element n at level
+func (n *xmlNode) value(seps *Delimeters, level int) (string, error) {
+	if len(n.children) == 0 {
+		return n.text(seps), nil
+	}
+	if level == subComponentLevel {
+		return "", fmt.Errorf("Invalid element %s in subcomponent", n.children[0].name)
+	}
+	sep := seps.Component
+	if level == componentLevel {
+		sep = seps.SubComponent
+	}
+	parts := []string{}
+	for _, c := range n.children {
+		i, ok := xmlSeq(c.name)
+		if !ok {
+			return "", fmt.Errorf("Invalid element %s in %s", c.name, n.name)
+		}
+		for len(parts) < i {
+			parts = append(parts, "")
+		}
+		v, err := c.value(seps, level+1)
+		if err != nil {
+			return "", err
+		}
+		parts[i-1] = v
+	}
+	return strings.Join(parts, string(sep)), nil
+}
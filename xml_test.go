@@ -0,0 +1,118 @@
+package golevel7
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageXML(t *testing.T) {
+	data := "MSH|^~\\&|LAB|PA|EPIC||20050615230600||ORU^R01|1|T|2.5\r" +
+		"PID|1||1058299^^^HMRN~555^^^SSA||JONES^JOHN^A^||19670129|M|||1 MAIN ST\\F\\B^^CITY||||||||||||||||||\r" +
+		"ZPI|a&b^c||\r" +
+		"OBR|1||1|CBC\r" +
+		"OBX|1|TX|NOTE||line one\\.br\\line two \\H\\bold\\N\\|\r"
+	msg, err := ParseMessage([]byte(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := msg.EncodeXML()
+	if !assert.NoError(t, err) {
+		return
+	}
+	x := string(out)
+	assert.True(t, strings.HasPrefix(x, xml.Header+`<ORU_R01 xmlns="urn:hl7-org:v2xml">`))
+	assert.Contains(t, x, "<MSH.1>|</MSH.1>")
+	assert.Contains(t, x, "<MSH.2>^~\\&amp;</MSH.2>")
+	assert.Contains(t, x, "<MSH.9>\n      <MSG.1>ORU</MSG.1>\n      <MSG.2>R01</MSG.2>\n    </MSH.9>")
+	assert.Contains(t, x, "<ORU_R01.PATIENT_RESULT>")
+	assert.Contains(t, x, "<ORU_R01.ORDER_OBSERVATION>")
+	assert.Contains(t, x, "<PID.5>\n")
+	assert.Contains(t, x, "<XPN.1>JONES</XPN.1>")
+	assert.Contains(t, x, "<CX.1>555</CX.1>")
+	assert.Contains(t, x, "<PID.8>M</PID.8>")
+	assert.Contains(t, x, "<XAD.1>1 MAIN ST|B</XAD.1>")
+	assert.Contains(t, x, "<ZPI.1.1.1>a</ZPI.1.1.1>")
+	assert.Contains(t, x, `<OBX.5>line one<escape V=".br"></escape>line two <escape V="H"></escape>bold<escape V="N"></escape></OBX.5>`)
+	assert.NotContains(t, x, "<PID.2>")
+
+	back, err := ParseXML(out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, data, string(back.Encode()))
+	v, _ := back.Find("PID.11.1")
+	assert.Equal(t, "1 MAIN ST|B", v)
+
+	// compact through encoding/xml
+	out, err = xml.Marshal(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotContains(t, string(out), "\n")
+	back = &Message{}
+	if assert.NoError(t, xml.Unmarshal(out, back)) {
+		assert.Equal(t, data, string(back.Encode()))
+	}
+}
+
+func TestMessageXMLRoundTrip(t *testing.T) {
+	msgs := map[string][]byte{
+		// the terminators after the last segment are not kept
+		"no terminator": []byte("MSH|^~\\&|A|B|||20230101||ADT^A01|1|P|2.5\rPID|1||42"),
+		"crlf":          []byte("MSH|^~\\&|A|B|||20230101||ADT^A01|1|P|2.5\rPID|1||42\r\n\r\n"),
+	}
+	for _, fname := range []string{"msg.hl7", "msg2.hl7", "msg3.hl7", "msg4.hl7", "msg5.hl7", "msg6.hl7", "epic-oru-r01.hl7"} {
+		data, err := os.ReadFile("./testdata/" + fname)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		msgs[fname] = data
+	}
+	for fname, data := range msgs {
+		msg, err := ParseMessage(data)
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		out, err := msg.EncodeXML()
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		back, err := ParseXML(out)
+		if !assert.NoError(t, err, fname) {
+			continue
+		}
+		assert.Equal(t, strings.TrimRight(string(msg.Encode()), "\r\n")+"\r", string(back.Encode()), fname)
+		assert.Equal(t, len(msg.Segments), len(back.Segments), fname)
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	// delimeters of the message and group elements in any order
+	x := `<?xml version="1.0"?>
+<ADT_A01 xmlns="urn:hl7-org:v2xml">
+  <MSH><MSH.1>#</MSH.1><MSH.2>$%\&amp;</MSH.2><MSH.9><MSG.1>ADT</MSG.1><MSG.2>A01</MSG.2></MSH.9></MSH>
+  <ADT_A01.GROUP>
+    <PID>
+      <PID.3><CX.1>1</CX.1></PID.3>
+      <PID.3><CX.1>2</CX.1><CX.4><HD.2>X$Y</HD.2></CX.4></PID.3>
+      <PID.5><XPN.2>John</XPN.2></PID.5>
+    </PID>
+  </ADT_A01.GROUP>
+</ADT_A01>`
+	msg, err := ParseXML([]byte(x))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "MSH#$%\\&#######ADT$A01\rPID###1%2$$$&X\\S\\Y##$John\r", string(msg.Encode()))
+	v, _ := msg.Find("PID.3[2].4.2")
+	assert.Equal(t, "X$Y", v)
+
+	_, err = ParseXML([]byte(`<ACK><PID><PID.1>1</PID.1></PID></ACK>`))
+	assert.Error(t, err)
+	_, err = ParseXML([]byte(`<ACK><MSH><MSH.1>|</MSH.1><MSH.2>^~\&amp;</MSH.2><PID.3>1</PID.3></MSH></ACK>`))
+	assert.Error(t, err)
+}